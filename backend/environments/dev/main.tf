@@ -2,6 +2,8 @@
 #     Database     #
 ####################
 
+# legacy products table keyed by id alone, only read by the backfill into products_catalog_table; drop it
+# once the backfill is done, see the rollout notes of the backend README
 module "products_table" {
   source  = "terraform-aws-modules/dynamodb-table/aws"
   version = "3.3.0"
@@ -18,6 +20,195 @@ module "products_table" {
   ]
 }
 
+# the products, each in an item collection with its variants, next to the SKU lookup items
+module "products_catalog_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "products-catalog")
+  hash_key     = "id"
+  range_key    = "sk"
+  billing_mode = "PAY_PER_REQUEST"
+
+  attributes = [
+    {
+      name = "id",
+      type = "S"
+    },
+    {
+      name = "sk",
+      type = "S"
+    }
+  ]
+}
+
+module "products_audit_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "products-audit")
+  hash_key     = "productId"
+  range_key    = "version"
+  billing_mode = "PAY_PER_REQUEST"
+
+  attributes = [
+    {
+      name = "productId",
+      type = "S"
+    },
+    {
+      name = "version",
+      type = "N"
+    }
+  ]
+}
+
+module "categories_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "categories")
+  hash_key     = "id"
+  billing_mode = "PAY_PER_REQUEST"
+
+  attributes = [
+    {
+      name = "id",
+      type = "S"
+    },
+    {
+      name = "tree",
+      type = "S"
+    },
+    {
+      name = "path",
+      type = "S"
+    }
+  ]
+
+  # lists the categories, and the subtree of a category, in path order, see categories.PathIndex. Categories
+  # created before the index lack its tree attribute and must be given tree = "categories" to show up in it
+  global_secondary_indexes = [
+    {
+      name            = "path-index"
+      hash_key        = "tree"
+      range_key       = "path"
+      projection_type = "ALL"
+    }
+  ]
+}
+
+module "product_categories_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "product-categories")
+  hash_key     = "productId"
+  range_key    = "categoryId"
+  billing_mode = "PAY_PER_REQUEST"
+
+  attributes = [
+    {
+      name = "productId",
+      type = "S"
+    },
+    {
+      name = "categoryId",
+      type = "S"
+    }
+  ]
+
+  # lists the products of a category, see categories.ProductIndex
+  global_secondary_indexes = [
+    {
+      name            = "categoryId-index"
+      hash_key        = "categoryId"
+      range_key       = "productId"
+      projection_type = "KEYS_ONLY"
+    }
+  ]
+}
+
+module "orders_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "orders")
+  hash_key     = "id"
+  billing_mode = "PAY_PER_REQUEST"
+
+  attributes = [
+    {
+      name = "id",
+      type = "S"
+    }
+  ]
+}
+
+module "baskets_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "baskets")
+  hash_key     = "id"
+  billing_mode = "PAY_PER_REQUEST"
+
+  ttl_enabled        = true
+  ttl_attribute_name = "expiresAt"
+
+  attributes = [
+    {
+      name = "id",
+      type = "S"
+    }
+  ]
+}
+
+module "reservations_table" {
+  source  = "terraform-aws-modules/dynamodb-table/aws"
+  version = "3.3.0"
+
+  name         = format("%s-%s-%s", var.environment, var.solution_name, "reservations")
+  hash_key     = "id"
+  billing_mode = "PAY_PER_REQUEST"
+
+  # no TTL: the reconciler deletes expired reservations as it gives their units back to stock, a TTL
+  # delete would keep the units reserved for good
+
+  attributes = [
+    {
+      name = "id",
+      type = "S"
+    }
+  ]
+}
+
+####################
+#     Storage      #
+####################
+
+module "images_bucket" {
+  source  = "terraform-aws-modules/s3-bucket/aws"
+  version = "3.14.1"
+
+  bucket = format("%s-%s-%s", var.environment, var.solution_name, "images")
+
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+
+  # clients upload product images straight to the bucket with presigned PUTs
+  cors_rule = [
+    {
+      allowed_methods = ["PUT"]
+      allowed_origins = ["*"]
+      allowed_headers = ["Content-Type", "Content-Length"]
+      max_age_seconds = 3000
+    }
+  ]
+}
+
 ####################
 #   Permissions    #
 ####################
@@ -28,44 +219,597 @@ data "aws_iam_policy_document" "for_products_lambda" {
     actions = [
       "dynamodb:PutItem",
       "dynamodb:Query",
+      "dynamodb:BatchGetItem",
+      "dynamodb:Scan",
       "dynamodb:DeleteItem",
       "dynamodb:UpdateItem"
     ]
 
-    resources = [
-      module.products_table.dynamodb_table_arn,
-    ]
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:Query"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+
+  # presigned uploads are made with the permissions of the lambda
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:PutObject"
+    ]
+
+    resources = [
+      "${module.images_bucket.s3_bucket_arn}/products/*",
+    ]
+  }
+}
+
+module "role_for_products_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "products"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_products_lambda.json
+}
+
+data "aws_iam_policy_document" "for_categories_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:Query",
+      "dynamodb:PutItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem"
+    ]
+
+    resources = [
+      module.categories_table.dynamodb_table_arn,
+      "${module.categories_table.dynamodb_table_arn}/index/path-index",
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:DeleteItem",
+      "dynamodb:Query"
+    ]
+
+    resources = [
+      module.product_categories_table.dynamodb_table_arn,
+      "${module.product_categories_table.dynamodb_table_arn}/index/categoryId-index",
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Query",
+      "dynamodb:BatchGetItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_categories_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "categories"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_categories_lambda.json
+}
+
+data "aws_iam_policy_document" "for_orders_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:GetItem",
+      "dynamodb:Scan"
+    ]
+
+    resources = [
+      module.orders_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:BatchGetItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_orders_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "orders"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_orders_lambda.json
+}
+
+data "aws_iam_policy_document" "for_baskets_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:GetItem",
+      "dynamodb:DeleteItem"
+    ]
+
+    resources = [
+      module.baskets_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:BatchGetItem",
+      "dynamodb:UpdateItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.orders_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_baskets_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "baskets"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_baskets_lambda.json
+}
+
+data "aws_iam_policy_document" "for_inventory_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:GetItem",
+      "dynamodb:DeleteItem"
+    ]
+
+    resources = [
+      module.reservations_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Query",
+      "dynamodb:BatchGetItem",
+      "dynamodb:UpdateItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_inventory_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "inventory"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_inventory_lambda.json
+}
+
+data "aws_iam_policy_document" "for_reservations_reconciler_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Scan",
+      "dynamodb:GetItem",
+      "dynamodb:DeleteItem"
+    ]
+
+    resources = [
+      module.reservations_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:BatchGetItem",
+      "dynamodb:UpdateItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_reservations_reconciler_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "reservations-reconciler"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_reservations_reconciler_lambda.json
+}
+
+data "aws_iam_policy_document" "for_products_purger_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Scan",
+      "dynamodb:Query",
+      "dynamodb:DeleteItem",
+      "dynamodb:ConditionCheckItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+}
+
+module "role_for_products_purger_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "products-purger"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_products_purger_lambda.json
+}
+
+data "aws_iam_policy_document" "for_thumbnails_lambda" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Query",
+      "dynamodb:UpdateItem"
+    ]
+
+    resources = [
+      module.products_catalog_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem"
+    ]
+
+    resources = [
+      module.products_audit_table.dynamodb_table_arn,
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:GetObject"
+    ]
+
+    resources = [
+      "${module.images_bucket.s3_bucket_arn}/products/*",
+    ]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:PutObject"
+    ]
+
+    resources = [
+      "${module.images_bucket.s3_bucket_arn}/thumbnails/*",
+    ]
+  }
+}
+
+module "role_for_thumbnails_lambda" {
+  source = "../../modules/lambda_role"
+
+  environment                 = var.environment
+  solution_name               = var.solution_name
+  function_name               = "thumbnails"
+  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
+  role_policy_document        = data.aws_iam_policy_document.for_thumbnails_lambda.json
+}
+
+####################
+#    Functions     #
+####################
+
+module "products_lambda" {
+  source = "../../modules/lambda"
+
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_products_lambda.role_id
+  function_name = "products"
+  source_path   = "../../store_apis/cmd/lambdas/products"
+
+  env_vars = {
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    IMAGES_BUCKET        = "${module.images_bucket.s3_bucket_id}"
+  }
+}
+
+module "categories_lambda" {
+  source = "../../modules/lambda"
+
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_categories_lambda.role_id
+  function_name = "categories"
+  source_path   = "../../store_apis/cmd/lambdas/categories"
+
+  env_vars = {
+    PRODUCTS_TABLE           = "${module.products_catalog_table.dynamodb_table_id}"
+    CATEGORIES_TABLE         = "${module.categories_table.dynamodb_table_id}"
+    PRODUCT_CATEGORIES_TABLE = "${module.product_categories_table.dynamodb_table_id}"
+  }
+}
+
+module "orders_lambda" {
+  source = "../../modules/lambda"
+
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_orders_lambda.role_id
+  function_name = "orders"
+  source_path   = "../../store_apis/cmd/lambdas/orders"
+
+  env_vars = {
+    PRODUCTS_TABLE = "${module.products_catalog_table.dynamodb_table_id}"
+    ORDERS_TABLE   = "${module.orders_table.dynamodb_table_id}"
+  }
+}
+
+module "baskets_lambda" {
+  source = "../../modules/lambda"
+
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_baskets_lambda.role_id
+  function_name = "baskets"
+  source_path   = "../../store_apis/cmd/lambdas/baskets"
+
+  env_vars = {
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    ORDERS_TABLE         = "${module.orders_table.dynamodb_table_id}"
+    BASKETS_TABLE        = "${module.baskets_table.dynamodb_table_id}"
+  }
+}
+
+module "inventory_lambda" {
+  source = "../../modules/lambda"
+
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_inventory_lambda.role_id
+  function_name = "inventory"
+  source_path   = "../../store_apis/cmd/lambdas/inventory"
+
+  env_vars = {
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    RESERVATIONS_TABLE   = "${module.reservations_table.dynamodb_table_id}"
+    RESERVATION_TTL      = var.reservation_ttl
   }
 }
 
-module "role_for_products_lambda" {
-  source = "../../modules/lambda_role"
+module "reservations_reconciler_lambda" {
+  source = "../../modules/lambda"
 
-  environment                 = var.environment
-  solution_name               = var.solution_name
-  function_name               = "products"
-  assume_role_policy_document = data.aws_iam_policy_document.to_assume_lambda_service_role.json
-  role_policy_document        = data.aws_iam_policy_document.for_products_lambda.json
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_reservations_reconciler_lambda.role_id
+  function_name = "reservations-reconciler"
+  source_path   = "../../store_apis/cmd/lambdas/reservations_reconciler"
+  timeout       = 60
+
+  env_vars = {
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    RESERVATIONS_TABLE   = "${module.reservations_table.dynamodb_table_id}"
+  }
 }
 
-####################
-#    Functions     #
-####################
+module "products_purger_lambda" {
+  source = "../../modules/lambda"
 
-module "products_lambda" {
+  environment   = var.environment
+  solution_name = var.solution_name
+  role_id       = module.role_for_products_purger_lambda.role_id
+  function_name = "products-purger"
+  source_path   = "../../store_apis/cmd/lambdas/products_purger"
+  timeout       = 60
+
+  env_vars = {
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    PRODUCTS_RETENTION   = var.products_retention
+  }
+}
+
+module "thumbnails_lambda" {
   source = "../../modules/lambda"
 
   environment   = var.environment
   solution_name = var.solution_name
-  role_id       = module.role_for_products_lambda.role_id
-  function_name = "products"
-  source_path   = "../../store_apis/cmd/lambdas/products"
+  role_id       = module.role_for_thumbnails_lambda.role_id
+  function_name = "thumbnails"
+  source_path   = "../../store_apis/cmd/lambdas/thumbnails"
+  memory_size   = 1024 # decoded images are held in memory, and resizing is CPU bound
+  timeout       = 60
 
   env_vars = {
-    PRODUCTS_TABLE = "${module.products_table.dynamodb_table_id}"
+    PRODUCTS_TABLE       = "${module.products_catalog_table.dynamodb_table_id}"
+    PRODUCTS_AUDIT_TABLE = "${module.products_audit_table.dynamodb_table_id}"
+    IMAGES_BUCKET        = "${module.images_bucket.s3_bucket_id}"
+    THUMBNAIL_SIZES      = var.thumbnail_sizes
   }
 }
 
+####################
+#    Schedules     #
+####################
+
+resource "aws_cloudwatch_event_rule" "reconcile_reservations" {
+  name                = format("%s-%s-%s", var.environment, var.solution_name, "reconcile-reservations")
+  description         = "releases the stock held by expired reservations"
+  schedule_expression = var.reservations_reconcile_schedule
+}
+
+resource "aws_cloudwatch_event_target" "reconcile_reservations" {
+  rule = aws_cloudwatch_event_rule.reconcile_reservations.name
+  arn  = module.reservations_reconciler_lambda.function_arn
+}
+
+resource "aws_lambda_permission" "reconcile_reservations" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.reservations_reconciler_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.reconcile_reservations.arn
+}
+
+resource "aws_cloudwatch_event_rule" "purge_deleted_products" {
+  name                = format("%s-%s-%s", var.environment, var.solution_name, "purge-deleted-products")
+  description         = "removes the products deleted longer than the retention period"
+  schedule_expression = var.products_purge_schedule
+}
+
+resource "aws_cloudwatch_event_target" "purge_deleted_products" {
+  rule = aws_cloudwatch_event_rule.purge_deleted_products.name
+  arn  = module.products_purger_lambda.function_arn
+}
+
+resource "aws_lambda_permission" "purge_deleted_products" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = module.products_purger_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.purge_deleted_products.arn
+}
+
+####################
+#  Notifications   #
+####################
+
+# thumbnails are written under thumbnails/, outside the prefix, so they do not trigger the lambda again
+resource "aws_s3_bucket_notification" "images_uploaded" {
+  bucket = module.images_bucket.s3_bucket_id
+
+  lambda_function {
+    lambda_function_arn = module.thumbnails_lambda.function_arn
+    events              = ["s3:ObjectCreated:*"]
+    filter_prefix       = "products/"
+  }
+
+  depends_on = [aws_lambda_permission.images_uploaded]
+}
+
+resource "aws_lambda_permission" "images_uploaded" {
+  statement_id  = "AllowExecutionFromS3"
+  action        = "lambda:InvokeFunction"
+  function_name = module.thumbnails_lambda.function_name
+  principal     = "s3.amazonaws.com"
+  source_arn    = module.images_bucket.s3_bucket_arn
+}
+
 ####################
 #   API Gateway    #
 ####################
@@ -91,6 +835,46 @@ module "products_lambda_integration" {
   function_name     = module.products_lambda.function_name
 }
 
+module "categories_lambda_integration" {
+  source = "../../modules/api_gateway_lambda_integration"
+
+  api_id            = module.api_gw.api_id
+  api_execution_arn = module.api_gw.api_execution_arn
+  integration_type  = "AWS_PROXY"
+  integration_uri   = module.categories_lambda.invoke_arn
+  function_name     = module.categories_lambda.function_name
+}
+
+module "orders_lambda_integration" {
+  source = "../../modules/api_gateway_lambda_integration"
+
+  api_id            = module.api_gw.api_id
+  api_execution_arn = module.api_gw.api_execution_arn
+  integration_type  = "AWS_PROXY"
+  integration_uri   = module.orders_lambda.invoke_arn
+  function_name     = module.orders_lambda.function_name
+}
+
+module "baskets_lambda_integration" {
+  source = "../../modules/api_gateway_lambda_integration"
+
+  api_id            = module.api_gw.api_id
+  api_execution_arn = module.api_gw.api_execution_arn
+  integration_type  = "AWS_PROXY"
+  integration_uri   = module.baskets_lambda.invoke_arn
+  function_name     = module.baskets_lambda.function_name
+}
+
+module "inventory_lambda_integration" {
+  source = "../../modules/api_gateway_lambda_integration"
+
+  api_id            = module.api_gw.api_id
+  api_execution_arn = module.api_gw.api_execution_arn
+  integration_type  = "AWS_PROXY"
+  integration_uri   = module.inventory_lambda.invoke_arn
+  function_name     = module.inventory_lambda.function_name
+}
+
 ##########################
 #   API Gateway Routes   #
 ##########################
@@ -103,6 +887,14 @@ module "create_product_route" {
   integration_id = module.products_lambda_integration.id
 }
 
+module "list_products_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /products"
+  integration_id = module.products_lambda_integration.id
+}
+
 module "read_product_route" {
   source = "../../modules/api_gateway_routes"
 
@@ -119,6 +911,14 @@ module "update_product_route" {
   integration_id = module.products_lambda_integration.id
 }
 
+module "patch_product_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PATCH /products/{id}"
+  integration_id = module.products_lambda_integration.id
+}
+
 module "delete_product_route" {
   source = "../../modules/api_gateway_routes"
 
@@ -126,3 +926,243 @@ module "delete_product_route" {
   route_key      = "DELETE /products/{id}"
   integration_id = module.products_lambda_integration.id
 }
+
+module "restore_product_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /products/{id}/restore"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "product_history_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /products/{id}/history"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "create_product_image_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /products/{id}/images"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "update_product_images_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PUT /products/{id}/images"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "list_variants_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /products/{id}/variants"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "create_variant_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /products/{id}/variants"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "get_variant_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /products/{id}/variants/{variantId}"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "update_variant_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PUT /products/{id}/variants/{variantId}"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "delete_variant_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "DELETE /products/{id}/variants/{variantId}"
+  integration_id = module.products_lambda_integration.id
+}
+
+module "create_category_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /categories"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "list_categories_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /categories"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "read_category_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /categories/{id}"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "update_category_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PUT /categories/{id}"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "delete_category_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "DELETE /categories/{id}"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "list_category_products_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /categories/{id}/products"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "assign_category_product_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PUT /categories/{id}/products/{productId}"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "unassign_category_product_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "DELETE /categories/{id}/products/{productId}"
+  integration_id = module.categories_lambda_integration.id
+}
+
+module "create_order_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /orders"
+  integration_id = module.orders_lambda_integration.id
+}
+
+module "list_orders_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /orders"
+  integration_id = module.orders_lambda_integration.id
+}
+
+module "read_order_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /orders/{id}"
+  integration_id = module.orders_lambda_integration.id
+}
+
+module "read_basket_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /baskets/{id}"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "clear_basket_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "DELETE /baskets/{id}"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "add_basket_item_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /baskets/{id}/items"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "change_basket_item_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "PUT /baskets/{id}/items/{productId}"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "remove_basket_item_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "DELETE /baskets/{id}/items/{productId}"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "checkout_basket_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /baskets/{id}/checkout"
+  integration_id = module.baskets_lambda_integration.id
+}
+
+module "read_stock_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "GET /inventory/{productId}"
+  integration_id = module.inventory_lambda_integration.id
+}
+
+module "reserve_stock_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /inventory/reservations"
+  integration_id = module.inventory_lambda_integration.id
+}
+
+module "release_reservation_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /inventory/reservations/{id}/release"
+  integration_id = module.inventory_lambda_integration.id
+}
+
+module "commit_reservation_route" {
+  source = "../../modules/api_gateway_routes"
+
+  api_id         = module.api_gw.api_id
+  route_key      = "POST /inventory/reservations/{id}/commit"
+  integration_id = module.inventory_lambda_integration.id
+}
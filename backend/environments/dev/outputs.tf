@@ -6,6 +6,46 @@ output "products_lambda_arn" {
   value = module.products_lambda.function_arn
 }
 
+output "images_bucket_arn" {
+  value = module.images_bucket.s3_bucket_arn
+}
+
+output "thumbnails_lambda_arn" {
+  value = module.thumbnails_lambda.function_arn
+}
+
+output "categories_table_arn" {
+  value = module.categories_table.dynamodb_table_arn
+}
+
+output "categories_lambda_arn" {
+  value = module.categories_lambda.function_arn
+}
+
+output "orders_table_arn" {
+  value = module.orders_table.dynamodb_table_arn
+}
+
+output "orders_lambda_arn" {
+  value = module.orders_lambda.function_arn
+}
+
+output "baskets_table_arn" {
+  value = module.baskets_table.dynamodb_table_arn
+}
+
+output "baskets_lambda_arn" {
+  value = module.baskets_lambda.function_arn
+}
+
+output "reservations_table_arn" {
+  value = module.reservations_table.dynamodb_table_arn
+}
+
+output "inventory_lambda_arn" {
+  value = module.inventory_lambda.function_arn
+}
+
 output "stage_invoke_url" {
   value = module.api_gw.stage_invoke_url
 }
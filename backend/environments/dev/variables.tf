@@ -12,3 +12,28 @@ variable "solution_name" {
   type    = string
   default = "my-store"
 }
+
+variable "reservation_ttl" {
+  type    = string
+  default = "15m"
+}
+
+variable "reservations_reconcile_schedule" {
+  type    = string
+  default = "rate(5 minutes)"
+}
+
+variable "products_retention" {
+  type    = string
+  default = "720h"
+}
+
+variable "products_purge_schedule" {
+  type    = string
+  default = "rate(1 day)"
+}
+
+variable "thumbnail_sizes" {
+  type    = string
+  default = "200,800"
+}
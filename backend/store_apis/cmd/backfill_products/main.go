@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// Copies the products of the legacy products table, keyed by id alone, into PRODUCTS_TABLE, keyed by id and
+// sk. It can be rerun as often as needed, see the rollout notes of the backend README
+func main() {
+	legacyTable := flag.String("legacy-table", "", "name of the legacy products table to copy from")
+	flag.Parse()
+
+	cfg := new(config.Cfg)
+	if err := envconfig.Process("", cfg); err != nil {
+		log.Fatal().Msgf("bad environment configuration: %v", err)
+	}
+	if *legacyTable == "" || cfg.ProductsTable == "" {
+		log.Fatal().Msg("both -legacy-table and PRODUCTS_TABLE are required")
+	}
+
+	awsSvc, err := aws_services.NewAWS(cfg.AWSRegion, cfg.DynamoDBEndpoint)
+	if err != nil {
+		log.Fatal().Msgf("error setting AWS services: %v", err)
+	}
+
+	copied, err := products.NewDynamoDBRepository(cfg, awsSvc).Backfill(context.Background(), *legacyTable)
+	log.Info().Msgf("copied %d products from %s to %s", copied, *legacyTable, cfg.ProductsTable)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"store_apis/pkg/handlers"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	h, err := handlers.New()
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	lambda.Start(h.BasketsHandler)
+}
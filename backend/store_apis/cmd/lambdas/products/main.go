@@ -4,8 +4,14 @@ import (
 	"store_apis/pkg/handlers"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	lambda.Start(handlers.ProductsHandler)
+	h, err := handlers.New()
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	lambda.Start(h.ProductsHandler)
 }
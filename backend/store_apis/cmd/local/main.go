@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	"store_apis/pkg/categories"
+	"store_apis/pkg/config"
+	"store_apis/pkg/handlers"
+	"store_apis/pkg/localserver"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// Serves every store API on one local port. Without DYNAMODB_ENDPOINT the tables live in memory and
+// are lost on exit; with it, e.g. http://localhost:8000, requests go to DynamoDB Local. Image uploads are
+// only presigned against an in-memory bucket along with in-memory tables
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	flag.Parse()
+
+	cfg := new(config.Cfg)
+	if err := envconfig.Process("", cfg); err != nil {
+		log.Fatal().Msgf("bad environment configuration: %v", err)
+	}
+	setDefaultTables(cfg)
+
+	var awsSvc *aws_services.AWS
+	if cfg.DynamoDBEndpoint == "" {
+		log.Info().Msg("using in-memory DynamoDB")
+		fakeS3 := fake_aws_services.NewS3()
+		fakeS3.CreateBucket(cfg.ImagesBucket)
+		awsSvc = &aws_services.AWS{DDBClient: newFakeDynamoDB(cfg), S3Client: fakeS3, S3Presigner: fakeS3}
+	} else {
+		log.Info().Msgf("using DynamoDB at %s", cfg.DynamoDBEndpoint)
+		var err error
+		awsSvc, err = aws_services.NewAWS(cfg.AWSRegion, cfg.DynamoDBEndpoint)
+		if err != nil {
+			log.Fatal().Msgf("error setting AWS services: %v", err)
+		}
+	}
+
+	log.Info().Msgf("listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, localserver.New(handlers.NewWithAWS(cfg, awsSvc).Router())); err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+}
+
+func setDefaultTables(cfg *config.Cfg) {
+	defaults := map[*string]string{
+		&cfg.ProductsTable:          "products",
+		&cfg.ProductsAuditTable:     "products-audit",
+		&cfg.CategoriesTable:        "categories",
+		&cfg.ProductCategoriesTable: "product-categories",
+		&cfg.OrdersTable:            "orders",
+		&cfg.BasketsTable:           "baskets",
+		&cfg.ReservationsTable:      "reservations",
+	}
+	for table, name := range defaults {
+		if *table == "" {
+			*table = name
+		}
+	}
+	if cfg.ImagesBucket == "" {
+		cfg.ImagesBucket = "product-images"
+	}
+}
+
+func newFakeDynamoDB(cfg *config.Cfg) *fake_aws_services.DynamoDB {
+	ddb := fake_aws_services.NewDynamoDB()
+	for _, table := range []string{cfg.CategoriesTable, cfg.OrdersTable, cfg.BasketsTable, cfg.ReservationsTable} {
+		ddb.CreateTable(table, "id", "")
+	}
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateIndex(cfg.CategoriesTable, categories.PathIndex, categories.TreeAttribute, "path")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.ProductCategoriesTable, "productId", "categoryId")
+	ddb.CreateIndex(cfg.ProductCategoriesTable, categories.ProductIndex, "categoryId", "productId")
+	return ddb
+}
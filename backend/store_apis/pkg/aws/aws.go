@@ -6,24 +6,37 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type AWS struct {
-	config    aws.Config
-	DDBClient DynamoDBClientAPI
+	config      aws.Config
+	DDBClient   DynamoDBClientAPI
+	S3Client    S3ClientAPI
+	S3Presigner S3PresignAPI
 }
 
-func NewAWS(region string) (*AWS, error) {
+// NewAWS loads the default AWS config for region. A non empty dynamoDBEndpoint points the DynamoDB
+// client somewhere other than AWS, such as DynamoDB Local
+func NewAWS(region, dynamoDBEndpoint string) (*AWS, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
 	if err != nil {
 		return nil, err
 	}
 
 	// Set respective AWS services clients below
-	dynamoDbClient := dynamodb.NewFromConfig(cfg)
+	dynamoDbClient := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if dynamoDBEndpoint != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(dynamoDBEndpoint)
+		}
+	})
+
+	s3Client := s3.NewFromConfig(cfg)
 
 	return &AWS{
-		config:    cfg,
-		DDBClient: dynamoDbClient,
+		config:      cfg,
+		DDBClient:   dynamoDbClient,
+		S3Client:    s3Client,
+		S3Presigner: s3.NewPresignClient(s3Client),
 	}, nil
 }
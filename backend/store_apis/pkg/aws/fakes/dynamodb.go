@@ -0,0 +1,803 @@
+// Package fake_aws_services provides in-memory implementations of the AWS client interfaces,
+// so tests can exercise real read-after-write behavior without AWS.
+package fake_aws_services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	aws_services "store_apis/pkg/aws"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// DynamoDB is an in-memory DynamoDBClientAPI. Items are stored per table keyed by their primary key, and
+// key conditions, filters, condition expressions and update expressions are evaluated as DynamoDB does
+type DynamoDB struct {
+	mu     sync.Mutex
+	tables map[string]*table
+
+	// batchGetLimit caps the keys BatchGetItem reads per call, see SetBatchGetLimit
+	batchGetLimit int
+}
+
+type table struct {
+	name     string
+	hashKey  string
+	rangeKey string
+	items    map[string]item
+
+	indexes map[string]*table // global secondary indexes by name, their items are computed on read
+	base    *table            // the table of an index, nil for tables
+}
+
+// write is a prepared change to a single item. A nil value deletes the item
+type write struct {
+	table *table
+	key   string
+	value item
+}
+
+var _ aws_services.DynamoDBClientAPI = (*DynamoDB)(nil)
+
+func NewDynamoDB() *DynamoDB {
+	return &DynamoDB{tables: map[string]*table{}}
+}
+
+// CreateTable registers a table with the given key schema. rangeKey is empty for hash-only tables
+func (d *DynamoDB) CreateTable(name, hashKey, rangeKey string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tables[name] = &table{
+		name:     name,
+		hashKey:  hashKey,
+		rangeKey: rangeKey,
+		items:    map[string]item{},
+		indexes:  map[string]*table{},
+	}
+}
+
+// CreateIndex adds a global secondary index projecting all attributes to a table created before. The index
+// is sparse as in DynamoDB, holding only the items with its key attributes
+func (d *DynamoDB) CreateIndex(tableName, indexName, hashKey, rangeKey string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := d.tables[tableName]
+	t.indexes[indexName] = &table{
+		name:     indexName,
+		hashKey:  hashKey,
+		rangeKey: rangeKey,
+		base:     t,
+	}
+}
+
+// SetBatchGetLimit makes BatchGetItem read at most n keys per call and hand the rest back as
+// UnprocessedKeys, the way DynamoDB does when a batch exceeds its size or throughput limits. Zero disables it
+func (d *DynamoDB) SetBatchGetLimit(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.batchGetLimit = n
+}
+
+// GetItem reads are always strongly consistent in the fake, so ConsistentRead makes no difference
+func (d *DynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.exactKeyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	projection, err := optionalProjection(params.ProjectionExpression, params.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.GetItemOutput{}
+	if it, ok := t.items[k]; ok {
+		out.Item = project(it, projection)
+	}
+	return out, nil
+}
+
+// BatchGetItem rejects more than 100 keys or a key requested twice, like DynamoDB. Missing items are left
+// out of the responses, and keys over the limit set with SetBatchGetLimit come back as UnprocessedKeys
+func (d *DynamoDB) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(params.RequestItems) == 0 {
+		return nil, validationErr("RequestItems must not be empty")
+	}
+
+	total := 0
+	for _, ka := range params.RequestItems {
+		total += len(ka.Keys)
+	}
+	if total > 100 {
+		return nil, validationErr("too many items requested for the BatchGetItem call")
+	}
+
+	names := make([]string, 0, len(params.RequestItems))
+	for name := range params.RequestItems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	read := 0
+	for _, name := range names {
+		ka := params.RequestItems[name]
+		t, err := d.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		projection, err := optionalProjection(ka.ProjectionExpression, ka.ExpressionAttributeNames)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		found := []map[string]types.AttributeValue{}
+		for _, key := range ka.Keys {
+			k, err := t.exactKeyOf(key)
+			if err != nil {
+				return nil, err
+			}
+			if seen[k] {
+				return nil, validationErr("provided list of item keys contains duplicates")
+			}
+			seen[k] = true
+
+			if d.batchGetLimit > 0 && read >= d.batchGetLimit {
+				unprocessed := out.UnprocessedKeys[name]
+				unprocessed.Keys = append(unprocessed.Keys, copyItem(key))
+				unprocessed.ProjectionExpression = ka.ProjectionExpression
+				unprocessed.ExpressionAttributeNames = ka.ExpressionAttributeNames
+				unprocessed.ConsistentRead = ka.ConsistentRead
+				out.UnprocessedKeys[name] = unprocessed
+				continue
+			}
+			read++
+			if it, ok := t.items[k]; ok {
+				found = append(found, project(it, projection))
+			}
+		}
+		out.Responses[name] = found
+	}
+	return out, nil
+}
+
+func (d *DynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, old, err := d.preparePut(params.TableName, params.Item, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.commit()
+
+	out := &dynamodb.PutItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && old != nil {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+func (d *DynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, old, err := d.prepareDelete(params.TableName, params.Key, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.commit()
+
+	out := &dynamodb.DeleteItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && old != nil {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+func (d *DynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, old, err := d.prepareUpdate(params.TableName, params.Key, params.UpdateExpression, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.commit()
+
+	out := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case types.ReturnValueNone, "":
+	case types.ReturnValueAllNew:
+		out.Attributes = copyItem(w.value)
+	case types.ReturnValueAllOld:
+		if old != nil {
+			out.Attributes = copyItem(old)
+		}
+	default:
+		return nil, validationErr("ReturnValues %s is not supported by the fake", params.ReturnValues)
+	}
+	return out, nil
+}
+
+// TransactWriteItems validates every action before applying any of them, so either all writes succeed or
+// none do. A failed condition cancels the transaction with a reason per action, in request order
+func (d *DynamoDB) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > 100 {
+		return nil, validationErr("transaction must contain between 1 and 100 items")
+	}
+
+	writes := make([]*write, 0, len(params.TransactItems))
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	seen := map[string]bool{}
+	cancelled := false
+
+	for i, ti := range params.TransactItems {
+		var (
+			w   *write
+			err error
+		)
+		switch {
+		case ti.Put != nil:
+			w, _, err = d.preparePut(ti.Put.TableName, ti.Put.Item, ti.Put.ConditionExpression, ti.Put.ExpressionAttributeNames, ti.Put.ExpressionAttributeValues)
+		case ti.Delete != nil:
+			w, _, err = d.prepareDelete(ti.Delete.TableName, ti.Delete.Key, ti.Delete.ConditionExpression, ti.Delete.ExpressionAttributeNames, ti.Delete.ExpressionAttributeValues)
+		case ti.Update != nil:
+			w, _, err = d.prepareUpdate(ti.Update.TableName, ti.Update.Key, ti.Update.UpdateExpression, ti.Update.ConditionExpression, ti.Update.ExpressionAttributeNames, ti.Update.ExpressionAttributeValues)
+		case ti.ConditionCheck != nil:
+			w, err = d.prepareConditionCheck(ti.ConditionCheck)
+		default:
+			return nil, validationErr("transaction item %d has no action", i)
+		}
+
+		if isConditionFailed(err) {
+			cancelled = true
+			reasons[i] = types.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		id := w.table.name + "/" + w.key
+		if seen[id] {
+			return nil, validationErr("transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = true
+
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		writes = append(writes, w)
+	}
+
+	if cancelled {
+		codes := make([]string, 0, len(reasons))
+		for _, r := range reasons {
+			codes = append(codes, aws.ToString(r.Code))
+		}
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, w := range writes {
+		w.commit()
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (d *DynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if params.IndexName != nil {
+		if t, err = t.index(*params.IndexName); err != nil {
+			return nil, err
+		}
+		if aws.ToBool(params.ConsistentRead) {
+			return nil, validationErr("Consistent reads are not supported on global secondary indexes")
+		}
+	}
+	if params.KeyConditionExpression == nil {
+		return nil, validationErr("KeyConditionExpression is required")
+	}
+
+	keyCond, err := parseCondition(*params.KeyConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, validationErr("invalid KeyConditionExpression: %v", err)
+	}
+
+	matched := []item{}
+	for _, it := range t.sorted() {
+		ok, err := keyCond(it)
+		if err != nil {
+			return nil, validationErr("invalid KeyConditionExpression: %v", err)
+		}
+		if ok {
+			matched = append(matched, it)
+		}
+	}
+
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	if !forward {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	page, err := t.page(matched, params.ExclusiveStartKey, forward, params.Limit, params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.QueryOutput{
+		Items:            page.items,
+		Count:            int32(len(page.items)),
+		ScannedCount:     page.scanned,
+		LastEvaluatedKey: page.lastKey,
+	}, nil
+}
+
+func (d *DynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, err := d.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := t.page(t.sorted(), params.ExclusiveStartKey, true, params.Limit, params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.ScanOutput{
+		Items:            page.items,
+		Count:            int32(len(page.items)),
+		ScannedCount:     page.scanned,
+		LastEvaluatedKey: page.lastKey,
+	}, nil
+}
+
+func (d *DynamoDB) table(name *string) (*table, error) {
+	t, ok := d.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{
+			Message: aws.String(fmt.Sprintf("Requested resource not found: Table: %s not found", aws.ToString(name))),
+		}
+	}
+	return t, nil
+}
+
+// index returns a view of the global secondary index, holding the items of the table that have its key attributes
+func (t *table) index(name string) (*table, error) {
+	idx, ok := t.indexes[name]
+	if !ok {
+		return nil, validationErr("The table does not have the specified index: %s", name)
+	}
+
+	view := &table{
+		name:     idx.name,
+		hashKey:  idx.hashKey,
+		rangeKey: idx.rangeKey,
+		items:    map[string]item{},
+		base:     t,
+	}
+	for key, it := range t.items {
+		if _, ok := it[idx.hashKey]; !ok {
+			continue
+		}
+		if _, ok := it[idx.rangeKey]; idx.rangeKey != "" && !ok {
+			continue
+		}
+		view.items[key] = it
+	}
+	return view, nil
+}
+
+func (d *DynamoDB) preparePut(name *string, newItem item, condExpr *string, names map[string]string, values map[string]types.AttributeValue) (*write, item, error) {
+	t, err := d.table(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := t.keyOf(newItem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	old := t.items[key]
+	if err := checkCondition(old, condExpr, names, values); err != nil {
+		return nil, nil, err
+	}
+
+	return &write{table: t, key: key, value: copyItem(newItem)}, old, nil
+}
+
+func (d *DynamoDB) prepareDelete(name *string, keyAttrs item, condExpr *string, names map[string]string, values map[string]types.AttributeValue) (*write, item, error) {
+	t, err := d.table(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := t.exactKeyOf(keyAttrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	old := t.items[key]
+	if err := checkCondition(old, condExpr, names, values); err != nil {
+		return nil, nil, err
+	}
+
+	return &write{table: t, key: key}, old, nil
+}
+
+// prepareUpdate applies the update to a copy of the item, creating it from its key when it does not exist
+func (d *DynamoDB) prepareUpdate(name *string, keyAttrs item, updateExpr, condExpr *string, names map[string]string, values map[string]types.AttributeValue) (*write, item, error) {
+	t, err := d.table(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := t.exactKeyOf(keyAttrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	old := t.items[key]
+	if err := checkCondition(old, condExpr, names, values); err != nil {
+		return nil, nil, err
+	}
+
+	updated := copyItem(old)
+	if updated == nil {
+		updated = copyItem(keyAttrs)
+	}
+
+	if updateExpr != nil {
+		apply, err := parseUpdate(*updateExpr, names, values)
+		if err != nil {
+			return nil, nil, validationErr("invalid UpdateExpression: %v", err)
+		}
+		if err := apply(updated); err != nil {
+			return nil, nil, validationErr("invalid UpdateExpression: %v", err)
+		}
+	}
+
+	if newKey, err := t.keyOf(updated); err != nil || newKey != key {
+		return nil, nil, validationErr("cannot update attribute %s, this attribute is part of the key", t.hashKey)
+	}
+
+	return &write{table: t, key: key, value: updated}, old, nil
+}
+
+func (d *DynamoDB) prepareConditionCheck(cc *types.ConditionCheck) (*write, error) {
+	t, err := d.table(cc.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.exactKeyOf(cc.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	old := t.items[key]
+	if err := checkCondition(old, cc.ConditionExpression, cc.ExpressionAttributeNames, cc.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	// a condition check writes nothing back, committing it keeps the item as is
+	return &write{table: t, key: key, value: old}, nil
+}
+
+func (w *write) commit() {
+	if w.value == nil {
+		delete(w.table.items, w.key)
+		return
+	}
+	w.table.items[w.key] = w.value
+}
+
+func checkCondition(existing item, condExpr *string, names map[string]string, values map[string]types.AttributeValue) error {
+	if condExpr == nil || *condExpr == "" {
+		return nil
+	}
+
+	cond, err := parseCondition(*condExpr, names, values)
+	if err != nil {
+		return validationErr("invalid ConditionExpression: %v", err)
+	}
+
+	if existing == nil {
+		existing = item{}
+	}
+	ok, err := cond(existing)
+	if err != nil {
+		return validationErr("invalid ConditionExpression: %v", err)
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return nil
+}
+
+func isConditionFailed(err error) bool {
+	_, ok := err.(*types.ConditionalCheckFailedException)
+	return ok
+}
+
+// keyOf serializes the primary key of an item, which must hold every key attribute
+func (t *table) keyOf(it item) (string, error) {
+	parts := []string{}
+	for _, name := range []string{t.hashKey, t.rangeKey} {
+		if name == "" {
+			continue
+		}
+		v, ok := it[name]
+		if !ok {
+			return "", validationErr("one of the required keys was not given a value: %s", name)
+		}
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			parts = append(parts, "S:"+v.Value)
+		case *types.AttributeValueMemberN:
+			parts = append(parts, "N:"+normalizeNumbers([]string{v.Value})[0])
+		case *types.AttributeValueMemberB:
+			parts = append(parts, "B:"+string(v.Value))
+		default:
+			return "", validationErr("invalid type for key attribute %s", name)
+		}
+	}
+	return strings.Join(parts, "|"), nil
+}
+
+// exactKeyOf is keyOf for a Key parameter, which must not hold anything other than the key attributes
+func (t *table) exactKeyOf(key item) (string, error) {
+	want := 1
+	if t.rangeKey != "" {
+		want = 2
+	}
+	if len(key) != want {
+		return "", validationErr("the provided key element does not match the schema")
+	}
+	return t.keyOf(key)
+}
+
+// keyAttrs returns the key of an item as LastEvaluatedKey holds it, which for an index includes the table key
+func (t *table) keyAttrs(it item) item {
+	out := item{t.hashKey: it[t.hashKey]}
+	if t.rangeKey != "" {
+		out[t.rangeKey] = it[t.rangeKey]
+	}
+	if t.base != nil {
+		for name, v := range t.base.keyAttrs(it) {
+			out[name] = v
+		}
+	}
+	return copyItem(out)
+}
+
+// compareKeys orders items by hash key then range key, which is the order Scan and Query return them in
+func (t *table) compareKeys(a, b item) int {
+	for _, name := range []string{t.hashKey, t.rangeKey} {
+		if name == "" {
+			continue
+		}
+		av, bv := a[name], b[name]
+		if av == nil || bv == nil {
+			continue
+		}
+		c, ok := compare(av, bv)
+		if !ok {
+			c = strings.Compare(typeOf(av), typeOf(bv))
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	// items sharing an index key come in the order of their table key
+	if t.base != nil {
+		return t.base.compareKeys(a, b)
+	}
+	return 0
+}
+
+func (t *table) sorted() []item {
+	out := make([]item, 0, len(t.items))
+	for _, it := range t.items {
+		out = append(out, it)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return t.compareKeys(out[i], out[j]) < 0
+	})
+	return out
+}
+
+type page struct {
+	items   []map[string]types.AttributeValue
+	scanned int32
+	lastKey map[string]types.AttributeValue
+}
+
+// page reads candidates in order, after startKey. Limit caps the items evaluated, before the filter is applied
+func (t *table) page(candidates []item, startKey item, forward bool, limit *int32, filterExpr, projectionExpr *string, names map[string]string, values map[string]types.AttributeValue) (*page, error) {
+	var filter condFn
+	if filterExpr != nil && *filterExpr != "" {
+		f, err := parseCondition(*filterExpr, names, values)
+		if err != nil {
+			return nil, validationErr("invalid FilterExpression: %v", err)
+		}
+		filter = f
+	}
+
+	projection, err := optionalProjection(projectionExpr, names)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(startKey) > 0 {
+		for len(candidates) > 0 {
+			c := t.compareKeys(candidates[0], startKey)
+			if (forward && c > 0) || (!forward && c < 0) {
+				break
+			}
+			candidates = candidates[1:]
+		}
+	}
+
+	out := &page{items: []map[string]types.AttributeValue{}}
+	for i, it := range candidates {
+		if limit != nil && out.scanned == *limit {
+			out.lastKey = t.keyAttrs(candidates[i-1])
+			break
+		}
+		out.scanned++
+
+		if filter != nil {
+			ok, err := filter(it)
+			if err != nil {
+				return nil, validationErr("invalid FilterExpression: %v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		out.items = append(out.items, project(it, projection))
+	}
+
+	return out, nil
+}
+
+func parseProjection(expr string, names map[string]string) ([]path, error) {
+	p, err := newParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []path{}
+	for {
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pth)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected token %q", t.text)
+	}
+	return out, nil
+}
+
+func optionalProjection(expr *string, names map[string]string) ([]path, error) {
+	if expr == nil || *expr == "" {
+		return nil, nil
+	}
+	projection, err := parseProjection(*expr, names)
+	if err != nil {
+		return nil, validationErr("invalid ProjectionExpression: %v", err)
+	}
+	return projection, nil
+}
+
+// project copies the top level attributes named by the projection, or the whole item without one
+func project(it item, projection []path) item {
+	if projection == nil {
+		return copyItem(it)
+	}
+	out := item{}
+	for _, pth := range projection {
+		if v, ok := it[pth[0].name]; ok {
+			out[pth[0].name] = copyValue(v)
+		}
+	}
+	return out
+}
+
+func copyItem(it item) item {
+	if it == nil {
+		return nil
+	}
+	out := make(item, len(it))
+	for k, v := range it {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v types.AttributeValue) types.AttributeValue {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte{}, v.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *types.AttributeValueMemberL:
+		out := make([]types.AttributeValue, 0, len(v.Value))
+		for _, e := range v.Value {
+			out = append(out, copyValue(e))
+		}
+		return &types.AttributeValueMemberL{Value: out}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: copyItem(v.Value)}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberBS:
+		out := make([][]byte, 0, len(v.Value))
+		for _, e := range v.Value {
+			out = append(out, append([]byte{}, e...))
+		}
+		return &types.AttributeValueMemberBS{Value: out}
+	}
+	return v
+}
+
+func validationErr(format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{
+		Code:    "ValidationException",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
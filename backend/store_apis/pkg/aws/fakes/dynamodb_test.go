@@ -0,0 +1,408 @@
+package fake_aws_services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	Id    string `dynamodbav:"id"`
+	Name  string `dynamodbav:"name"`
+	Stock int64  `dynamodbav:"stock"`
+}
+
+func putTestItem(t *testing.T, ddb *DynamoDB, it testItem) {
+	avMap, err := attributevalue.MarshalMap(it)
+	assert.NoError(t, err)
+
+	_, err = ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("test"),
+		Item:      avMap,
+	})
+	assert.NoError(t, err)
+}
+
+func queryTestItem(t *testing.T, ddb *DynamoDB, id string) *testItem {
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key("id").Equal(expression.Value(id)),
+	).Build()
+	assert.NoError(t, err)
+
+	out, err := ddb.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:                 aws.String("test"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	assert.NoError(t, err)
+
+	if len(out.Items) == 0 {
+		return nil
+	}
+	it := new(testItem)
+	assert.NoError(t, attributevalue.UnmarshalMap(out.Items[0], it))
+	return it
+}
+
+func Test_PutItem_Condition(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.AttributeNotExists(expression.Name("id")),
+	).Build()
+	assert.NoError(t, err)
+
+	avMap, err := attributevalue.MarshalMap(testItem{Id: "100", Name: "first"})
+	assert.NoError(t, err)
+
+	input := &dynamodb.PutItemInput{
+		TableName:                aws.String("test"),
+		Item:                     avMap,
+		ConditionExpression:      expr.Condition(),
+		ExpressionAttributeNames: expr.Names(),
+	}
+
+	_, err = ddb.PutItem(context.TODO(), input)
+	assert.NoError(t, err)
+
+	_, err = ddb.PutItem(context.TODO(), input)
+	var ccfe *types.ConditionalCheckFailedException
+	assert.True(t, errors.As(err, &ccfe))
+
+	assert.Equal(t, &testItem{Id: "100", Name: "first"}, queryTestItem(t, ddb, "100"))
+	assert.Nil(t, queryTestItem(t, ddb, "200"))
+}
+
+func Test_UpdateItem_SetWithCondition(t *testing.T) {
+	subtests := []struct {
+		name          string
+		qty           int64
+		expectedStock int64
+		expectedErr   bool
+	}{
+		{
+			name:          "enough_stock",
+			qty:           3,
+			expectedStock: 7,
+		},
+		{
+			name:          "insufficient_stock",
+			qty:           11,
+			expectedStock: 10,
+			expectedErr:   true,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			ddb := NewDynamoDB()
+			ddb.CreateTable("test", "id", "")
+			putTestItem(t, ddb, testItem{Id: "100", Name: "first", Stock: 10})
+
+			expr, err := expression.NewBuilder().WithUpdate(
+				expression.
+					Set(expression.Name("stock"), expression.Name("stock").Minus(expression.Value(st.qty))).
+					Set(expression.Name("name"), expression.Value("renamed")),
+			).WithCondition(
+				expression.Name("stock").GreaterThanEqual(expression.Value(st.qty)),
+			).Build()
+			assert.NoError(t, err)
+
+			out, err := ddb.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+				TableName:                 aws.String("test"),
+				Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "100"}},
+				UpdateExpression:          expr.Update(),
+				ConditionExpression:       expr.Condition(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ReturnValues:              types.ReturnValueAllNew,
+			})
+
+			it := queryTestItem(t, ddb, "100")
+			assert.Equal(t, st.expectedStock, it.Stock)
+
+			if st.expectedErr {
+				var ccfe *types.ConditionalCheckFailedException
+				assert.True(t, errors.As(err, &ccfe))
+				assert.Equal(t, "first", it.Name)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "renamed", it.Name)
+			assert.Equal(t, &types.AttributeValueMemberN{Value: "7"}, out.Attributes["stock"])
+		})
+	}
+}
+
+func Test_UpdateItem_AddAndRemove(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+	putTestItem(t, ddb, testItem{Id: "100", Name: "first", Stock: 10})
+
+	expr, err := expression.NewBuilder().WithUpdate(
+		expression.
+			Add(expression.Name("reserved"), expression.Value(2)).
+			Remove(expression.Name("name")),
+	).Build()
+	assert.NoError(t, err)
+
+	out, err := ddb.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("test"),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "100"}},
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, out.Attributes["reserved"])
+	assert.NotContains(t, out.Attributes, "name")
+}
+
+func Test_TransactWriteItems_AllOrNothing(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+	putTestItem(t, ddb, testItem{Id: "100", Name: "first", Stock: 1})
+
+	notExists, err := expression.NewBuilder().WithCondition(
+		expression.AttributeNotExists(expression.Name("id")),
+	).Build()
+	assert.NoError(t, err)
+
+	newItem, err := attributevalue.MarshalMap(testItem{Id: "200", Name: "second"})
+	assert.NoError(t, err)
+	dupItem, err := attributevalue.MarshalMap(testItem{Id: "100", Name: "duplicated"})
+	assert.NoError(t, err)
+
+	_, err = ddb.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:                aws.String("test"),
+					Item:                     newItem,
+					ConditionExpression:      notExists.Condition(),
+					ExpressionAttributeNames: notExists.Names(),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:                aws.String("test"),
+					Item:                     dupItem,
+					ConditionExpression:      notExists.Condition(),
+					ExpressionAttributeNames: notExists.Names(),
+				},
+			},
+		},
+	})
+
+	var tce *types.TransactionCanceledException
+	assert.True(t, errors.As(err, &tce))
+	assert.Len(t, tce.CancellationReasons, 2)
+	assert.Equal(t, "None", *tce.CancellationReasons[0].Code)
+	assert.Equal(t, "ConditionalCheckFailed", *tce.CancellationReasons[1].Code)
+
+	assert.Nil(t, queryTestItem(t, ddb, "200"))
+	assert.Equal(t, "first", queryTestItem(t, ddb, "100").Name)
+}
+
+func Test_Query_RangeKeyOrderAndPagination(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "version")
+
+	for _, v := range []int{3, 1, 2} {
+		avMap, err := attributevalue.MarshalMap(map[string]interface{}{"id": "100", "version": v})
+		assert.NoError(t, err)
+		_, err = ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: aws.String("test"), Item: avMap})
+		assert.NoError(t, err)
+	}
+
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key("id").Equal(expression.Value("100")).
+			And(expression.Key("version").GreaterThan(expression.Value(1))),
+	).Build()
+	assert.NoError(t, err)
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("test"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(1),
+	}
+
+	versions := []string{}
+	for {
+		out, err := ddb.Query(context.TODO(), input)
+		assert.NoError(t, err)
+		for _, it := range out.Items {
+			versions = append(versions, it["version"].(*types.AttributeValueMemberN).Value)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	assert.Equal(t, []string{"3", "2"}, versions)
+}
+
+func Test_Query_Index(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "tag")
+	ddb.CreateIndex("test", "tag-index", "tag", "id")
+
+	for _, it := range []map[string]interface{}{
+		{"id": "300", "tag": "a"},
+		{"id": "100", "tag": "a"},
+		{"id": "200", "tag": "b"},
+		{"id": "100", "tag": "b"},
+	} {
+		avMap, err := attributevalue.MarshalMap(it)
+		assert.NoError(t, err)
+		_, err = ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: aws.String("test"), Item: avMap})
+		assert.NoError(t, err)
+	}
+
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key("tag").Equal(expression.Value("a")),
+	).Build()
+	assert.NoError(t, err)
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("test"),
+		IndexName:                 aws.String("tag-index"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int32(1),
+	}
+
+	ids := []string{}
+	for {
+		out, err := ddb.Query(context.TODO(), input)
+		assert.NoError(t, err)
+		for _, it := range out.Items {
+			ids = append(ids, it["id"].(*types.AttributeValueMemberS).Value)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		// the key of an index page holds the table key too
+		assert.Len(t, out.LastEvaluatedKey, 2)
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	assert.Equal(t, []string{"100", "300"}, ids)
+
+	input.ConsistentRead = aws.Bool(true)
+	_, err = ddb.Query(context.TODO(), input)
+	assert.Error(t, err)
+
+	input.ConsistentRead, input.IndexName = nil, aws.String("missing")
+	_, err = ddb.Query(context.TODO(), input)
+	assert.Error(t, err)
+}
+
+func Test_GetItem(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+	putTestItem(t, ddb, testItem{Id: "100", Name: "first", Stock: 5})
+
+	out, err := ddb.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:            aws.String("test"),
+		Key:                  map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "100"}},
+		ProjectionExpression: aws.String("id, stock"),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, out.Item, 2)
+	assert.Equal(t, "5", out.Item["stock"].(*types.AttributeValueMemberN).Value)
+
+	out, err = ddb.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("test"),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "200"}},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, out.Item)
+
+	_, err = ddb.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("test"),
+		Key: map[string]types.AttributeValue{
+			"id":   &types.AttributeValueMemberS{Value: "100"},
+			"name": &types.AttributeValueMemberS{Value: "first"},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func Test_BatchGetItem_UnprocessedKeys(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+	putTestItem(t, ddb, testItem{Id: "100", Name: "first"})
+	putTestItem(t, ddb, testItem{Id: "200", Name: "second"})
+	ddb.SetBatchGetLimit(2)
+
+	key := func(id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}}
+	}
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			"test": {Keys: []map[string]types.AttributeValue{key("100"), key("300"), key("200")}},
+		},
+	}
+
+	out, err := ddb.BatchGetItem(context.TODO(), input)
+	assert.NoError(t, err)
+	assert.Len(t, out.Responses["test"], 1)
+	assert.Equal(t, []map[string]types.AttributeValue{key("200")}, out.UnprocessedKeys["test"].Keys)
+
+	out, err = ddb.BatchGetItem(context.TODO(), &dynamodb.BatchGetItemInput{RequestItems: out.UnprocessedKeys})
+	assert.NoError(t, err)
+	assert.Len(t, out.Responses["test"], 1)
+	assert.Empty(t, out.UnprocessedKeys)
+
+	input.RequestItems["test"] = types.KeysAndAttributes{Keys: []map[string]types.AttributeValue{key("100"), key("100")}}
+	_, err = ddb.BatchGetItem(context.TODO(), input)
+	assert.Error(t, err)
+}
+
+func Test_Scan_Filter(t *testing.T) {
+	ddb := NewDynamoDB()
+	ddb.CreateTable("test", "id", "")
+	putTestItem(t, ddb, testItem{Id: "100", Name: "first"})
+	putTestItem(t, ddb, testItem{Id: "sku#VP-001", Name: "lookup"})
+
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.Not(expression.Name("id").BeginsWith("sku#")),
+	).Build()
+	assert.NoError(t, err)
+
+	out, err := ddb.Scan(context.TODO(), &dynamodb.ScanInput{
+		TableName:                 aws.String("test"),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, out.Items, 1)
+	assert.Equal(t, int32(2), out.ScannedCount)
+}
+
+func Test_UnknownTable(t *testing.T) {
+	ddb := NewDynamoDB()
+
+	_, err := ddb.Scan(context.TODO(), &dynamodb.ScanInput{TableName: aws.String("missing")})
+
+	var rnfe *types.ResourceNotFoundException
+	assert.True(t, errors.As(err, &rnfe))
+}
@@ -0,0 +1,1098 @@
+package fake_aws_services
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// item is a DynamoDB item as stored by the fake
+type item = map[string]types.AttributeValue
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName   // #name placeholder
+	tokValue  // :value placeholder
+	tokNumber // list index
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':' || unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '-') {
+				j++
+			}
+			kind := tokIdent
+			if r == '#' {
+				kind = tokName
+			} else if r == ':' {
+				kind = tokValue
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i + 1
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[i:j])})
+			i = j
+		case strings.ContainsRune("<>", r):
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, token{kind: tokPunct, text: string(runes[i : i+2])})
+				i += 2
+				continue
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: string(r)})
+			i++
+		case strings.ContainsRune("()[],.=+-", r):
+			tokens = append(tokens, token{kind: tokPunct, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid character %q in expression %q", r, expr)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// pathElem is either an attribute name or a list index
+type pathElem struct {
+	name  string
+	index int
+	isIdx bool
+}
+
+type path []pathElem
+
+type (
+	condFn    func(it item) (bool, error)
+	operandFn func(it item) (types.AttributeValue, bool, error)
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newParser(expr string, names map[string]string, values map[string]types.AttributeValue) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) expect(s string) error {
+	t := p.next()
+	if t.kind != tokPunct || t.text != s {
+		return fmt.Errorf("expected %q, found %q", s, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parsePath() (path, error) {
+	out := path{}
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, pathElem{name: name})
+
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, pathElem{name: name})
+		case p.isPunct("["):
+			p.next()
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, fmt.Errorf("expected list index, found %q", t.text)
+			}
+			idx, _ := strconv.Atoi(t.text)
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			out = append(out, pathElem{index: idx, isIdx: true})
+		default:
+			return out, nil
+		}
+	}
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokName:
+		name, ok := p.names[t.text]
+		if !ok {
+			return "", fmt.Errorf("an expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		return name, nil
+	case tokIdent:
+		return t.text, nil
+	default:
+		return "", fmt.Errorf("expected attribute name, found %q", t.text)
+	}
+}
+
+func (p *parser) parseValue() (types.AttributeValue, error) {
+	t := p.next()
+	v, ok := p.values[t.text]
+	if !ok {
+		return nil, fmt.Errorf("an expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	return v, nil
+}
+
+// parseOperand parses a path, a value placeholder or size(path)
+func (p *parser) parseOperand() (operandFn, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return func(item) (types.AttributeValue, bool, error) { return v, true, nil }, nil
+	case t.kind == tokIdent && strings.EqualFold(t.text, "size") && p.tokens[p.pos+1].text == "(":
+		p.next()
+		p.next()
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			v, ok := resolve(it, pth)
+			if !ok {
+				return nil, false, nil
+			}
+			n, ok := sizeOf(v)
+			if !ok {
+				return nil, false, nil
+			}
+			return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}, true, nil
+		}, nil
+	default:
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			v, ok := resolve(it, pth)
+			return v, ok, nil
+		}, nil
+	}
+}
+
+func parseCondition(expr string, names map[string]string, values map[string]types.AttributeValue) (condFn, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected token %q in expression %q", t.text, expr)
+	}
+	return cond, nil
+}
+
+func (p *parser) parseOr() (condFn, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condFn, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || !ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (condFn, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			ok, err := inner(it)
+			return !ok, err
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condFn, error) {
+	if p.isPunct("(") {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent && p.tokens[p.pos+1].text == "(" && !strings.EqualFold(t.text, "size") {
+		return p.parseFunction()
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, fmt.Errorf("expected AND in BETWEEN, found %q", p.peek().text)
+		}
+		p.next()
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			v, ok, _ := left(it)
+			lv, _, _ := low(it)
+			hv, _, _ := high(it)
+			if !ok {
+				return false, nil
+			}
+			c1, ok1 := compare(v, lv)
+			c2, ok2 := compare(v, hv)
+			return ok1 && ok2 && c1 >= 0 && c2 <= 0, nil
+		}, nil
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		candidates := []operandFn{}
+		for {
+			c, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, c)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			v, ok, _ := left(it)
+			if !ok {
+				return false, nil
+			}
+			for _, c := range candidates {
+				if cv, ok, _ := c(it); ok && equal(v, cv) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}, nil
+	}
+
+	op := p.next()
+	if op.kind != tokPunct || !isComparator(op.text) {
+		return nil, fmt.Errorf("expected comparator, found %q", op.text)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(it item) (bool, error) {
+		lv, lok, _ := left(it)
+		rv, rok, _ := right(it)
+		if !lok || !rok {
+			// comparisons against missing attributes only hold for <>
+			return op.text == "<>" && lok != rok, nil
+		}
+		switch op.text {
+		case "=":
+			return equal(lv, rv), nil
+		case "<>":
+			return !equal(lv, rv), nil
+		}
+		c, ok := compare(lv, rv)
+		if !ok {
+			return false, nil
+		}
+		switch op.text {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}, nil
+}
+
+func isComparator(s string) bool {
+	switch s {
+	case "=", "<>", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseFunction() (condFn, error) {
+	fn := strings.ToLower(p.next().text)
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	switch fn {
+	case "attribute_exists", "attribute_not_exists":
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		exists := fn == "attribute_exists"
+		return func(it item) (bool, error) {
+			_, ok := resolve(it, pth)
+			return ok == exists, nil
+		}, nil
+	case "attribute_type":
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		tv, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		want, _ := tv.(*types.AttributeValueMemberS)
+		return func(it item) (bool, error) {
+			v, ok := resolve(it, pth)
+			return ok && want != nil && typeOf(v) == want.Value, nil
+		}, nil
+	case "begins_with", "contains":
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			v, ok := resolve(it, pth)
+			av, aok, _ := arg(it)
+			if !ok || !aok {
+				return false, nil
+			}
+			if fn == "begins_with" {
+				return beginsWith(v, av), nil
+			}
+			return contains(v, av), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid function name; function: %s", fn)
+	}
+}
+
+// update is a parsed update expression, applied in place to the item
+type update func(it item) error
+
+// action is a single update action. Operands are read from before, the item as it was prior to the
+// update, and writes go to it, as DynamoDB evaluates every action against the original item
+type action func(before, it item) error
+
+func parseUpdate(expr string, names map[string]string, values map[string]types.AttributeValue) (update, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []action{}
+	for p.peek().kind != tokEOF {
+		clause := strings.ToUpper(p.next().text)
+		for {
+			var a action
+			switch clause {
+			case "SET":
+				a, err = p.parseSetAction()
+			case "REMOVE":
+				a, err = p.parseRemoveAction()
+			case "ADD", "DELETE":
+				a, err = p.parseAddDeleteAction(clause == "ADD")
+			default:
+				err = fmt.Errorf("invalid update expression clause: %s", clause)
+			}
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, a)
+
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	return func(it item) error {
+		before := copyItem(it)
+		for _, a := range actions {
+			if err := a(before, it); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (p *parser) parseSetAction() (action, error) {
+	pth, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	var op string
+	var right operandFn
+	if p.isPunct("+") || p.isPunct("-") {
+		op = p.next().text
+		if right, err = p.parseSetOperand(); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(before, it item) error {
+		v, ok, err := left(before)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+		}
+
+		if right != nil {
+			rv, ok, err := right(before)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+			}
+			if v, err = arithmetic(v, rv, op); err != nil {
+				return err
+			}
+		}
+
+		return assign(it, pth, v)
+	}, nil
+}
+
+// parseSetOperand parses the operands allowed on the right hand side of SET,
+// which adds if_not_exists and list_append to the condition operands
+func (p *parser) parseSetOperand() (operandFn, error) {
+	t := p.peek()
+	if t.kind != tokIdent || p.tokens[p.pos+1].text != "(" {
+		return p.parseOperand()
+	}
+
+	fn := strings.ToLower(p.next().text)
+	p.next()
+	switch fn {
+	case "if_not_exists":
+		pth, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			if v, ok := resolve(it, pth); ok {
+				return v, true, nil
+			}
+			return fallback(it)
+		}, nil
+	case "list_append":
+		first, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		second, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			a, aok, _ := first(it)
+			b, bok, _ := second(it)
+			al, ok1 := a.(*types.AttributeValueMemberL)
+			bl, ok2 := b.(*types.AttributeValueMemberL)
+			if !aok || !bok || !ok1 || !ok2 {
+				return nil, false, fmt.Errorf("incorrect operand type for operator or function; operator or function: list_append")
+			}
+			out := append(append([]types.AttributeValue{}, al.Value...), bl.Value...)
+			return &types.AttributeValueMemberL{Value: out}, true, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid function name; function: %s", fn)
+	}
+}
+
+func (p *parser) parseRemoveAction() (action, error) {
+	pth, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return func(_, it item) error {
+		remove(it, pth)
+		return nil
+	}, nil
+}
+
+func (p *parser) parseAddDeleteAction(add bool) (action, error) {
+	pth, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	operand, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(before, it item) error {
+		cur, exists := resolve(before, pth)
+
+		if !add {
+			if !exists {
+				return nil
+			}
+			v, err := setDifference(cur, operand)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				remove(it, pth)
+				return nil
+			}
+			return assign(it, pth, v)
+		}
+
+		if !exists {
+			return assign(it, pth, operand)
+		}
+		if _, ok := operand.(*types.AttributeValueMemberN); ok {
+			v, err := arithmetic(cur, operand, "+")
+			if err != nil {
+				return err
+			}
+			return assign(it, pth, v)
+		}
+		v, err := setUnion(cur, operand)
+		if err != nil {
+			return err
+		}
+		return assign(it, pth, v)
+	}, nil
+}
+
+func arithmetic(a, b types.AttributeValue, op string) (types.AttributeValue, error) {
+	an, ok1 := a.(*types.AttributeValueMemberN)
+	bn, ok2 := b.(*types.AttributeValueMemberN)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	x, ok1 := parseNumber(an.Value)
+	y, ok2 := parseNumber(bn.Value)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("invalid number in update expression")
+	}
+	if op == "-" {
+		return &types.AttributeValueMemberN{Value: formatNumber(new(big.Rat).Sub(x, y))}, nil
+	}
+	return &types.AttributeValueMemberN{Value: formatNumber(new(big.Rat).Add(x, y))}, nil
+}
+
+func setUnion(cur, operand types.AttributeValue) (types.AttributeValue, error) {
+	switch c := cur.(type) {
+	case *types.AttributeValueMemberSS:
+		o, ok := operand.(*types.AttributeValueMemberSS)
+		if ok {
+			return &types.AttributeValueMemberSS{Value: union(c.Value, o.Value)}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		o, ok := operand.(*types.AttributeValueMemberNS)
+		if ok {
+			return &types.AttributeValueMemberNS{Value: union(normalizeNumbers(c.Value), normalizeNumbers(o.Value))}, nil
+		}
+	}
+	return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+}
+
+// setDifference returns nil when every element was removed, as DynamoDB drops empty sets
+func setDifference(cur, operand types.AttributeValue) (types.AttributeValue, error) {
+	switch c := cur.(type) {
+	case *types.AttributeValueMemberSS:
+		o, ok := operand.(*types.AttributeValueMemberSS)
+		if ok {
+			if out := difference(c.Value, o.Value); len(out) > 0 {
+				return &types.AttributeValueMemberSS{Value: out}, nil
+			}
+			return nil, nil
+		}
+	case *types.AttributeValueMemberNS:
+		o, ok := operand.(*types.AttributeValueMemberNS)
+		if ok {
+			if out := difference(normalizeNumbers(c.Value), normalizeNumbers(o.Value)); len(out) > 0 {
+				return &types.AttributeValueMemberNS{Value: out}, nil
+			}
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, v := range b {
+		if !sameSetContains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func difference(a, b []string) []string {
+	out := []string{}
+	for _, v := range a {
+		if !sameSetContains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// assign sets the value at pth, which must have an existing parent
+func assign(it item, pth path, v types.AttributeValue) error {
+	parent, last, ok := parentOf(it, pth)
+	if !ok {
+		return fmt.Errorf("the document path provided in the update expression is invalid for update")
+	}
+	switch p := parent.(type) {
+	case *types.AttributeValueMemberM:
+		p.Value[last.name] = v
+	case *types.AttributeValueMemberL:
+		if last.index < len(p.Value) {
+			p.Value[last.index] = v
+		} else {
+			p.Value = append(p.Value, v)
+		}
+	}
+	return nil
+}
+
+func remove(it item, pth path) {
+	parent, last, ok := parentOf(it, pth)
+	if !ok {
+		return
+	}
+	switch p := parent.(type) {
+	case *types.AttributeValueMemberM:
+		delete(p.Value, last.name)
+	case *types.AttributeValueMemberL:
+		if last.index < len(p.Value) {
+			p.Value = append(p.Value[:last.index], p.Value[last.index+1:]...)
+		}
+	}
+}
+
+func parentOf(it item, pth path) (types.AttributeValue, pathElem, bool) {
+	last := pth[len(pth)-1]
+	parent, ok := resolve(it, pth[:len(pth)-1])
+	if !ok {
+		return nil, last, false
+	}
+	switch parent.(type) {
+	case *types.AttributeValueMemberM:
+		return parent, last, !last.isIdx
+	case *types.AttributeValueMemberL:
+		return parent, last, last.isIdx
+	}
+	return nil, last, false
+}
+
+func resolve(it item, pth path) (types.AttributeValue, bool) {
+	var cur types.AttributeValue = &types.AttributeValueMemberM{Value: it}
+	for _, e := range pth {
+		switch v := cur.(type) {
+		case *types.AttributeValueMemberM:
+			if e.isIdx {
+				return nil, false
+			}
+			next, ok := v.Value[e.name]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case *types.AttributeValueMemberL:
+			if !e.isIdx || e.index >= len(v.Value) {
+				return nil, false
+			}
+			cur = v.Value[e.index]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func sizeOf(v types.AttributeValue) (int, bool) {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberB:
+		return len(v.Value), true
+	case *types.AttributeValueMemberL:
+		return len(v.Value), true
+	case *types.AttributeValueMemberM:
+		return len(v.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(v.Value), true
+	}
+	return 0, false
+}
+
+func typeOf(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	}
+	return ""
+}
+
+func parseNumber(s string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(s)
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	return strings.TrimRight(strings.TrimRight(r.FloatString(38), "0"), ".")
+}
+
+// compare orders two scalar values of the same type
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av.Value, bv.Value), true
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		an, ok1 := parseNumber(av.Value)
+		bn, ok2 := parseNumber(bv.Value)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return an.Cmp(bn), true
+	case *types.AttributeValueMemberB:
+		bv, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(av.Value, bv.Value), true
+	}
+	return 0, false
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if typeOf(a) != typeOf(b) {
+		return false
+	}
+
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		c, ok := compare(a, b)
+		return ok && c == 0
+	case *types.AttributeValueMemberBOOL:
+		return av.Value == b.(*types.AttributeValueMemberBOOL).Value
+	case *types.AttributeValueMemberNULL:
+		return true
+	case *types.AttributeValueMemberL:
+		bv := b.(*types.AttributeValueMemberL)
+		if len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for i := range av.Value {
+			if !equal(av.Value[i], bv.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		bv := b.(*types.AttributeValueMemberM)
+		if len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for k, v := range av.Value {
+			other, ok := bv.Value[k]
+			if !ok || !equal(v, other) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberSS:
+		return sameSet(av.Value, b.(*types.AttributeValueMemberSS).Value)
+	case *types.AttributeValueMemberNS:
+		return sameSet(normalizeNumbers(av.Value), normalizeNumbers(b.(*types.AttributeValueMemberNS).Value))
+	case *types.AttributeValueMemberBS:
+		as := make([]string, 0, len(av.Value))
+		for _, v := range av.Value {
+			as = append(as, string(v))
+		}
+		bs := make([]string, 0, len(av.Value))
+		for _, v := range b.(*types.AttributeValueMemberBS).Value {
+			bs = append(bs, string(v))
+		}
+		return sameSet(as, bs)
+	}
+	return false
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeNumbers(ns []string) []string {
+	out := make([]string, 0, len(ns))
+	for _, n := range ns {
+		if r, ok := parseNumber(n); ok {
+			n = formatNumber(r)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func beginsWith(v, prefix types.AttributeValue) bool {
+	switch vv := v.(type) {
+	case *types.AttributeValueMemberS:
+		p, ok := prefix.(*types.AttributeValueMemberS)
+		return ok && strings.HasPrefix(vv.Value, p.Value)
+	case *types.AttributeValueMemberB:
+		p, ok := prefix.(*types.AttributeValueMemberB)
+		return ok && bytes.HasPrefix(vv.Value, p.Value)
+	}
+	return false
+}
+
+func contains(v, operand types.AttributeValue) bool {
+	switch vv := v.(type) {
+	case *types.AttributeValueMemberS:
+		o, ok := operand.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(vv.Value, o.Value)
+	case *types.AttributeValueMemberB:
+		o, ok := operand.(*types.AttributeValueMemberB)
+		return ok && bytes.Contains(vv.Value, o.Value)
+	case *types.AttributeValueMemberL:
+		for _, e := range vv.Value {
+			if equal(e, operand) {
+				return true
+			}
+		}
+	case *types.AttributeValueMemberSS:
+		o, ok := operand.(*types.AttributeValueMemberS)
+		return ok && sameSetContains(vv.Value, o.Value)
+	case *types.AttributeValueMemberNS:
+		o, ok := operand.(*types.AttributeValueMemberN)
+		return ok && sameSetContains(normalizeNumbers(vv.Value), normalizeNumbers([]string{o.Value})[0])
+	}
+	return false
+}
+
+func sameSetContains(set []string, v string) bool {
+	for _, e := range set {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package fake_aws_services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 is an in-memory S3ClientAPI and S3PresignAPI. Presigned requests carry no signature, but sign the same
+// headers as the SDK does, so tests can check the constraints an upload is held to
+type S3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]object
+}
+
+type object struct {
+	body        []byte
+	contentType string
+	metadata    map[string]string
+}
+
+var (
+	_ aws_services.S3ClientAPI  = (*S3)(nil)
+	_ aws_services.S3PresignAPI = (*S3)(nil)
+)
+
+func NewS3() *S3 {
+	return &S3{buckets: map[string]map[string]object{}}
+}
+
+func (s *S3) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets[name] = map[string]object{}
+}
+
+// Keys lists the keys stored in a bucket, in no particular order
+func (s *S3) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *S3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[aws.ToString(params.Bucket)]
+	if !ok {
+		return nil, &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	obj, ok := bucket[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.body)),
+		ContentLength: int64(len(obj.body)),
+		ContentType:   aws.String(obj.contentType),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+func (s *S3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	var body []byte
+	if params.Body != nil {
+		var err error
+		if body, err = io.ReadAll(params.Body); err != nil {
+			return nil, fmt.Errorf("error reading body: %w", err)
+		}
+	}
+	if params.ContentLength > 0 && params.ContentLength != int64(len(body)) {
+		return nil, fmt.Errorf("content length %d does not match a body of %d bytes", params.ContentLength, len(body))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[aws.ToString(params.Bucket)]
+	if !ok {
+		return nil, &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	bucket[aws.ToString(params.Key)] = object{
+		body:        body,
+		contentType: aws.ToString(params.ContentType),
+		metadata:    params.Metadata,
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// PresignPutObject returns a virtual-hosted style URL of the object, expiring after PresignOptions.Expires
+func (s *S3) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	opts := s3.PresignOptions{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	if opts.Expires == 0 {
+		opts.Expires = 900 * time.Second
+	}
+
+	host := aws.ToString(params.Bucket) + ".s3.amazonaws.com"
+	u := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     "/" + aws.ToString(params.Key),
+		RawQuery: url.Values{"X-Amz-Expires": {strconv.Itoa(int(opts.Expires.Seconds()))}}.Encode(),
+	}
+
+	header := http.Header{"Host": {host}}
+	if params.ContentType != nil {
+		header.Set("Content-Type", *params.ContentType)
+	}
+	if params.ContentLength > 0 {
+		header.Set("Content-Length", strconv.FormatInt(params.ContentLength, 10))
+	}
+
+	return &v4.PresignedHTTPRequest{
+		URL:          u.String(),
+		Method:       http.MethodPut,
+		SignedHeader: header,
+	}, nil
+}
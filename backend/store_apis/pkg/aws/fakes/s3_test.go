@@ -0,0 +1,75 @@
+package fake_aws_services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_S3_PutAndGetObject(t *testing.T) {
+	fake := NewS3()
+	fake.CreateBucket("test")
+
+	_, err := fake.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:      aws.String("test"),
+		Key:         aws.String("a/b.png"),
+		Body:        strings.NewReader("png"),
+		ContentType: aws.String("image/png"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/b.png"}, fake.Keys("test"))
+
+	out, err := fake.GetObject(context.TODO(), &s3.GetObjectInput{Bucket: aws.String("test"), Key: aws.String("a/b.png")})
+	assert.NoError(t, err)
+	body, err := io.ReadAll(out.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", string(body))
+	assert.Equal(t, "image/png", aws.ToString(out.ContentType))
+	assert.Equal(t, int64(3), out.ContentLength)
+
+	_, err = fake.GetObject(context.TODO(), &s3.GetObjectInput{Bucket: aws.String("test"), Key: aws.String("other")})
+	var nsk *types.NoSuchKey
+	assert.True(t, errors.As(err, &nsk))
+
+	_, err = fake.PutObject(context.TODO(), &s3.PutObjectInput{Bucket: aws.String("other"), Key: aws.String("a")})
+	var nsb *types.NoSuchBucket
+	assert.True(t, errors.As(err, &nsb))
+
+	_, err = fake.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        aws.String("test"),
+		Key:           aws.String("a/c.png"),
+		Body:          strings.NewReader("png"),
+		ContentLength: 4,
+	})
+	assert.Error(t, err)
+}
+
+func Test_S3_PresignPutObject(t *testing.T) {
+	fake := NewS3()
+
+	req, err := fake.PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        aws.String("test"),
+		Key:           aws.String("a/b.png"),
+		ContentType:   aws.String("image/png"),
+		ContentLength: 1024,
+	}, s3.WithPresignExpires(5*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "PUT", req.Method)
+	assert.Equal(t, "image/png", req.SignedHeader.Get("Content-Type"))
+	assert.Equal(t, "1024", req.SignedHeader.Get("Content-Length"))
+
+	u, err := url.Parse(req.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "test.s3.amazonaws.com", u.Host)
+	assert.Equal(t, "/a/b.png", u.Path)
+	assert.Equal(t, "300", u.Query().Get("X-Amz-Expires"))
+}
@@ -0,0 +1,553 @@
+package baskets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/orders"
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gopkg.in/validator.v2"
+)
+
+var errConcurrentUpdate = errors.New("basket was modified concurrently")
+
+// maxLineItems is the most lines a basket holds, as many as a single checkout can take the stock of along
+// with putting the order and deleting the basket
+var maxLineItems = products.MaxStockChanges(2)
+
+// Basket is the priced view of a basket, recomputed from current product prices on every read. The total
+// is in the currency shared by the available lines, and left empty when a product changed currency since
+// it was added, as totals in different currencies do not add up
+type Basket struct {
+	Id        string       `json:"id"`
+	LineItems []BasketLine `json:"lineItems"`
+	Total     int64        `json:"total"`
+	Currency  string       `json:"currency"`
+	ExpiresAt int64        `json:"expiresAt"`
+}
+
+type BasketLine struct {
+	ProductId string `json:"productId"`
+	VariantId string `json:"variantId,omitempty"`
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	UnitPrice int64  `json:"unitPrice"`
+	Currency  string `json:"currency"`
+	Total     int64  `json:"total"`
+	Available bool   `json:"available"` // false once the product, or variant, no longer exists
+}
+
+// LineItem adds a product to a basket, or one of its variants when VariantId is set. Lines of the same
+// product and variant add up
+type LineItem struct {
+	ProductId string `json:"productId" validate:"nonzero"`
+	VariantId string `json:"variantId"`
+	Quantity  int64  `json:"quantity" validate:"min=1"`
+}
+
+type QuantityUpdate struct {
+	Quantity int64 `json:"quantity" validate:"min=1"`
+}
+
+type Item struct {
+	Id           string     `dynamodbav:"id"` // basket or customer id
+	DateModified int64      `dynamodbav:"dateModified"`
+	ExpiresAt    int64      `dynamodbav:"expiresAt"` // DynamoDB TTL attribute, in epoch seconds
+	Version      int64      `dynamodbav:"version"`
+	LineItems    []ItemLine `dynamodbav:"lineItems"`
+}
+
+type ItemLine struct {
+	ProductId string `dynamodbav:"productId"`
+	VariantId string `dynamodbav:"variantId,omitempty"`
+	Quantity  int64  `dynamodbav:"quantity"`
+}
+
+func (i *Item) findLine(productId, variantId string) int {
+	for idx, line := range i.LineItems {
+		if line.ProductId == productId && line.VariantId == variantId {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Service is the IBasket serving the baskets API from the baskets table, checking baskets out into orders.
+// Products are looked up, and their stock taken, through the products service
+type Service struct {
+	cfg      *config.Cfg
+	awsSvc   *aws_services.AWS
+	products products.IProduct
+}
+
+func NewService(cfg *config.Cfg, awsSvc *aws_services.AWS, products products.IProduct) *Service {
+	return &Service{cfg: cfg, awsSvc: awsSvc, products: products}
+}
+
+var _ IBasket = (*Service)(nil)
+
+func (s *Service) readBasket(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reading basket", http.StatusNotFound))
+	}
+
+	if item == nil {
+		msj := fmt.Sprintf("no basket found with id: %v", id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return s.sendBasket(ctx, item)
+}
+
+func (s *Service) clearBasket(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	deleteInput := &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.cfg.BasketsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	}
+	_, err := s.awsSvc.DDBClient.DeleteItem(ctx, deleteInput)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, fmt.Sprintf("error deleting basket with id: %v", id), http.StatusNotFound))
+	}
+
+	return utils.SendNoContent(fmt.Sprintf("basket with id: %v, was successfully cleared", id))
+}
+
+func (s *Service) addItem(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	lineItem := new(LineItem)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(lineItem); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if err := validator.WithPrintJSON(true).Validate(lineItem); err != nil {
+		msj := "error line item validation"
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: fmt.Sprintf("%v: %v", msj, err),
+			Errors:     utils.ValidationErrors(err),
+		})
+	}
+
+	productItems, missing, err := s.findProducts(ctx, []ItemLine{{ProductId: lineItem.ProductId, VariantId: lineItem.VariantId}})
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error looking up products", http.StatusNotFound))
+	}
+
+	if len(missing) > 0 {
+		msj := fmt.Sprintf("product not found: %v", lineItem.ProductId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if _, ok := productItems[lineItem.ProductId].Variant(lineItem.VariantId); len(lineItem.VariantId) > 0 && !ok {
+		msj := fmt.Sprintf("variant not found: %v, of product %v", lineItem.VariantId, lineItem.ProductId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reading basket", http.StatusNotFound))
+	}
+
+	if item == nil {
+		item = &Item{Id: id, LineItems: []ItemLine{}}
+	}
+
+	if idx := item.findLine(lineItem.ProductId, lineItem.VariantId); idx >= 0 {
+		item.LineItems[idx].Quantity += lineItem.Quantity
+	} else if len(item.LineItems) >= maxLineItems {
+		msj := fmt.Sprintf("basket with id: %v cannot hold more than %d line items", id, maxLineItems)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	} else {
+		item.LineItems = append(item.LineItems, ItemLine{
+			ProductId: lineItem.ProductId,
+			VariantId: lineItem.VariantId,
+			Quantity:  lineItem.Quantity,
+		})
+	}
+
+	basket, err := s.View(ctx, item)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error pricing basket", http.StatusNotFound))
+	}
+	if _, ok := currencyOf(basket.LineItems); !ok {
+		msj := fmt.Sprintf("%v: product %v cannot be added to basket with id: %v", orders.ErrMixedCurrencies, lineItem.ProductId, id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return s.saveAndSendBasket(ctx, item)
+}
+
+// changeItemQuantity sets the quantity of the line of the product, or of its variant given by the variantId
+// query string parameter
+func (s *Service) changeItemQuantity(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	productId := request.PathParameters["productId"]
+	variantId := request.QueryStringParameters["variantId"]
+	if len(id) == 0 || len(productId) == 0 {
+		msj := fmt.Sprint("empty id or productId on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	update := new(QuantityUpdate)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(update); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if err := validator.WithPrintJSON(true).Validate(update); err != nil {
+		msj := "error quantity validation"
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: fmt.Sprintf("%v: %v", msj, err),
+			Errors:     utils.ValidationErrors(err),
+		})
+	}
+
+	_, missing, err := s.findProducts(ctx, []ItemLine{{ProductId: productId}})
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error looking up products", http.StatusNotFound))
+	}
+
+	if len(missing) > 0 {
+		msj := fmt.Sprintf("product not found: %v", productId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reading basket", http.StatusNotFound))
+	}
+
+	idx := -1
+	if item != nil {
+		idx = item.findLine(productId, variantId)
+	}
+	if idx < 0 {
+		msj := fmt.Sprintf("product %v not found in basket with id: %v", productId, id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item.LineItems[idx].Quantity = update.Quantity
+
+	return s.saveAndSendBasket(ctx, item)
+}
+
+// removeItem removes the line of the product, or of its variant given by the variantId query string parameter
+func (s *Service) removeItem(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	productId := request.PathParameters["productId"]
+	variantId := request.QueryStringParameters["variantId"]
+	if len(id) == 0 || len(productId) == 0 {
+		msj := fmt.Sprint("empty id or productId on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reading basket", http.StatusNotFound))
+	}
+
+	idx := -1
+	if item != nil {
+		idx = item.findLine(productId, variantId)
+	}
+	if idx < 0 {
+		msj := fmt.Sprintf("product %v not found in basket with id: %v", productId, id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item.LineItems = append(item.LineItems[:idx], item.LineItems[idx+1:]...)
+
+	return s.saveAndSendBasket(ctx, item)
+}
+
+// GetItem fetches a basket by id. Returns nil when the basket does not exist or has already expired
+func GetItem(ctx context.Context, cfg *config.Cfg, awsSvc *aws_services.AWS, id string) (*Item, error) {
+	getOutput, err := awsSvc.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(cfg.BasketsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting item: %w", err)
+	}
+
+	if len(getOutput.Item) == 0 {
+		return nil, nil
+	}
+
+	item := new(Item)
+	if err := attributevalue.UnmarshalMap(getOutput.Item, item); err != nil {
+		return nil, fmt.Errorf("error unmarshalling get output: %v", err)
+	}
+
+	// TTL deletion is eventually consistent, so expired baskets can still be returned for a while
+	if item.ExpiresAt <= time.Now().UTC().Unix() {
+		return nil, nil
+	}
+
+	return item, nil
+}
+
+// putItem writes the basket, refreshing its expiry, as long as nobody else wrote it since it was read.
+// A new basket replaces an expired one TTL has not deleted yet, as GetItem reads those as missing
+func putItem(ctx context.Context, cfg *config.Cfg, awsSvc *aws_services.AWS, item *Item) error {
+	now := time.Now().UTC()
+
+	cond := expression.AttributeNotExists(expression.Name("id")).Or(
+		expression.Name("expiresAt").LessThanEqual(expression.Value(now.Unix())),
+	)
+	if item.Version > 0 {
+		cond = expression.Name("version").Equal(expression.Value(item.Version))
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	item.DateModified = now.Unix()
+	item.ExpiresAt = now.Add(cfg.BasketTTL).Unix()
+	item.Version++
+
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	_, err = awsSvc.DDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(cfg.BasketsTable),
+		Item:                      avMap,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+	})
+	if err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfe) {
+			return errConcurrentUpdate
+		}
+		return fmt.Errorf("error putting item: %w", err)
+	}
+
+	return nil
+}
+
+// View prices the basket with the current product, and variant, prices
+func (s *Service) View(ctx context.Context, item *Item) (*Basket, error) {
+	productItems, _, err := s.findProducts(ctx, item.LineItems)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up products: %w", err)
+	}
+
+	basket := &Basket{
+		Id:        item.Id,
+		LineItems: make([]BasketLine, 0, len(item.LineItems)),
+		ExpiresAt: item.ExpiresAt,
+	}
+
+	for _, line := range item.LineItems {
+		basketLine := BasketLine{
+			ProductId: line.ProductId,
+			VariantId: line.VariantId,
+			Quantity:  line.Quantity,
+		}
+
+		p, ok := productItems[line.ProductId]
+		var variant *products.VariantItem
+		if ok && len(line.VariantId) > 0 {
+			variant, ok = p.Variant(line.VariantId)
+		}
+		if ok {
+			basketLine.Name = p.Name
+			basketLine.UnitPrice = p.PriceOf(variant)
+			basketLine.Currency = p.Currency
+			basketLine.Total = basketLine.UnitPrice * line.Quantity
+			basketLine.Available = true
+		}
+
+		basket.LineItems = append(basket.LineItems, basketLine)
+	}
+
+	if currency, ok := currencyOf(basket.LineItems); ok {
+		basket.Currency = currency
+		for _, line := range basket.LineItems {
+			basket.Total += line.Total
+		}
+	}
+
+	return basket, nil
+}
+
+// findProducts reads the products of the basket lines, with the variants of the lines holding one, returning
+// the ones found by id and the ids missing
+func (s *Service) findProducts(ctx context.Context, lines []ItemLine) (map[string]*products.Item, []string, error) {
+	return orders.FindProducts(ctx, s.products, lineItemsOf(lines))
+}
+
+func lineItemsOf(lines []ItemLine) []orders.LineItem {
+	lineItems := make([]orders.LineItem, 0, len(lines))
+	for _, line := range lines {
+		lineItems = append(lineItems, orders.LineItem{
+			ProductId: line.ProductId,
+			VariantId: line.VariantId,
+			Quantity:  line.Quantity,
+		})
+	}
+	return lineItems
+}
+
+// currencyOf returns the currency the available lines are priced in, and false when they are priced in
+// more than one
+func currencyOf(lines []BasketLine) (string, bool) {
+	currency, found := "", false
+	for _, line := range lines {
+		if !line.Available {
+			continue
+		}
+		if found && line.Currency != currency {
+			return "", false
+		}
+		currency, found = line.Currency, true
+	}
+	return currency, true
+}
+
+func (s *Service) saveAndSendBasket(ctx context.Context, item *Item) (events.APIGatewayProxyResponse, error) {
+	err := putItem(ctx, s.cfg, s.awsSvc, item)
+	if errors.Is(err, errConcurrentUpdate) {
+		msj := fmt.Sprintf("%v, id: %v", err.Error(), item.Id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error saving basket", http.StatusConflict))
+	}
+
+	return s.sendBasket(ctx, item)
+}
+
+func (s *Service) sendBasket(ctx context.Context, item *Item) (events.APIGatewayProxyResponse, error) {
+	basket, err := s.View(ctx, item)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error pricing basket", http.StatusNotFound))
+	}
+
+	out, err := json.Marshal(basket)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling basket: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusOK,
+		Data:       string(out),
+		LogMessage: string(out),
+	})
+}
@@ -0,0 +1,536 @@
+package baskets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	mock_aws_services "store_apis/pkg/aws/mocks"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_AddItem_ReturnOK(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"content-type": "application/json"},
+		Resource:       "/baskets/{id}/items",
+		Path:           "/baskets/customer-1/items",
+		HTTPMethod:     http.MethodPost,
+		PathParameters: map[string]string{"id": "customer-1"},
+		Body:           `{"productId": "100", "quantity": 2}`,
+	}
+
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "products")
+	os.Setenv("BASKETS_TABLE", "baskets")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+	expiresAt := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	mockDdbClient.
+		EXPECT().
+		BatchGetItem(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]types.AttributeValue{
+				"products": {
+					{
+						"id":    &types.AttributeValueMemberS{Value: "100"},
+						"name":  &types.AttributeValueMemberS{Value: "valid product"},
+						"price": &types.AttributeValueMemberN{Value: "250"},
+					},
+				},
+			},
+		}, nil).
+		AnyTimes()
+
+	mockDdbClient.
+		EXPECT().
+		GetItem(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.GetItemOutput{
+			Item: map[string]types.AttributeValue{
+				"id":        &types.AttributeValueMemberS{Value: "customer-1"},
+				"version":   &types.AttributeValueMemberN{Value: "3"},
+				"expiresAt": &types.AttributeValueMemberN{Value: expiresAt},
+				"lineItems": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+						"productId": &types.AttributeValueMemberS{Value: "100"},
+						"quantity":  &types.AttributeValueMemberN{Value: "1"},
+					}},
+				}},
+			},
+		}, nil).
+		AnyTimes()
+
+	mockDdbClient.
+		EXPECT().
+		PutItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			item := new(Item)
+			assert.NoError(t, attributevalue.UnmarshalMap(in.Item, item))
+			assert.Equal(t, int64(4), item.Version)
+			assert.Equal(t, int64(3), item.LineItems[0].Quantity)
+			assert.Greater(t, item.ExpiresAt, time.Now().Unix())
+			assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, in.ExpressionAttributeValues[":0"])
+			return &dynamodb.PutItemOutput{}, nil
+		})
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: mockDdbClient,
+	}
+
+	resp, err := newService(cfg, awsSvc).addItem(context.TODO(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	basket := new(Basket)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), basket))
+	assert.Equal(t, int64(750), basket.Total)
+	assert.True(t, basket.LineItems[0].Available)
+}
+
+func Test_AddItem_ReturnError(t *testing.T) {
+	subtests := []struct {
+		name          string
+		body          string
+		expected      int
+		expectedError string
+	}{
+		{
+			name:          "invalid_quantity",
+			body:          `{"productId": "100", "quantity": 0}`,
+			expected:      http.StatusBadRequest,
+			expectedError: "error line item validation",
+		},
+		{
+			name:          "product_not_found",
+			body:          `{"productId": "404", "quantity": 1}`,
+			expected:      http.StatusBadRequest,
+			expectedError: "product not found: 404",
+		},
+	}
+
+	cfg := new(config.Cfg)
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				Resource:       "/baskets/{id}/items",
+				Path:           "/baskets/customer-1/items",
+				HTTPMethod:     http.MethodPost,
+				PathParameters: map[string]string{"id": "customer-1"},
+				Body:           st.body,
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+			mockDdbClient.
+				EXPECT().
+				GetItem(gomock.Any(), gomock.Any()).
+				Return(&dynamodb.GetItemOutput{}, nil).
+				AnyTimes() // expects zero or more calls
+			mockDdbClient.
+				EXPECT().
+				BatchGetItem(gomock.Any(), gomock.Any()).
+				Return(&dynamodb.BatchGetItemOutput{}, nil).
+				AnyTimes()
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mockDdbClient,
+			}
+
+			resp, err := newService(cfg, awsSvc).addItem(context.TODO(), req)
+			assert.NoError(t, err)
+
+			assert.Equal(t, st.expected, resp.StatusCode)
+			assert.Contains(t, resp.Body, st.expectedError)
+		})
+	}
+}
+
+// newService builds the baskets service on a products service sharing its DynamoDB client
+func newService(cfg *config.Cfg, awsSvc *aws_services.AWS) *Service {
+	return NewService(cfg, awsSvc, products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil))
+}
+
+// newFakeAWS sets up the tables of the baskets and the products they hold on a fake DynamoDB
+func newFakeAWS(cfg *config.Cfg) *aws_services.AWS {
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.BasketsTable, "id", "")
+	return &aws_services.AWS{DDBClient: ddb}
+}
+
+func createProduct(t *testing.T, p products.IProduct, sku, currency string) *products.Item {
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       250,
+		Currency:    currency,
+		Sku:         sku,
+	})
+	assert.NoError(t, err)
+	return created
+}
+
+func addItemRequest(productId string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Resource:       "/baskets/{id}/items",
+		Path:           "/baskets/customer-1/items",
+		HTTPMethod:     http.MethodPost,
+		PathParameters: map[string]string{"id": "customer-1"},
+		Body:           `{"productId": "` + productId + `", "quantity": 2}`,
+	}
+}
+
+func Test_AddItem_ExpiredBasket(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit", BasketsTable: "baskets", BasketTTL: time.Hour}
+	awsSvc := newFakeAWS(cfg)
+	created := createProduct(t, products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil), "VP-001", "USD")
+
+	// expired, but not deleted by TTL yet
+	expired, err := attributevalue.MarshalMap(&Item{
+		Id:        "customer-1",
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+		Version:   7,
+		LineItems: []ItemLine{{ProductId: "stale", Quantity: 5}},
+	})
+	assert.NoError(t, err)
+	_, err = awsSvc.DDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: aws.String(cfg.BasketsTable), Item: expired})
+	assert.NoError(t, err)
+
+	resp, err := newService(cfg, awsSvc).addItem(context.TODO(), addItemRequest(created.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	item, err := GetItem(context.TODO(), cfg, awsSvc, "customer-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), item.Version)
+	assert.Equal(t, []ItemLine{{ProductId: created.Id, Quantity: 2}}, item.LineItems)
+
+	// a basket that has not expired is not replaced by a new one
+	item.Version = 0
+	assert.ErrorIs(t, putItem(context.TODO(), cfg, awsSvc, item), errConcurrentUpdate)
+}
+
+func Test_Basket_MixedCurrencies(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit", BasketsTable: "baskets", BasketTTL: time.Hour}
+	awsSvc := newFakeAWS(cfg)
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	usd := createProduct(t, p, "VP-001", "USD")
+	otherUsd := createProduct(t, p, "VP-002", "USD")
+	eur := createProduct(t, p, "VP-003", "EUR")
+
+	b := newService(cfg, awsSvc)
+	for _, id := range []string{usd.Id, otherUsd.Id} {
+		resp, err := b.addItem(context.TODO(), addItemRequest(id))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err := b.addItem(context.TODO(), addItemRequest(eur.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, resp.Body, "line items are priced in different currencies")
+
+	// a product changing currency after it was added leaves the basket without a total, and out of checkout
+	_, err = p.PatchProduct(context.TODO(), otherUsd.Id, products.AnyVersion, map[string]json.RawMessage{"currency": json.RawMessage(`"EUR"`)})
+	assert.NoError(t, err)
+
+	item, err := GetItem(context.TODO(), cfg, awsSvc, "customer-1")
+	assert.NoError(t, err)
+	basket, err := b.View(context.TODO(), item)
+	assert.NoError(t, err)
+	assert.Len(t, basket.LineItems, 2)
+	assert.Empty(t, basket.Currency)
+	assert.Zero(t, basket.Total)
+
+	resp, err = b.checkout(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/baskets/{id}/checkout",
+		Path:           "/baskets/customer-1/checkout",
+		HTTPMethod:     http.MethodPost,
+		PathParameters: map[string]string{"id": "customer-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, resp.Body, "line items are priced in different currencies")
+}
+
+func Test_Checkout(t *testing.T) {
+	subtests := []struct {
+		name          string
+		stock         string
+		txErr         error
+		expected      int
+		expectedError string
+	}{
+		{
+			name:          "order_created",
+			stock:         "5",
+			expected:      http.StatusCreated,
+			expectedError: `"CustomerId":"customer-1"`,
+		},
+		{
+			name:          "insufficient_stock",
+			stock:         "3",
+			expected:      http.StatusConflict,
+			expectedError: "product 200 has 3 units available, not 5",
+		},
+		{
+			name:  "basket_modified",
+			stock: "5",
+			txErr: &types.TransactionCanceledException{
+				Message: aws.String("Transaction cancelled"),
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed")},
+					{Code: aws.String("None")},
+					{Code: aws.String("None")},
+					{Code: aws.String("None")},
+					{Code: aws.String("None")},
+				},
+			},
+			expected:      http.StatusConflict,
+			expectedError: "basket was modified concurrently",
+		},
+	}
+
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "products")
+	os.Setenv("PRODUCTS_AUDIT_TABLE", "products-audit")
+	os.Setenv("ORDERS_TABLE", "orders")
+	os.Setenv("BASKETS_TABLE", "baskets")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	expiresAt := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				Resource:       "/baskets/{id}/checkout",
+				Path:           "/baskets/customer-1/checkout",
+				HTTPMethod:     http.MethodPost,
+				PathParameters: map[string]string{"id": "customer-1"},
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+			mockDdbClient.
+				EXPECT().
+				BatchGetItem(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+					items := []map[string]types.AttributeValue{}
+					for _, key := range in.RequestItems["products"].Keys {
+						items = append(items, map[string]types.AttributeValue{
+							"id":      key["id"],
+							"version": &types.AttributeValueMemberN{Value: "2"},
+							"price":   &types.AttributeValueMemberN{Value: "100"},
+							"stock":   &types.AttributeValueMemberN{Value: st.stock},
+						})
+					}
+					return &dynamodb.BatchGetItemOutput{
+						Responses: map[string][]map[string]types.AttributeValue{"products": items},
+					}, nil
+				}).
+				AnyTimes()
+
+			mockDdbClient.
+				EXPECT().
+				GetItem(gomock.Any(), gomock.Any()).
+				Return(&dynamodb.GetItemOutput{
+					Item: map[string]types.AttributeValue{
+						"id":        &types.AttributeValueMemberS{Value: "customer-1"},
+						"version":   &types.AttributeValueMemberN{Value: "1"},
+						"expiresAt": &types.AttributeValueMemberN{Value: expiresAt},
+						"lineItems": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+							&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+								"productId": &types.AttributeValueMemberS{Value: "100"},
+								"quantity":  &types.AttributeValueMemberN{Value: "1"},
+							}},
+							&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+								"productId": &types.AttributeValueMemberS{Value: "200"},
+								"quantity":  &types.AttributeValueMemberN{Value: "5"},
+							}},
+						}},
+					},
+				}, nil).
+				AnyTimes()
+
+			// the stock is checked before writing, so a checkout short of stock writes nothing
+			mockDdbClient.
+				EXPECT().
+				TransactWriteItems(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					assert.Len(t, in.TransactItems, 6)
+					assert.Equal(t, "orders", *in.TransactItems[0].Put.TableName)
+					assert.Equal(t, "baskets", *in.TransactItems[1].Delete.TableName)
+					assert.Equal(t, "products", *in.TransactItems[2].Update.TableName)
+					assert.Equal(t, "products-audit", *in.TransactItems[3].Put.TableName)
+					assert.Equal(t, "products", *in.TransactItems[4].Update.TableName)
+					assert.Equal(t, "products-audit", *in.TransactItems[5].Put.TableName)
+
+					if st.txErr != nil {
+						return nil, st.txErr
+					}
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				}).
+				AnyTimes()
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mockDdbClient,
+			}
+
+			resp, err := newService(cfg, awsSvc).checkout(context.TODO(), req)
+			assert.NoError(t, err)
+
+			assert.Equal(t, st.expected, resp.StatusCode)
+			assert.Contains(t, resp.Body, st.expectedError)
+		})
+	}
+}
+
+func Test_Checkout_ChangesStockThroughProducts(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit", OrdersTable: "orders", BasketsTable: "baskets", BasketTTL: time.Hour}
+	awsSvc := newFakeAWS(cfg)
+	awsSvc.DDBClient.(*fake_aws_services.DynamoDB).CreateTable(cfg.OrdersTable, "id", "")
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       250,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       5,
+	})
+	assert.NoError(t, err)
+
+	b := NewService(cfg, awsSvc, p)
+	resp, err := b.addItem(context.TODO(), addItemRequest(created.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = b.checkout(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/baskets/{id}/checkout",
+		Path:           "/baskets/customer-1/checkout",
+		HTTPMethod:     http.MethodPost,
+		PathParameters: map[string]string{"id": "customer-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	stored, err := p.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stored.Stock)
+	assert.Equal(t, created.Version+1, stored.Version)
+
+	history, err := p.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, products.ActionCheckout, history.Items[0].Action)
+	assert.Equal(t, products.FieldChange{Before: float64(5), After: float64(3)}, history.Items[0].Diff["stock"])
+
+	// the basket went with the checkout
+	item, err := GetItem(context.TODO(), cfg, awsSvc, "customer-1")
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+}
+
+func Test_AddItem_TooManyProducts(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit", BasketsTable: "baskets", BasketTTL: time.Hour}
+	awsSvc := newFakeAWS(cfg)
+	created := createProduct(t, products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil), "VP-001", "USD")
+
+	lines := make([]ItemLine, 0, maxLineItems)
+	for i := 0; i < maxLineItems; i++ {
+		lines = append(lines, ItemLine{ProductId: strconv.Itoa(i), Quantity: 1})
+	}
+	assert.NoError(t, putItem(context.TODO(), cfg, awsSvc, &Item{Id: "customer-1", LineItems: lines}))
+
+	resp, err := newService(cfg, awsSvc).addItem(context.TODO(), addItemRequest(created.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, resp.Body, "cannot hold more than 32 line items")
+}
+
+func Test_Checkout_Variant(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit", OrdersTable: "orders", BasketsTable: "baskets", BasketTTL: time.Hour}
+	awsSvc := newFakeAWS(cfg)
+	awsSvc.DDBClient.(*fake_aws_services.DynamoDB).CreateTable(cfg.OrdersTable, "id", "")
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       250,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       5,
+	})
+	assert.NoError(t, err)
+
+	price := int64(300)
+	variant, _, err := p.CreateVariant(context.TODO(), created.Id, created.Version, &products.Variant{
+		Sku:     "VP-001-M",
+		Price:   &price,
+		Stock:   3,
+		Options: map[string]string{"size": "M"},
+	})
+	assert.NoError(t, err)
+
+	b := NewService(cfg, awsSvc, p)
+	request := addItemRequest(created.Id)
+	request.Body = `{"productId": "` + created.Id + `", "variantId": "unknown", "quantity": 2}`
+	resp, err := b.addItem(context.TODO(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	request.Body = `{"productId": "` + created.Id + `", "variantId": "` + variant.Id + `", "quantity": 2}`
+	resp, err = b.addItem(context.TODO(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Body, `"unitPrice":300`)
+
+	resp, err = b.checkout(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/baskets/{id}/checkout",
+		Path:           "/baskets/customer-1/checkout",
+		HTTPMethod:     http.MethodPost,
+		PathParameters: map[string]string{"id": "customer-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, resp.Body, `"VariantId":"`+variant.Id+`"`)
+	assert.Contains(t, resp.Body, `"UnitPrice":300`)
+
+	// the variant is sold at its price, out of its stock, leaving that of the product alone
+	stored, err := p.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stored.Stock)
+	storedVariant, ok := stored.Variant(variant.Id)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), storedVariant.Stock)
+}
@@ -0,0 +1,220 @@
+package baskets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"store_apis/pkg/config"
+	"store_apis/pkg/orders"
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type CheckoutInfo struct {
+	CustomerId string `json:"customerId"` // defaults to the basket id
+}
+
+func (s *Service) checkout(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	checkout := new(CheckoutInfo)
+	if len(strings.TrimSpace(request.Body)) > 0 {
+		if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(checkout); err != nil {
+			msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+			return utils.SendErr(&utils.APIResponse{
+				StatusCode: http.StatusBadRequest,
+				Data:       msj,
+				LogMessage: msj,
+			})
+		}
+	}
+	if len(checkout.CustomerId) == 0 {
+		checkout.CustomerId = id
+	}
+
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reading basket", http.StatusNotFound))
+	}
+
+	if item == nil {
+		msj := fmt.Sprintf("no basket found with id: %v", id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if len(item.LineItems) == 0 {
+		msj := fmt.Sprintf("basket with id: %v is empty", id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	// baskets are capped when items are added, but older ones can hold more
+	if len(item.LineItems) > maxLineItems {
+		msj := fmt.Sprintf("basket with id: %v has too many line items to check out, max: %d", id, maxLineItems)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	lineItems := lineItemsOf(item.LineItems)
+	productItems, missing, err := s.findProducts(ctx, item.LineItems)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error looking up products", http.StatusNotFound))
+	}
+
+	if len(missing) > 0 {
+		msj := fmt.Sprintf("products no longer available: %v", strings.Join(missing, ", "))
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	// a product can change currency, or lose the variant, after it was added to the basket
+	order, err := orders.NewItem(checkout.CustomerId, lineItems, productItems)
+	if err != nil {
+		msj := fmt.Sprintf("basket with id: %v cannot be checked out: %v", id, err)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	joined, err := checkoutWrites(s.cfg, item, order)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	// the price guarantees the order is charged at the price that was snapshotted
+	changes := make([]products.StockChange, 0, len(order.LineItems))
+	for i := range order.LineItems {
+		changes = append(changes, products.StockChange{
+			ProductId: order.LineItems[i].ProductId,
+			VariantId: order.LineItems[i].VariantId,
+			Stock:     -order.LineItems[i].Quantity,
+			Price:     &order.LineItems[i].UnitPrice,
+		})
+	}
+
+	_, err = s.products.ChangeStock(ctx, products.ActionCheckout, changes, joined)
+	if msj, ok := checkoutConflict(err, item); ok {
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, fmt.Sprintf("error checking out basket with id: %v", id), http.StatusConflict))
+	}
+
+	return utils.SendCreated(
+		utils.Location(request, "/orders/"+order.Id),
+		order,
+		fmt.Sprintf("successfully created order with id: %s", order.Id),
+	)
+}
+
+// checkoutWrites builds the writes committed along with the stock of the order: the order put, then the
+// basket delete. checkoutConflict relies on this layout to tell which of them failed
+func checkoutWrites(cfg *config.Cfg, item *Item, order *orders.Item) ([]types.TransactWriteItem, error) {
+	orderAvMap, err := attributevalue.MarshalMap(order)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	orderExpr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("id")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	basketExpr, err := expression.NewBuilder().WithCondition(
+		expression.Name("version").Equal(expression.Value(item.Version)),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	return []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:                aws.String(cfg.OrdersTable),
+				Item:                     orderAvMap,
+				ExpressionAttributeNames: orderExpr.Names(),
+				ConditionExpression:      orderExpr.Condition(),
+			},
+		},
+		{
+			Delete: &types.Delete{
+				TableName: aws.String(cfg.BasketsTable),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: item.Id},
+				},
+				ExpressionAttributeNames:  basketExpr.Names(),
+				ExpressionAttributeValues: basketExpr.Values(),
+				ConditionExpression:       basketExpr.Condition(),
+			},
+		},
+	}, nil
+}
+
+// checkoutConflict tells the client which part of the checkout made it fail, and false when it did not
+// fail on a conflict
+func checkoutConflict(err error, item *Item) (string, bool) {
+	var jwe *products.JoinedWriteError
+	switch {
+	case errors.As(err, &jwe):
+		conflicts := make([]string, 0, len(jwe.Failed))
+		for _, idx := range jwe.Failed {
+			if idx == 0 {
+				conflicts = append(conflicts, "order already exists")
+			} else {
+				conflicts = append(conflicts, errConcurrentUpdate.Error())
+			}
+		}
+		return fmt.Sprintf("checkout of basket with id: %v failed: %v", item.Id, strings.Join(conflicts, "; ")), true
+	case errors.Is(err, products.ErrInsufficientStock), errors.Is(err, products.ErrPriceChanged), errors.Is(err, products.ErrNotFound),
+		errors.Is(err, products.ErrVariantNotFound):
+		return fmt.Sprintf("checkout of basket with id: %v failed: %v", item.Id, err), true
+	case errors.Is(err, products.ErrVersionMismatch):
+		return fmt.Sprintf("checkout of basket with id: %v failed: products were modified concurrently, retry the checkout", item.Id), true
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+package baskets
+
+import (
+	"context"
+	"net/http"
+	"store_apis/pkg/router"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func RegisterRoutes(r *router.Router, b IBasket) {
+	r.Handle(http.MethodGet, "/baskets/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Get(ctx, request, b)
+	})
+	r.Handle(http.MethodDelete, "/baskets/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Clear(ctx, request, b)
+	})
+	r.Handle(http.MethodPost, "/baskets/{id}/items", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return AddItem(ctx, request, b)
+	})
+	r.Handle(http.MethodPut, "/baskets/{id}/items/{productId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return ChangeItemQuantity(ctx, request, b)
+	})
+	r.Handle(http.MethodDelete, "/baskets/{id}/items/{productId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return RemoveItem(ctx, request, b)
+	})
+	r.Handle(http.MethodPost, "/baskets/{id}/checkout", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Checkout(ctx, request, b)
+	})
+}
+
+func Get(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.readBasket(ctx, request)
+}
+
+func Clear(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.clearBasket(ctx, request)
+}
+
+func AddItem(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.addItem(ctx, request)
+}
+
+func ChangeItemQuantity(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.changeItemQuantity(ctx, request)
+}
+
+func RemoveItem(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.removeItem(ctx, request)
+}
+
+func Checkout(ctx context.Context, request events.APIGatewayProxyRequest, b IBasket) (events.APIGatewayProxyResponse, error) {
+	return b.checkout(ctx, request)
+}
@@ -0,0 +1,390 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/google/uuid"
+	"gopkg.in/validator.v2"
+)
+
+type Category struct {
+	Name     string `json:"name" validate:"nonzero"`
+	ParentId string `json:"parentId"` // empty for a top level category
+}
+
+// Item is a node of the category tree. Its path lists the ids from the top level category down to it,
+// e.g. `/a/b/c/`, so the subtree of a category is every category whose path starts with its own
+type Item struct {
+	Id           string `dynamodbav:"id"`
+	DateModified int64  `dynamodbav:"dateModified"`
+	Version      int64  `dynamodbav:"version"` // bumped by every write to the category but the counters below
+	Name         string `dynamodbav:"name"`
+	ParentId     string `dynamodbav:"parentId,omitempty"`
+	Path         string `dynamodbav:"path"`
+	Children     int64  `dynamodbav:"children"` // number of direct subcategories
+	Products     int64  `dynamodbav:"products"` // number of products assigned
+}
+
+// Depth is the number of categories from the top level down to this one, itself included
+func (i *Item) Depth() int {
+	return depth(i.Path)
+}
+
+func depth(path string) int {
+	return strings.Count(path, "/") - 1
+}
+
+func childPath(parent *Item, id string) string {
+	if parent == nil {
+		return "/" + id + "/"
+	}
+	return parent.Path + id + "/"
+}
+
+type ItemsPage struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// ItemUpdate describes a write to a stored category. When Updated has another parent than Current, the
+// category moves under NewParent, nil for the top level, and the paths of Descendants are rewritten
+type ItemUpdate struct {
+	Current     *Item  // the category as read before the update
+	Updated     *Item  // the category as it is to be stored
+	NewParent   *Item  // the parent as read before the update, set when moving under another category
+	Descendants []Item // the subtree of Current as read before the update, set when moving
+}
+
+// Moved reports whether the update changes the parent of the category
+func (u *ItemUpdate) Moved() bool {
+	return u.Current.ParentId != u.Updated.ParentId
+}
+
+const (
+	// MaxDepth bounds the depth of the tree, keeping paths short
+	MaxDepth = 8
+	// maxMovedDescendants is the most subcategories moved along with a category, as a transaction writes up
+	// to 100 items and the category and both parents take three of them
+	maxMovedDescendants = 97
+)
+
+// ProductIndex is the global secondary index of the assignments table keyed by category id, listing the
+// products of a category without scanning the products table
+const ProductIndex = "categoryId-index"
+
+// PathIndex is the global secondary index of the categories table holding the whole tree in one partition,
+// keyed by TreeAttribute and sorted by path, so the subtree of a category is a Query on the prefix of its path
+const PathIndex = "path-index"
+
+const (
+	// TreeAttribute is the partition key of PathIndex, set on every category to treePartition
+	TreeAttribute = "tree"
+	treePartition = "categories"
+)
+
+var (
+	ErrNotFound    = errors.New("no category found with id")
+	ErrNotEmpty    = errors.New("category still has subcategories or products")
+	ErrNotAssigned = errors.New("product is not assigned to category")
+	// ErrModified means the category, or its subtree, changed while being written
+	ErrModified = errors.New("category was modified concurrently, retry")
+)
+
+// ValidationError is returned when the input of a category service call is rejected before reaching the table.
+// Err holds the validator.v2 errors, if any, for utils.ValidationErrors
+type ValidationError struct {
+	Msg string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return fmt.Sprintf("%v: %v", e.Msg, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Service is the ICategory keeping the tree consistent on top of a CategoryRepository. It reads the
+// products assigned to categories from the product service
+type Service struct {
+	repo     CategoryRepository
+	products products.IProduct
+}
+
+func NewService(repo CategoryRepository, products products.IProduct) *Service {
+	return &Service{repo: repo, products: products}
+}
+
+var _ ICategory = (*Service)(nil)
+
+func (s *Service) CreateCategory(ctx context.Context, category *Category) (*Item, error) {
+	if err := validator.WithPrintJSON(true).Validate(category); err != nil {
+		return nil, &ValidationError{Msg: "error category validation", Err: err}
+	}
+
+	parent, err := s.getParent(ctx, category.ParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{
+		Id:           uuid.New().String(),
+		DateModified: time.Now().UTC().Unix(),
+		Version:      1,
+		Name:         category.Name,
+		ParentId:     category.ParentId,
+	}
+	item.Path = childPath(parent, item.Id)
+	if item.Depth() > MaxDepth {
+		return nil, &ValidationError{Msg: fmt.Sprintf("categories cannot be nested more than %d deep", MaxDepth)}
+	}
+
+	if err := s.repo.Create(ctx, item, parent); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Service) GetCategory(ctx context.Context, id string) (*Item, error) {
+	return s.repo.Get(ctx, id, false)
+}
+
+func (s *Service) ListCategories(ctx context.Context, limit int32, cursor string, under string) (*ItemsPage, error) {
+	if limit < 1 || limit > utils.MaxPageLimit {
+		return nil, &ValidationError{Msg: fmt.Sprintf("limit must be an integer between 1 and %d", utils.MaxPageLimit)}
+	}
+
+	path := ""
+	if len(under) > 0 {
+		root, err := s.repo.Get(ctx, under, false)
+		if err != nil {
+			return nil, err
+		}
+		path = root.Path
+	}
+
+	return s.repo.List(ctx, limit, cursor, path)
+}
+
+// UpdateCategory renames the category with the given id and moves it under category.ParentId. A move
+// rewrites the path of every subcategory in the same transaction, so it is refused for categories with
+// more than maxMovedDescendants of them
+func (s *Service) UpdateCategory(ctx context.Context, id string, category *Category) (*Item, error) {
+	if err := validator.WithPrintJSON(true).Validate(category); err != nil {
+		return nil, &ValidationError{Msg: "error category validation", Err: err}
+	}
+
+	current, err := s.repo.Get(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *current
+	updated.Name = category.Name
+	updated.ParentId = category.ParentId
+	updated.Version = current.Version + 1
+	updated.DateModified = time.Now().UTC().Unix()
+
+	update := &ItemUpdate{Current: current, Updated: &updated}
+	if update.Moved() {
+		if err := s.prepareMove(ctx, update); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Update(ctx, update); err != nil {
+		return nil, err
+	}
+	return update.Updated, nil
+}
+
+// prepareMove reads the new parent and the subtree of the category, checking the move keeps a tree
+func (s *Service) prepareMove(ctx context.Context, update *ItemUpdate) error {
+	current, updated := update.Current, update.Updated
+
+	parent, err := s.getParent(ctx, updated.ParentId)
+	if err != nil {
+		return err
+	}
+	if parent != nil && strings.HasPrefix(parent.Path, current.Path) {
+		return &ValidationError{Msg: fmt.Sprintf("category %v cannot be moved under its own subtree", current.Id)}
+	}
+	updated.Path = childPath(parent, current.Id)
+
+	subtree, err := s.repo.Subtree(ctx, current.Path)
+	if err != nil {
+		return err
+	}
+
+	deepest := current.Depth()
+	descendants := make([]Item, 0, len(subtree))
+	for _, item := range subtree {
+		if item.Id == current.Id {
+			continue
+		}
+		descendants = append(descendants, item)
+		if item.Depth() > deepest {
+			deepest = item.Depth()
+		}
+	}
+	if !complete(current, descendants) {
+		return fmt.Errorf("%w: subtree of %v", ErrModified, current.Id)
+	}
+
+	if len(descendants) > maxMovedDescendants {
+		return &ValidationError{Msg: fmt.Sprintf("categories with more than %d subcategories cannot be moved", maxMovedDescendants)}
+	}
+	if deepest-current.Depth()+updated.Depth() > MaxDepth {
+		return &ValidationError{Msg: fmt.Sprintf("categories cannot be nested more than %d deep", MaxDepth)}
+	}
+
+	update.NewParent = parent
+	update.Descendants = descendants
+	return nil
+}
+
+// complete reports whether descendants, as read from an eventually consistent subtree, hold every
+// subcategory of current: each category read must have as many children among them as it counts. A
+// category missed, or read with a stale count, would be left out of the move, or fail its guard
+func complete(current *Item, descendants []Item) bool {
+	found := map[string]int64{}
+	for _, item := range descendants {
+		found[item.ParentId]++
+	}
+
+	if found[current.Id] != current.Children {
+		return false
+	}
+	for _, item := range descendants {
+		if found[item.Id] != item.Children {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteCategory deletes the category with the given id. Its subcategories must be deleted or moved, and
+// its live products unassigned, first. The products deleted or purged since they were assigned do not
+// count: their assignments are removed along with the category, so a restored product is left out of it
+func (s *Service) DeleteCategory(ctx context.Context, id string) error {
+	current, err := s.repo.Get(ctx, id, true)
+	if err != nil {
+		return err
+	}
+
+	if current.Children > 0 {
+		return fmt.Errorf("%w: %v has %d subcategories", ErrNotEmpty, id, current.Children)
+	}
+
+	if current.Products > 0 {
+		if err := s.unassignDeleted(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	// guarded on the count of products having dropped to zero, so a product assigned meanwhile fails it
+	return s.repo.Delete(ctx, current)
+}
+
+// unassignDeleted unassigns from the category the products deleted or purged since they were assigned. It
+// fails with ErrNotEmpty, unassigning nothing, when any product of the category is still live
+func (s *Service) unassignDeleted(ctx context.Context, id string) error {
+	stale := []string{}
+	cursor := ""
+	for {
+		ids, next, err := s.repo.ProductIds(ctx, id, utils.MaxPageLimit, cursor)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			batch, err := s.products.GetProducts(ctx, ids, products.ReadOptions{Consistent: true})
+			if err != nil {
+				return err
+			}
+			if len(batch.Items) > 0 {
+				return fmt.Errorf("%w: %v still has products, %v among them", ErrNotEmpty, id, batch.Items[0].Id)
+			}
+			stale = append(stale, ids...)
+		}
+
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for _, productId := range stale {
+		// unassigned concurrently
+		if err := s.repo.Unassign(ctx, id, productId); err != nil && !errors.Is(err, ErrNotAssigned) {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssignProduct adds the product to the category. Assigning it twice is harmless
+func (s *Service) AssignProduct(ctx context.Context, id string, productId string) error {
+	if _, err := s.products.GetProduct(ctx, productId, products.ReadOptions{}); err != nil {
+		return err
+	}
+
+	return s.repo.Assign(ctx, id, productId)
+}
+
+func (s *Service) UnassignProduct(ctx context.Context, id string, productId string) error {
+	return s.repo.Unassign(ctx, id, productId)
+}
+
+// CategoryProducts returns a page of the products assigned to the category. Deleted products are left out
+// of the page, which can then hold fewer than limit products while more follow
+func (s *Service) CategoryProducts(ctx context.Context, id string, limit int32, cursor string) (*products.ItemsPage, error) {
+	if limit < 1 || limit > utils.MaxPageLimit {
+		return nil, &ValidationError{Msg: fmt.Sprintf("limit must be an integer between 1 and %d", utils.MaxPageLimit)}
+	}
+
+	if _, err := s.repo.Get(ctx, id, false); err != nil {
+		return nil, err
+	}
+
+	ids, next, err := s.repo.ProductIds(ctx, id, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &products.ItemsPage{Items: []products.Item{}, Next: next}
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	batch, err := s.products.GetProducts(ctx, ids, products.ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	page.Items = batch.Items
+	return page, nil
+}
+
+// getParent reads the category a category is created or moved under, nil for the top level
+func (s *Service) getParent(ctx context.Context, id string) (*Item, error) {
+	if len(id) == 0 {
+		return nil, nil
+	}
+
+	parent, err := s.repo.Get(ctx, id, true)
+	if errors.Is(err, ErrNotFound) {
+		return nil, &ValidationError{Msg: fmt.Sprintf("parent category not found: %v", id)}
+	}
+	return parent, err
+}
@@ -0,0 +1,394 @@
+package categories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService builds the category service and the product service it reads from on an in-memory DynamoDB
+func newTestService() (*Service, *DynamoDBRepository, products.IProduct) {
+	cfg := &config.Cfg{
+		ProductsTable:          "products",
+		ProductsAuditTable:     "products-audit",
+		CategoriesTable:        "categories",
+		ProductCategoriesTable: "product-categories",
+	}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.CategoriesTable, "id", "")
+	ddb.CreateIndex(cfg.CategoriesTable, PathIndex, TreeAttribute, "path")
+	ddb.CreateTable(cfg.ProductCategoriesTable, "productId", "categoryId")
+	ddb.CreateIndex(cfg.ProductCategoriesTable, ProductIndex, "categoryId", "productId")
+
+	awsSvc := &aws_services.AWS{DDBClient: ddb}
+	repo := NewDynamoDBRepository(cfg, awsSvc)
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	return NewService(repo, p), repo, p
+}
+
+func createCategory(t *testing.T, c ICategory, name, parentId string) *Item {
+	body, err := json.Marshal(&Category{Name: name, ParentId: parentId})
+	assert.NoError(t, err)
+
+	resp, err := Post(context.TODO(), events.APIGatewayProxyRequest{Body: string(body)}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	return item
+}
+
+func getCategory(t *testing.T, c ICategory, id string) *Item {
+	resp, err := Get(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	return item
+}
+
+func Test_CategoryTree(t *testing.T) {
+	c, _, _ := newTestService()
+
+	clothing := createCategory(t, c, "Clothing", "")
+	shirts := createCategory(t, c, "Shirts", clothing.Id)
+	formal := createCategory(t, c, "Formal", shirts.Id)
+	sale := createCategory(t, c, "Sale", "")
+
+	assert.Equal(t, "/"+clothing.Id+"/", clothing.Path)
+	assert.Equal(t, "/"+clothing.Id+"/"+shirts.Id+"/"+formal.Id+"/", formal.Path)
+	assert.Equal(t, 3, formal.Depth())
+	assert.Equal(t, int64(1), getCategory(t, c, clothing.Id).Children)
+
+	// the parent must exist
+	resp, err := Post(context.TODO(), events.APIGatewayProxyRequest{Body: `{"name": "Orphan", "parentId": "missing"}`}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = Post(context.TODO(), events.APIGatewayProxyRequest{Body: `{"parentId": ""}`}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	list := func(under string) []string {
+		resp, err := List(context.TODO(), events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"under": under},
+		}, c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		page := new(ItemsPage)
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+		names := []string{}
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"Clothing", "Shirts", "Formal", "Sale"}, list(""))
+	assert.ElementsMatch(t, []string{"Clothing", "Shirts", "Formal"}, list(clothing.Id))
+	assert.ElementsMatch(t, []string{"Shirts", "Formal"}, list(shirts.Id))
+
+	// moving shirts under sale takes formal along
+	resp, err = Put(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": shirts.Id},
+		Body:           `{"name": "Shirts on sale", "parentId": "` + sale.Id + `"}`,
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	moved := getCategory(t, c, shirts.Id)
+	assert.Equal(t, "Shirts on sale", moved.Name)
+	assert.Equal(t, sale.Id, moved.ParentId)
+	assert.Equal(t, "/"+sale.Id+"/"+shirts.Id+"/", moved.Path)
+	assert.Equal(t, int64(2), moved.Version)
+	assert.Equal(t, "/"+sale.Id+"/"+shirts.Id+"/"+formal.Id+"/", getCategory(t, c, formal.Id).Path)
+	assert.Equal(t, int64(0), getCategory(t, c, clothing.Id).Children)
+	assert.Equal(t, int64(1), getCategory(t, c, sale.Id).Children)
+	assert.ElementsMatch(t, []string{"Clothing"}, list(clothing.Id))
+	assert.ElementsMatch(t, []string{"Sale", "Shirts on sale", "Formal"}, list(sale.Id))
+
+	// a category cannot be moved under itself or its subtree
+	for _, parentId := range []string{sale.Id, formal.Id} {
+		resp, err = Put(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": sale.Id},
+			Body:           `{"name": "Sale", "parentId": "` + parentId + `"}`,
+		}, c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// back to the top level
+	resp, err = Put(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": formal.Id},
+		Body:           `{"name": "Formal"}`,
+	}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/"+formal.Id+"/", getCategory(t, c, formal.Id).Path)
+	assert.Equal(t, int64(0), getCategory(t, c, shirts.Id).Children)
+
+	// only leaves can be deleted
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": sale.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, int64(0), getCategory(t, c, sale.Id).Children)
+
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_CategoryTree_MaxDepth(t *testing.T) {
+	c, _, _ := newTestService()
+
+	parentId := ""
+	for i := 0; i < MaxDepth; i++ {
+		parentId = createCategory(t, c, "level", parentId).Id
+	}
+
+	_, err := c.CreateCategory(context.TODO(), &Category{Name: "too deep", ParentId: parentId})
+	var ve *ValidationError
+	assert.True(t, errors.As(err, &ve))
+
+	// a two level subtree does not fit under the deepest but one category either
+	top := createCategory(t, c, "top", "")
+	createCategory(t, c, "child", top.Id)
+	deepestButOne := getCategory(t, c, parentId).ParentId
+
+	_, err = c.UpdateCategory(context.TODO(), top.Id, &Category{Name: "top", ParentId: deepestButOne})
+	assert.True(t, errors.As(err, &ve))
+}
+
+func Test_CategoryUpdate_SubtreeChanged(t *testing.T) {
+	c, repo, _ := newTestService()
+
+	root := createCategory(t, c, "root", "")
+	child := createCategory(t, c, "child", root.Id)
+	other := createCategory(t, c, "other", "")
+
+	// the subtree as read before a subcategory was added to child
+	current := getCategory(t, c, root.Id)
+	descendants := []Item{*getCategory(t, c, child.Id)}
+	createCategory(t, c, "grandchild", child.Id)
+
+	updated := *current
+	updated.ParentId = other.Id
+	updated.Path = other.Path + root.Id + "/"
+	updated.Version++
+
+	err := repo.Update(context.TODO(), &ItemUpdate{
+		Current:     current,
+		Updated:     &updated,
+		NewParent:   other,
+		Descendants: descendants,
+	})
+	assert.True(t, errors.Is(err, ErrModified))
+
+	// nothing was written
+	assert.Equal(t, root.Path, getCategory(t, c, root.Id).Path)
+	assert.Equal(t, int64(0), getCategory(t, c, other.Id).Children)
+}
+
+// staleIndex serves the subtree without the category left out, as PathIndex does before a write reaches it
+type staleIndex struct {
+	*DynamoDBRepository
+	leftOut string
+}
+
+func (r *staleIndex) Subtree(ctx context.Context, path string) ([]Item, error) {
+	items, err := r.DynamoDBRepository.Subtree(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	subtree := []Item{}
+	for _, item := range items {
+		if item.Id != r.leftOut {
+			subtree = append(subtree, item)
+		}
+	}
+	return subtree, nil
+}
+
+func Test_CategoryUpdate_StaleSubtree(t *testing.T) {
+	c, repo, p := newTestService()
+
+	root := createCategory(t, c, "root", "")
+	child := createCategory(t, c, "child", root.Id)
+	grandchild := createCategory(t, c, "grandchild", child.Id)
+	other := createCategory(t, c, "other", "")
+
+	stale := NewService(&staleIndex{DynamoDBRepository: repo, leftOut: grandchild.Id}, p)
+	_, err := stale.UpdateCategory(context.TODO(), root.Id, &Category{Name: "root", ParentId: other.Id})
+	assert.ErrorIs(t, err, ErrModified)
+
+	// nothing was written, the grandchild keeping a path under root
+	assert.Equal(t, root.Path, getCategory(t, c, root.Id).Path)
+	assert.Equal(t, grandchild.Path, getCategory(t, c, grandchild.Id).Path)
+	assert.Equal(t, int64(0), getCategory(t, c, other.Id).Children)
+
+	// once the index caught up, the move goes through
+	moved, err := c.UpdateCategory(context.TODO(), root.Id, &Category{Name: "root", ParentId: other.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, moved.Path+child.Id+"/"+grandchild.Id+"/", getCategory(t, c, grandchild.Id).Path)
+}
+
+func Test_CategoryProducts(t *testing.T) {
+	c, _, p := newTestService()
+
+	shirts := createCategory(t, c, "Shirts", "")
+	ids := []string{}
+	for _, sku := range []string{"SH-001", "SH-002", "SH-003"} {
+		item, err := p.CreateProduct(context.TODO(), &products.Product{
+			Name:        "shirt " + sku,
+			Description: "a shirt",
+			Price:       1999,
+			Currency:    "USD",
+			Sku:         sku,
+			Stock:       10,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, item.Id)
+	}
+
+	assign := func(id, productId string) int {
+		resp, err := AssignProduct(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": id, "productId": productId},
+		}, c)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	for _, id := range ids {
+		assert.Equal(t, http.StatusNoContent, assign(shirts.Id, id))
+	}
+	// assigning twice is harmless
+	assert.Equal(t, http.StatusNoContent, assign(shirts.Id, ids[0]))
+	assert.Equal(t, int64(3), getCategory(t, c, shirts.Id).Products)
+
+	assert.Equal(t, http.StatusNotFound, assign(shirts.Id, "missing"))
+	assert.Equal(t, http.StatusNotFound, assign("missing", ids[0]))
+
+	list := func() []string {
+		listed := []string{}
+		query := map[string]string{"limit": "2"}
+		for {
+			resp, err := ListProducts(context.TODO(), events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"id": shirts.Id},
+				QueryStringParameters: query,
+			}, c)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			page := new(products.ItemsPage)
+			assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+			for _, item := range page.Items {
+				listed = append(listed, item.Id)
+			}
+			if len(page.Next) == 0 {
+				return listed
+			}
+			query["cursor"] = page.Next
+		}
+	}
+	assert.ElementsMatch(t, ids, list())
+
+	// deleted products are left out, while still assigned
+	assert.NoError(t, p.DeleteProduct(context.TODO(), ids[1], products.AnyVersion))
+	assert.ElementsMatch(t, []string{ids[0], ids[2]}, list())
+
+	// a category with products cannot be deleted
+	resp, err := Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	unassign := func(productId string) int {
+		resp, err := UnassignProduct(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": shirts.Id, "productId": productId},
+		}, c)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+	for _, id := range ids {
+		assert.Equal(t, http.StatusNoContent, unassign(id))
+	}
+	assert.Equal(t, http.StatusNotFound, unassign(ids[0]))
+	assert.Empty(t, list())
+
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = ListProducts(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_DeleteCategory_DeletedProducts(t *testing.T) {
+	c, repo, p := newTestService()
+
+	shirts := createCategory(t, c, "Shirts", "")
+	ids := []string{}
+	for _, sku := range []string{"SH-001", "SH-002", "SH-003"} {
+		item, err := p.CreateProduct(context.TODO(), &products.Product{
+			Name:        "shirt " + sku,
+			Description: "a shirt",
+			Price:       1999,
+			Currency:    "USD",
+			Sku:         sku,
+			Stock:       10,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, item.Id)
+		assert.NoError(t, c.AssignProduct(context.TODO(), shirts.Id, item.Id))
+	}
+
+	// one deleted, one purged
+	assert.NoError(t, p.DeleteProduct(context.TODO(), ids[0], products.AnyVersion))
+	assert.NoError(t, p.DeleteProduct(context.TODO(), ids[1], products.AnyVersion))
+	purged, err := p.PurgeDeletedProducts(context.TODO(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.NoError(t, p.DeleteProduct(context.TODO(), ids[2], products.AnyVersion))
+	restored, err := p.RestoreProduct(context.TODO(), ids[2], products.AnyVersion)
+	assert.NoError(t, err)
+
+	// a live product is left, nothing is unassigned
+	err = c.DeleteCategory(context.TODO(), shirts.Id)
+	assert.True(t, errors.Is(err, ErrNotEmpty), err)
+	assert.Equal(t, int64(3), getCategory(t, c, shirts.Id).Products)
+
+	assert.NoError(t, p.DeleteProduct(context.TODO(), restored.Id, products.AnyVersion))
+
+	resp, err := Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": shirts.Id}}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, err = c.GetCategory(context.TODO(), shirts.Id)
+	assert.True(t, errors.Is(err, ErrNotFound), err)
+
+	// the assignments went with the category
+	assigned, _, err := repo.ProductIds(context.TODO(), shirts.Id, 10, "")
+	assert.NoError(t, err)
+	assert.Empty(t, assigned)
+}
@@ -0,0 +1,255 @@
+package categories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"store_apis/pkg/products"
+	"store_apis/pkg/router"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func RegisterRoutes(r *router.Router, c ICategory) {
+	r.Handle(http.MethodPost, "/categories", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Post(ctx, request, c)
+	})
+	r.Handle(http.MethodGet, "/categories", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return List(ctx, request, c)
+	})
+	r.Handle(http.MethodGet, "/categories/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Get(ctx, request, c)
+	})
+	r.Handle(http.MethodPut, "/categories/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Put(ctx, request, c)
+	})
+	r.Handle(http.MethodDelete, "/categories/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Delete(ctx, request, c)
+	})
+	r.Handle(http.MethodGet, "/categories/{id}/products", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return ListProducts(ctx, request, c)
+	})
+	r.Handle(http.MethodPut, "/categories/{id}/products/{productId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return AssignProduct(ctx, request, c)
+	})
+	r.Handle(http.MethodDelete, "/categories/{id}/products/{productId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return UnassignProduct(ctx, request, c)
+	})
+}
+
+func Post(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	category := new(Category)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(category); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := c.CreateCategory(ctx, category)
+	if err != nil {
+		return sendServiceErr(err, "error creating category")
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusCreated,
+		Body:       item,
+		LogMessage: fmt.Sprintf("successfully created category with id: %s", item.Id),
+		Headers:    map[string]string{"Location": utils.Location(request, "/categories/"+item.Id)},
+	})
+}
+
+func Get(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	item, err := c.GetCategory(ctx, id)
+	if err != nil {
+		return sendServiceErr(err, "error reading category")
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       item,
+		LogMessage: fmt.Sprintf("read category with id: %v", id),
+	})
+}
+
+// List answers with a page of categories. `?under={id}` lists the subtree of that category, itself included
+func List(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	limit, err := utils.ParseLimit(request.QueryStringParameters)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	page, err := c.ListCategories(ctx, limit, request.QueryStringParameters["cursor"], request.QueryStringParameters["under"])
+	if err != nil {
+		return sendServiceErr(err, "error listing categories")
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*ItemsPage]{
+		StatusCode: http.StatusOK,
+		Body:       page,
+		LogMessage: fmt.Sprintf("listed %d categories", len(page.Items)),
+	})
+}
+
+// Put renames the category, and moves it with its subcategories when parentId changes
+func Put(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	category := new(Category)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(category); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	updated, err := c.UpdateCategory(ctx, id, category)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error updating category with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       updated,
+		LogMessage: fmt.Sprintf("category with id: %v, was successfully updated", id),
+	})
+}
+
+func Delete(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	if err := c.DeleteCategory(ctx, id); err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error deleting category with id: %v", id))
+	}
+
+	return utils.SendNoContent(fmt.Sprintf("category with id: %v, was successfully deleted", id))
+}
+
+// ListProducts answers with a page of the products assigned to the category
+func ListProducts(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	limit, err := utils.ParseLimit(request.QueryStringParameters)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	page, err := c.CategoryProducts(ctx, id, limit, request.QueryStringParameters["cursor"])
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error listing products of category with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*products.ItemsPage]{
+		StatusCode: http.StatusOK,
+		Body:       page,
+		LogMessage: fmt.Sprintf("listed %d products of category with id: %v", len(page.Items), id),
+	})
+}
+
+func AssignProduct(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id, productId := request.PathParameters["id"], request.PathParameters["productId"]
+	if len(id) == 0 || len(productId) == 0 {
+		return sendEmptyId()
+	}
+
+	if err := c.AssignProduct(ctx, id, productId); err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error assigning product with id: %v to category with id: %v", productId, id))
+	}
+
+	return utils.SendNoContent(fmt.Sprintf("product with id: %v, was assigned to category with id: %v", productId, id))
+}
+
+func UnassignProduct(ctx context.Context, request events.APIGatewayProxyRequest, c ICategory) (events.APIGatewayProxyResponse, error) {
+	id, productId := request.PathParameters["id"], request.PathParameters["productId"]
+	if len(id) == 0 || len(productId) == 0 {
+		return sendEmptyId()
+	}
+
+	if err := c.UnassignProduct(ctx, id, productId); err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error unassigning product with id: %v from category with id: %v", productId, id))
+	}
+
+	return utils.SendNoContent(fmt.Sprintf("product with id: %v, was unassigned from category with id: %v", productId, id))
+}
+
+func sendEmptyId() (events.APIGatewayProxyResponse, error) {
+	msj := "empty id on path params"
+	return utils.SendErr(&utils.APIResponse{
+		StatusCode: http.StatusBadRequest,
+		Data:       msj,
+		LogMessage: msj,
+	})
+}
+
+// sendServiceErr answers an error returned by the category service, which passes on the errors of the
+// product service about the products it reads. Other errors are AWS or internal errors, described by action
+func sendServiceErr(err error, action string) (events.APIGatewayProxyResponse, error) {
+	var (
+		ve  *ValidationError
+		pve *products.ValidationError
+	)
+	switch {
+	case errors.As(err, &ve):
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       ve.Msg,
+			LogMessage: err.Error(),
+			Errors:     utils.ValidationErrors(ve.Err),
+		})
+	case errors.As(err, &pve):
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       pve.Msg,
+			LogMessage: err.Error(),
+		})
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNotAssigned), errors.Is(err, products.ErrNotFound):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, ErrNotEmpty), errors.Is(err, ErrModified):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendErr(utils.AWSErrResponse(err, action, http.StatusConflict))
+}
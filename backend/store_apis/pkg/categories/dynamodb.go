@@ -0,0 +1,535 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBRepository stores the categories in the categories table, indexed by PathIndex, and the assignments
+// of products to them in the product categories table, keyed by product id then category id and indexed by
+// ProductIndex
+type DynamoDBRepository struct {
+	cfg    *config.Cfg
+	awsSvc *aws_services.AWS
+}
+
+func NewDynamoDBRepository(cfg *config.Cfg, awsSvc *aws_services.AWS) *DynamoDBRepository {
+	return &DynamoDBRepository{cfg: cfg, awsSvc: awsSvc}
+}
+
+var _ CategoryRepository = (*DynamoDBRepository)(nil)
+
+// assignment records a product being in a category
+type assignment struct {
+	ProductId  string `dynamodbav:"productId"`
+	CategoryId string `dynamodbav:"categoryId"`
+	DateAdded  int64  `dynamodbav:"dateAdded,omitempty"`
+}
+
+// Create puts the category in a transaction with the count of the children of parent, guarded on the
+// parent not being moved or deleted since it was read
+func (r *DynamoDBRepository) Create(ctx context.Context, item *Item, parent *Item) error {
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("error mapping attribute values: %v", err)
+	}
+	avMap[TreeAttribute] = &types.AttributeValueMemberS{Value: treePartition}
+
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("id")),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:                aws.String(r.cfg.CategoriesTable),
+				Item:                     avMap,
+				ExpressionAttributeNames: expr.Names(),
+				ConditionExpression:      expr.Condition(),
+			},
+		},
+	}
+
+	if parent != nil {
+		countChild, err := r.addChildren(parent.Id, 1, pathCondition(parent.Path))
+		if err != nil {
+			return err
+		}
+		transactItems = append(transactItems, countChild)
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return fmt.Errorf("%w: parent %v", ErrModified, item.ParentId)
+		}
+		return fmt.Errorf("error putting item: %w", err)
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) Get(ctx context.Context, id string, consistent bool) (*Item, error) {
+	getOutput, err := r.awsSvc.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.cfg.CategoriesTable),
+		Key:            categoryKey(id),
+		ConsistentRead: aws.Bool(consistent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting item: %w", err)
+	}
+
+	if len(getOutput.Item) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, id)
+	}
+
+	item := new(Item)
+	if err := attributevalue.UnmarshalMap(getOutput.Item, item); err != nil {
+		return nil, fmt.Errorf("error unmarshalling get output: %v", err)
+	}
+	return item, nil
+}
+
+// List queries PathIndex for the categories whose path starts with path, in path order. The cursor is the
+// encoded LastEvaluatedKey of the previous page
+func (r *DynamoDBRepository) List(ctx context.Context, limit int32, cursor string, path string) (*ItemsPage, error) {
+	startKey, err := utils.DecodeCursor(cursor)
+	if err != nil {
+		return nil, &ValidationError{Msg: err.Error()}
+	}
+
+	queryInput, err := r.pathQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	queryInput.Limit = aws.Int32(limit)
+	queryInput.ExclusiveStartKey = startKey
+
+	queryOutput, err := r.awsSvc.DDBClient.Query(ctx, queryInput)
+	if err != nil {
+		return nil, fmt.Errorf("error query items: %w", err)
+	}
+
+	page := &ItemsPage{Items: []Item{}}
+	if err := attributevalue.UnmarshalListOfMaps(queryOutput.Items, &page.Items); err != nil {
+		return nil, fmt.Errorf("error unmarshalling query output: %v", err)
+	}
+
+	page.Next, err = utils.EncodeCursor(queryOutput.LastEvaluatedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cursor: %v", err)
+	}
+
+	return page, nil
+}
+
+// Subtree queries PathIndex for every category whose path starts with path. The index is eventually
+// consistent, so the subtree can miss a category just created or moved in, or hold one just moved out
+func (r *DynamoDBRepository) Subtree(ctx context.Context, path string) ([]Item, error) {
+	queryInput, err := r.pathQuery(path)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	for {
+		queryOutput, err := r.awsSvc.DDBClient.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("error query items: %w", err)
+		}
+
+		page := []Item{}
+		if err := attributevalue.UnmarshalListOfMaps(queryOutput.Items, &page); err != nil {
+			return nil, fmt.Errorf("error unmarshalling query output: %v", err)
+		}
+		items = append(items, page...)
+
+		if len(queryOutput.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		queryInput.ExclusiveStartKey = queryOutput.LastEvaluatedKey
+	}
+}
+
+// Update writes the category and, on a move, the counts of both parents and the paths of the descendants
+// in one transaction. Every category written is guarded on its version and number of children, so a
+// subcategory created or moved in the subtree meanwhile fails the update
+func (r *DynamoDBRepository) Update(ctx context.Context, update *ItemUpdate) error {
+	current, updated := update.Current, update.Updated
+
+	set := expression.
+		Set(expression.Name("name"), expression.Value(updated.Name)).
+		Set(expression.Name("version"), expression.Value(updated.Version)).
+		Set(expression.Name("dateModified"), expression.Value(updated.DateModified))
+	if update.Moved() {
+		set = set.Set(expression.Name("path"), expression.Value(updated.Path))
+		if len(updated.ParentId) == 0 {
+			set = set.Remove(expression.Name("parentId"))
+		} else {
+			set = set.Set(expression.Name("parentId"), expression.Value(updated.ParentId))
+		}
+	}
+
+	updateCategory, err := r.updateItem(current, set)
+	if err != nil {
+		return err
+	}
+	transactItems := []types.TransactWriteItem{updateCategory}
+
+	if update.Moved() {
+		if len(current.ParentId) > 0 {
+			uncountChild, err := r.addChildren(current.ParentId, -1, expression.AttributeExists(expression.Name("id")))
+			if err != nil {
+				return err
+			}
+			transactItems = append(transactItems, uncountChild)
+		}
+
+		if update.NewParent != nil {
+			countChild, err := r.addChildren(update.NewParent.Id, 1, pathCondition(update.NewParent.Path))
+			if err != nil {
+				return err
+			}
+			transactItems = append(transactItems, countChild)
+		}
+
+		for i := range update.Descendants {
+			descendant := &update.Descendants[i]
+			set := expression.
+				Set(expression.Name("path"), expression.Value(updated.Path+strings.TrimPrefix(descendant.Path, current.Path))).
+				Set(expression.Name("version"), expression.Value(descendant.Version+1)).
+				Set(expression.Name("dateModified"), expression.Value(updated.DateModified))
+
+			moveDescendant, err := r.updateItem(descendant, set)
+			if err != nil {
+				return err
+			}
+			transactItems = append(transactItems, moveDescendant)
+		}
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return fmt.Errorf("%w: %v", ErrModified, current.Id)
+		}
+		return fmt.Errorf("error updating item with id: %v: %w", current.Id, err)
+	}
+
+	return nil
+}
+
+// updateItem builds the update of a category guarded on it being as read
+func (r *DynamoDBRepository) updateItem(current *Item, set expression.UpdateBuilder) (types.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(set).
+		WithCondition(unchangedCondition(current)).
+		Build()
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error building update expression: %v", err)
+	}
+
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(r.cfg.CategoriesTable),
+			Key:                       categoryKey(current.Id),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	}, nil
+}
+
+// Delete removes the category in a transaction with the count of the children of its parent
+func (r *DynamoDBRepository) Delete(ctx context.Context, current *Item) error {
+	expr, err := expression.NewBuilder().WithCondition(
+		unchangedCondition(current).
+			And(expression.Name("products").Equal(expression.Value(0))),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName:                 aws.String(r.cfg.CategoriesTable),
+				Key:                       categoryKey(current.Id),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+	}
+
+	if len(current.ParentId) > 0 {
+		uncountChild, err := r.addChildren(current.ParentId, -1, expression.AttributeExists(expression.Name("id")))
+		if err != nil {
+			return err
+		}
+		transactItems = append(transactItems, uncountChild)
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return fmt.Errorf("%w: %v", ErrModified, current.Id)
+		}
+		return fmt.Errorf("error deleting item with id: %v: %w", current.Id, err)
+	}
+
+	return nil
+}
+
+// Assign puts the assignment in a transaction with the count of the products of the category
+func (r *DynamoDBRepository) Assign(ctx context.Context, id string, productId string) error {
+	avMap, err := attributevalue.MarshalMap(&assignment{
+		ProductId:  productId,
+		CategoryId: id,
+		DateAdded:  time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("productId")),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	countProduct, err := r.addProducts(id, 1)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:                aws.String(r.cfg.ProductCategoriesTable),
+					Item:                     avMap,
+					ExpressionAttributeNames: expr.Names(),
+					ConditionExpression:      expr.Condition(),
+				},
+			},
+			countProduct,
+		},
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			switch {
+			case isConditionFailed(tce.CancellationReasons, 1):
+				return fmt.Errorf("%w: %v", ErrNotFound, id)
+			case isConditionFailed(tce.CancellationReasons, 0):
+				// already assigned
+				return nil
+			}
+		}
+		return fmt.Errorf("error putting item: %w", err)
+	}
+
+	return nil
+}
+
+// Unassign deletes the assignment in a transaction with the count of the products of the category
+func (r *DynamoDBRepository) Unassign(ctx context.Context, id string, productId string) error {
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeExists(expression.Name("productId")),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	uncountProduct, err := r.addProducts(id, -1)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName:                aws.String(r.cfg.ProductCategoriesTable),
+					Key:                      assignmentKey(id, productId),
+					ExpressionAttributeNames: expr.Names(),
+					ConditionExpression:      expr.Condition(),
+				},
+			},
+			uncountProduct,
+		},
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			switch {
+			case isConditionFailed(tce.CancellationReasons, 1):
+				return fmt.Errorf("%w: %v", ErrNotFound, id)
+			case isConditionFailed(tce.CancellationReasons, 0):
+				return fmt.Errorf("%w: %v in %v", ErrNotAssigned, productId, id)
+			}
+		}
+		return fmt.Errorf("error deleting item: %w", err)
+	}
+
+	return nil
+}
+
+// ProductIds queries ProductIndex, the cursor being the encoded LastEvaluatedKey of the previous page
+func (r *DynamoDBRepository) ProductIds(ctx context.Context, id string, limit int32, cursor string) ([]string, string, error) {
+	startKey, err := utils.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", &ValidationError{Msg: err.Error()}
+	}
+
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(
+			expression.
+				Key("categoryId").Equal(expression.Value(id)),
+		).
+		WithProjection(expression.NamesList(expression.Name("productId"))).
+		Build()
+	if err != nil {
+		return nil, "", fmt.Errorf("error building query expression: %v", err)
+	}
+
+	queryOutput, err := r.awsSvc.DDBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(r.cfg.ProductCategoriesTable),
+		IndexName:                 aws.String(ProductIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int32(limit),
+		ExclusiveStartKey:         startKey,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error query items: %w", err)
+	}
+
+	assignments := []assignment{}
+	if err := attributevalue.UnmarshalListOfMaps(queryOutput.Items, &assignments); err != nil {
+		return nil, "", fmt.Errorf("error unmarshalling query output: %v", err)
+	}
+
+	ids := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		ids = append(ids, a.ProductId)
+	}
+
+	next, err := utils.EncodeCursor(queryOutput.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding cursor: %v", err)
+	}
+
+	return ids, next, nil
+}
+
+// addChildren builds the update of the number of children of a category, guarded on cond
+func (r *DynamoDBRepository) addChildren(id string, delta int64, cond expression.ConditionBuilder) (types.TransactWriteItem, error) {
+	return r.addCount(id, "children", delta, cond)
+}
+
+// addProducts builds the update of the number of products of a category, guarded on it existing
+func (r *DynamoDBRepository) addProducts(id string, delta int64) (types.TransactWriteItem, error) {
+	return r.addCount(id, "products", delta, expression.AttributeExists(expression.Name("id")))
+}
+
+func (r *DynamoDBRepository) addCount(id, counter string, delta int64, cond expression.ConditionBuilder) (types.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Add(expression.Name(counter), expression.Value(delta))).
+		WithCondition(cond).
+		Build()
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error building update expression: %v", err)
+	}
+
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(r.cfg.CategoriesTable),
+			Key:                       categoryKey(id),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	}, nil
+}
+
+// pathQuery builds the query of PathIndex for the subtree under path, the whole tree when path is empty
+func (r *DynamoDBRepository) pathQuery(path string) (*dynamodb.QueryInput, error) {
+	keyCond := expression.Key(TreeAttribute).Equal(expression.Value(treePartition))
+	if len(path) > 0 {
+		keyCond = keyCond.And(expression.Key("path").BeginsWith(path))
+	}
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building query expression: %v", err)
+	}
+
+	return &dynamodb.QueryInput{
+		TableName:                 aws.String(r.cfg.CategoriesTable),
+		IndexName:                 aws.String(PathIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, nil
+}
+
+// pathCondition guards a write on the category existing where it was read in the tree
+func pathCondition(path string) expression.ConditionBuilder {
+	return expression.Name("path").Equal(expression.Value(path))
+}
+
+// unchangedCondition guards a write on the category being at the version, and with the children, it was read with
+func unchangedCondition(current *Item) expression.ConditionBuilder {
+	return expression.Name("version").Equal(expression.Value(current.Version)).
+		And(expression.Name("children").Equal(expression.Value(current.Children)))
+}
+
+// isConditionFailed reports whether the transaction was cancelled by the condition of the action at idx
+func isConditionFailed(reasons []types.CancellationReason, idx int) bool {
+	return idx < len(reasons) && aws.ToString(reasons[idx].Code) == "ConditionalCheckFailed"
+}
+
+func categoryKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+func assignmentKey(id, productId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"productId":  &types.AttributeValueMemberS{Value: productId},
+		"categoryId": &types.AttributeValueMemberS{Value: id},
+	}
+}
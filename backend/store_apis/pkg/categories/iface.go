@@ -0,0 +1,51 @@
+package categories
+
+import (
+	"context"
+
+	"store_apis/pkg/products"
+)
+
+// ICategory organises the catalog into a tree of categories. Like products.IProduct it works on domain
+// types only, the HTTP routes being in ctrl.go
+type ICategory interface {
+	CreateCategory(ctx context.Context, category *Category) (*Item, error)
+	GetCategory(ctx context.Context, id string) (*Item, error)
+	// ListCategories pages through every category, or only the subtree of the category with id under when set,
+	// in path order
+	ListCategories(ctx context.Context, limit int32, cursor string, under string) (*ItemsPage, error)
+	// UpdateCategory renames the category and, when its parent changes, moves it along with its subtree
+	UpdateCategory(ctx context.Context, id string, category *Category) (*Item, error)
+	// DeleteCategory deletes a category with no subcategories and no live products assigned, dropping the
+	// assignments of the deleted and purged ones
+	DeleteCategory(ctx context.Context, id string) error
+	AssignProduct(ctx context.Context, id string, productId string) error
+	UnassignProduct(ctx context.Context, id string, productId string) error
+	// CategoryProducts pages through the products assigned to the category
+	CategoryProducts(ctx context.Context, id string, limit int32, cursor string) (*products.ItemsPage, error)
+}
+
+// CategoryRepository persists the categories and the assignments of products to them. Implementations
+// report a missing category as ErrNotFound and a write racing another one on the same subtree as ErrModified
+type CategoryRepository interface {
+	// Create stores the category, counting it in the children of parent unless it is a top level one
+	Create(ctx context.Context, item *Item, parent *Item) error
+	Get(ctx context.Context, id string, consistent bool) (*Item, error)
+	// List returns a page of at most limit categories whose path starts with path, every category for an
+	// empty path. The cursor is opaque, taken from ItemsPage.Next
+	List(ctx context.Context, limit int32, cursor string, path string) (*ItemsPage, error)
+	// Subtree reads every category whose path starts with path. It may be eventually consistent, callers
+	// checking what they read against the guards of the write that follows
+	Subtree(ctx context.Context, path string) ([]Item, error)
+	// Update writes the category of the update along with the new paths of its descendants, guarded on
+	// none of them having changed since they were read
+	Update(ctx context.Context, update *ItemUpdate) error
+	// Delete removes the category, guarded on it being at the version of current with no children nor products
+	Delete(ctx context.Context, current *Item) error
+	// Assign is a no-op for a product already assigned to the category
+	Assign(ctx context.Context, id string, productId string) error
+	// Unassign reports a product not assigned to the category as ErrNotAssigned
+	Unassign(ctx context.Context, id string, productId string) error
+	// ProductIds returns the ids of at most limit products assigned to the category and the cursor of the next page
+	ProductIds(ctx context.Context, id string, limit int32, cursor string) ([]string, string, error)
+}
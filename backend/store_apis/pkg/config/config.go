@@ -1,6 +1,21 @@
 package config
 
+import "time"
+
 type Cfg struct {
-	AWSRegion     string `envconfig:"AWS_REGION" default:"us-east-2"`
-	ProductsTable string `envconfig:"PRODUCTS_TABLE"`
+	AWSRegion              string        `envconfig:"AWS_REGION" default:"us-east-2"`
+	DynamoDBEndpoint       string        `envconfig:"DYNAMODB_ENDPOINT"` // e.g. http://localhost:8000 for DynamoDB Local, empty for AWS
+	ProductsTable          string        `envconfig:"PRODUCTS_TABLE"`
+	ProductsAuditTable     string        `envconfig:"PRODUCTS_AUDIT_TABLE"`                                // the change history of the products
+	ProductsCacheControl   string        `envconfig:"PRODUCTS_CACHE_CONTROL" default:"public, max-age=60"` // Cache-Control of product reads
+	ProductsRetention      time.Duration `envconfig:"PRODUCTS_RETENTION" default:"720h"`                   // how long deleted products are kept before being purged
+	ImagesBucket           string        `envconfig:"IMAGES_BUCKET"`                                       // holds the product images, uploaded straight to it with presigned URLs
+	ThumbnailSizes         []int         `envconfig:"THUMBNAIL_SIZES" default:"200,800"`                   // in pixels, of the square each thumbnail of an image fits in
+	CategoriesTable        string        `envconfig:"CATEGORIES_TABLE"`
+	ProductCategoriesTable string        `envconfig:"PRODUCT_CATEGORIES_TABLE"` // the assignments of products to categories
+	OrdersTable            string        `envconfig:"ORDERS_TABLE"`
+	BasketsTable           string        `envconfig:"BASKETS_TABLE"`
+	BasketTTL              time.Duration `envconfig:"BASKET_TTL" default:"72h"`
+	ReservationsTable      string        `envconfig:"RESERVATIONS_TABLE"`
+	ReservationTTL         time.Duration `envconfig:"RESERVATION_TTL" default:"15m"`
 }
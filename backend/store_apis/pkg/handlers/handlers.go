@@ -2,64 +2,172 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"strings"
+	"time"
 
 	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/baskets"
+	"store_apis/pkg/categories"
 	"store_apis/pkg/config"
+	"store_apis/pkg/inventory"
+	"store_apis/pkg/orders"
 	"store_apis/pkg/products"
-	"store_apis/pkg/utils"
+	"store_apis/pkg/router"
+	"store_apis/pkg/thumbnails"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/rs/zerolog/log"
 )
 
-func ProductsHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	ctx := context.TODO()
+// Handlers holds what every invocation of a Lambda shares: the config, the AWS clients, the domain
+// services and the routers serving them. It is built once per cold start in main, so warm invocations go
+// straight to the router
+type Handlers struct {
+	Cfg *config.Cfg
+	AWS *aws_services.AWS
 
+	Products   products.IProduct
+	Categories categories.ICategory
+	Orders     orders.IOrder
+	Baskets    baskets.IBasket
+	Inventory  inventory.IInventory
+	Thumbnails *thumbnails.Generator
+
+	// one router per domain Lambda, and one with all the routes for the local server
+	productsRouter   *router.Router
+	categoriesRouter *router.Router
+	ordersRouter     *router.Router
+	basketsRouter    *router.Router
+	inventoryRouter  *router.Router
+	router           *router.Router
+}
+
+// New loads the config from the environment and sets up the AWS clients
+func New() (*Handlers, error) {
 	// set config
 	cfg := new(config.Cfg)
 	err := envconfig.Process("", cfg)
 	if err != nil {
-		msj := fmt.Sprintf("bad environment configuration: %v", err)
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, fmt.Errorf("bad environment configuration: %v", err)
 	}
 
 	// set clients
-	awsSvc, err := aws_services.NewAWS(cfg.AWSRegion)
+	awsSvc, err := aws_services.NewAWS(cfg.AWSRegion, cfg.DynamoDBEndpoint)
 	if err != nil {
-		msj := fmt.Sprintf("error setting AWS services: %v", err)
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, fmt.Errorf("error setting AWS services: %v", err)
 	}
 
-	var productSvc products.IProduct
-
-	// method routes
-	switch request.HTTPMethod {
-	case http.MethodPost:
-		return products.Post(ctx, request, productSvc, cfg, awsSvc)
-	case http.MethodGet:
-		return products.Get(ctx, request, productSvc, cfg, awsSvc)
-	case http.MethodPut:
-		return products.Put(ctx, request, productSvc, cfg, awsSvc)
-	case http.MethodDelete:
-		return products.Delete(ctx, request, productSvc, cfg, awsSvc)
-	default:
-		msj := fmt.Sprint("method not defined") //nolint:all
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+	return NewWithAWS(cfg, awsSvc), nil
+}
+
+// NewWithAWS builds the handlers on the given config and clients, such as fakes in tests
+func NewWithAWS(cfg *config.Cfg, awsSvc *aws_services.AWS) *Handlers {
+	productsSvc := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), products.NewS3ImageStore(cfg, awsSvc))
+	h := &Handlers{
+		Cfg:        cfg,
+		AWS:        awsSvc,
+		Products:   productsSvc,
+		Categories: categories.NewService(categories.NewDynamoDBRepository(cfg, awsSvc), productsSvc),
+		Orders:     orders.NewService(cfg, awsSvc, productsSvc),
+		Baskets:    baskets.NewService(cfg, awsSvc, productsSvc),
+		Inventory:  inventory.NewService(cfg, awsSvc, productsSvc),
+		Thumbnails: thumbnails.NewGenerator(cfg, awsSvc, productsSvc),
 	}
+
+	h.productsRouter = router.New()
+	products.RegisterRoutes(h.productsRouter, h.Products, cfg)
+	h.categoriesRouter = router.New()
+	categories.RegisterRoutes(h.categoriesRouter, h.Categories)
+	h.ordersRouter = router.New()
+	orders.RegisterRoutes(h.ordersRouter, h.Orders)
+	h.basketsRouter = router.New()
+	baskets.RegisterRoutes(h.basketsRouter, h.Baskets)
+	h.inventoryRouter = router.New()
+	inventory.RegisterRoutes(h.inventoryRouter, h.Inventory)
+
+	h.router = router.New()
+	products.RegisterRoutes(h.router, h.Products, cfg)
+	categories.RegisterRoutes(h.router, h.Categories)
+	orders.RegisterRoutes(h.router, h.Orders)
+	baskets.RegisterRoutes(h.router, h.Baskets)
+	inventory.RegisterRoutes(h.router, h.Inventory)
+	return h
+}
+
+func (h *Handlers) ProductsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return h.productsRouter.Serve(ctx, request)
+}
+
+func (h *Handlers) CategoriesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return h.categoriesRouter.Serve(ctx, request)
+}
+
+func (h *Handlers) OrdersHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return h.ordersRouter.Serve(ctx, request)
+}
+
+func (h *Handlers) BasketsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return h.basketsRouter.Serve(ctx, request)
+}
+
+func (h *Handlers) InventoryHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return h.inventoryRouter.Serve(ctx, request)
 }
 
-// TODO: make handlers for orders and baskets
+// Router has the routes of every store API on a single router. API Gateway splits these routes across one
+// Lambda per domain, while the local server serves all of them from one process
+func (h *Handlers) Router() *router.Router {
+	return h.router
+}
+
+// ReconcileReservationsHandler runs on a schedule and returns the stock of expired reservations to available
+func (h *Handlers) ReconcileReservationsHandler(ctx context.Context, event events.CloudWatchEvent) error {
+	released, err := h.Inventory.ReleaseExpired(ctx, time.Now().UTC())
+	if err != nil {
+		log.Error().Msgf("error releasing expired reservations, %d released: %v", released, err)
+		return err
+	}
+
+	log.Info().Msgf("released %d expired reservations", released)
+	return nil
+}
+
+// PurgeDeletedProductsHandler runs on a schedule and removes the products deleted longer than the retention period
+func (h *Handlers) PurgeDeletedProductsHandler(ctx context.Context, event events.CloudWatchEvent) error {
+	purged, err := h.Products.PurgeDeletedProducts(ctx, time.Now().UTC().Add(-h.Cfg.ProductsRetention))
+	if err != nil {
+		log.Error().Msgf("error purging deleted products after %d purged: %v", purged, err)
+		return err
+	}
+
+	log.Info().Msgf("purged %d deleted products", purged)
+	return nil
+}
+
+// ThumbnailsHandler runs on the files created in the images bucket and generates the thumbnails of the product
+// images among them. Files that are no image, or whose product or image is gone, are skipped rather than retried
+func (h *Handlers) ThumbnailsHandler(ctx context.Context, event events.S3Event) error {
+	for _, record := range event.Records {
+		bucket, key := record.S3.Bucket.Name, record.S3.Object.URLDecodedKey
+		if !strings.HasPrefix(key, products.ImagesPrefix) {
+			log.Warn().Msgf("skipped %v, not a product image", key)
+			continue
+		}
+
+		generated, err := h.Thumbnails.Generate(ctx, bucket, key)
+		switch {
+		case errors.Is(err, thumbnails.ErrUnsupportedImage), errors.Is(err, products.ErrNotFound), errors.Is(err, products.ErrImageNotFound):
+			log.Warn().Msgf("skipped thumbnails of %v: %v", key, err)
+			continue
+		case err != nil:
+			log.Error().Msgf("error generating thumbnails of %v: %v", key, err)
+			return err
+		}
+
+		log.Info().Msgf("generated %d thumbnails of %v", len(generated), key)
+	}
+	return nil
+}
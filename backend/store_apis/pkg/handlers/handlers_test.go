@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	"store_apis/pkg/categories"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHandlers() *Handlers {
+	cfg := &config.Cfg{
+		ProductsTable:          "products",
+		ProductsAuditTable:     "products-audit",
+		CategoriesTable:        "categories",
+		ProductCategoriesTable: "product-categories",
+		ReservationsTable:      "reservations",
+		ReservationTTL:         -time.Minute, // reservations are born expired
+		ProductsRetention:      -time.Minute, // deleted products are purged right away
+		ImagesBucket:           "images",
+		ThumbnailSizes:         []int{200},
+	}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.CategoriesTable, "id", "")
+	ddb.CreateIndex(cfg.CategoriesTable, categories.PathIndex, categories.TreeAttribute, "path")
+	ddb.CreateTable(cfg.ProductCategoriesTable, "productId", "categoryId")
+	ddb.CreateIndex(cfg.ProductCategoriesTable, categories.ProductIndex, "categoryId", "productId")
+	ddb.CreateTable(cfg.ReservationsTable, "id", "")
+
+	s3 := fake_aws_services.NewS3()
+	s3.CreateBucket(cfg.ImagesBucket)
+
+	return NewWithAWS(cfg, &aws_services.AWS{DDBClient: ddb, S3Client: s3, S3Presigner: s3})
+}
+
+func Test_ProductsHandler(t *testing.T) {
+	h := newTestHandlers()
+
+	resp, err := h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:   "/products",
+		Path:       "/products",
+		HTTPMethod: http.MethodPost,
+		Body:       `{"name": "valid product", "description": "valid product description", "price": 1999, "currency": "USD", "sku": "VP-001", "stock": 10}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	created := new(products.Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), created))
+
+	resp, err = h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/products/{id}",
+		Path:           "/products/" + created.Id,
+		HTTPMethod:     http.MethodGet,
+		PathParameters: map[string]string{"id": created.Id},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/products/{id}",
+		Path:           "/products/" + created.Id,
+		HTTPMethod:     http.MethodPatch,
+		Headers:        map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"1"`},
+		PathParameters: map[string]string{"id": created.Id},
+		Body:           `{"price": 2499}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "request-1",
+			Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the change is recorded with who made it, in which request
+	resp, err = h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/products/{id}/history",
+		Path:           "/products/" + created.Id + "/history",
+		HTTPMethod:     http.MethodGet,
+		PathParameters: map[string]string{"id": created.Id},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	history := new(products.ChangesPage)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), history))
+	assert.Len(t, history.Items, 2)
+	assert.Equal(t, products.ActionUpdate, history.Items[0].Action)
+	assert.Equal(t, "user-1", history.Items[0].Actor)
+	assert.Equal(t, "request-1", history.Items[0].RequestId)
+	assert.Equal(t, utils.AnonymousActor, history.Items[1].Actor)
+
+	// routes of other domains are not served by the products Lambda
+	resp, err = h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:   "/orders",
+		Path:       "/orders",
+		HTTPMethod: http.MethodGet,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_CategoriesHandler(t *testing.T) {
+	h := newTestHandlers()
+
+	product, err := h.Products.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+
+	resp, err := h.CategoriesHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:   "/categories",
+		Path:       "/categories",
+		HTTPMethod: http.MethodPost,
+		Body:       `{"name": "Clothing"}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	created := new(categories.Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), created))
+
+	resp, err = h.CategoriesHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/categories/{id}/products/{productId}",
+		Path:           "/categories/" + created.Id + "/products/" + product.Id,
+		HTTPMethod:     http.MethodPut,
+		PathParameters: map[string]string{"id": created.Id, "productId": product.Id},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = h.CategoriesHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/categories/{id}/products",
+		Path:           "/categories/" + created.Id + "/products",
+		HTTPMethod:     http.MethodGet,
+		PathParameters: map[string]string{"id": created.Id},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	page := new(products.ItemsPage)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, product.Id, page.Items[0].Id)
+}
+
+func Test_ReconcileReservationsHandler(t *testing.T) {
+	h := newTestHandlers()
+
+	resp, err := h.ProductsHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:   "/products",
+		Path:       "/products",
+		HTTPMethod: http.MethodPost,
+		Body:       `{"name": "valid product", "description": "valid product description", "price": 1999, "currency": "USD", "sku": "VP-001", "stock": 10}`,
+	})
+	assert.NoError(t, err)
+
+	created := new(products.Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), created))
+
+	resp, err = h.InventoryHandler(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:   "/inventory/reservations",
+		Path:       "/inventory/reservations",
+		HTTPMethod: http.MethodPost,
+		Body:       `{"productId": "` + created.Id + `", "quantity": 4}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	assert.NoError(t, h.ReconcileReservationsHandler(context.TODO(), events.CloudWatchEvent{}))
+
+	found, err := h.Products.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), found.Stock)
+	assert.Equal(t, int64(0), found.Reserved)
+	assert.Equal(t, int64(3), found.Version) // reserving and releasing stock are writes too
+}
+
+func Test_PurgeDeletedProductsHandler(t *testing.T) {
+	h := newTestHandlers()
+
+	created, err := h.Products.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, h.Products.DeleteProduct(context.TODO(), created.Id, created.Version))
+
+	assert.NoError(t, h.PurgeDeletedProductsHandler(context.TODO(), events.CloudWatchEvent{}))
+
+	_, err = h.Products.GetProduct(context.TODO(), created.Id, products.ReadOptions{IncludeDeleted: true})
+	assert.ErrorIs(t, err, products.ErrNotFound)
+}
+
+func Test_ThumbnailsHandler(t *testing.T) {
+	h := newTestHandlers()
+
+	created, err := h.Products.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 400, 300))))
+	upload, _, err := h.Products.AddImage(context.TODO(), created.Id, created.Version, &products.Image{ContentType: "image/png", Size: int64(buf.Len())})
+	assert.NoError(t, err)
+
+	_, err = h.AWS.S3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:      aws.String(h.Cfg.ImagesBucket),
+		Key:         aws.String(upload.Image.Key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("image/png"),
+	})
+	assert.NoError(t, err)
+	_, err = h.AWS.S3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(h.Cfg.ImagesBucket),
+		Key:    aws.String("products/" + created.Id + "/not an image.png"),
+		Body:   bytes.NewReader([]byte("not an image")),
+	})
+	assert.NoError(t, err)
+
+	// unmarshalled as Lambda does, which decodes the keys. Files that are no product images are skipped
+	event := events.S3Event{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"Records": [
+		{"s3": {"bucket": {"name": "images"}, "object": {"key": "thumbnails/200/`+upload.Image.Key+`"}}},
+		{"s3": {"bucket": {"name": "images"}, "object": {"key": "products/`+created.Id+`/not+an+image.png"}}},
+		{"s3": {"bucket": {"name": "images"}, "object": {"key": "`+upload.Image.Key+`"}}}
+	]}`), &event))
+	assert.NoError(t, h.ThumbnailsHandler(context.TODO(), event))
+
+	item, err := h.Products.GetProduct(context.TODO(), created.Id, products.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []products.Thumbnail{
+		{Size: 200, Key: "thumbnails/200/" + upload.Image.Key, Width: 200, Height: 150},
+	}, item.Images[0].Thumbnails)
+
+	// files that cannot be read yet are retried
+	event.Records = event.Records[2:]
+	event.Records[0].S3.Bucket.Name = "missing"
+	assert.Error(t, h.ThumbnailsHandler(context.TODO(), event))
+}
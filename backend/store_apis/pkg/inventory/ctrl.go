@@ -0,0 +1,40 @@
+package inventory
+
+import (
+	"context"
+	"net/http"
+	"store_apis/pkg/router"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func RegisterRoutes(r *router.Router, i IInventory) {
+	r.Handle(http.MethodGet, "/inventory/{productId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Get(ctx, request, i)
+	})
+	r.Handle(http.MethodPost, "/inventory/reservations", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PostReservation(ctx, request, i)
+	})
+	r.Handle(http.MethodPost, "/inventory/reservations/{id}/release", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PostRelease(ctx, request, i)
+	})
+	r.Handle(http.MethodPost, "/inventory/reservations/{id}/commit", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PostCommit(ctx, request, i)
+	})
+}
+
+func Get(ctx context.Context, request events.APIGatewayProxyRequest, i IInventory) (events.APIGatewayProxyResponse, error) {
+	return i.readStock(ctx, request)
+}
+
+func PostReservation(ctx context.Context, request events.APIGatewayProxyRequest, i IInventory) (events.APIGatewayProxyResponse, error) {
+	return i.reserveStock(ctx, request)
+}
+
+func PostRelease(ctx context.Context, request events.APIGatewayProxyRequest, i IInventory) (events.APIGatewayProxyResponse, error) {
+	return i.releaseReservation(ctx, request)
+}
+
+func PostCommit(ctx context.Context, request events.APIGatewayProxyRequest, i IInventory) (events.APIGatewayProxyResponse, error) {
+	return i.commitReservation(ctx, request)
+}
@@ -0,0 +1,17 @@
+package inventory
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type IInventory interface {
+	readStock(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	reserveStock(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	releaseReservation(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	commitReservation(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	// ReleaseExpired is run on a schedule to give back the units of the reservations expired before now
+	ReleaseExpired(ctx context.Context, now time.Time) (int, error)
+}
@@ -0,0 +1,218 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"gopkg.in/validator.v2"
+)
+
+// Reservation holds units of a product, or of one of its variants when VariantId is set
+type Reservation struct {
+	ProductId string `json:"productId" validate:"nonzero"`
+	VariantId string `json:"variantId"`
+	Quantity  int64  `json:"quantity" validate:"min=1"`
+}
+
+type Stock struct {
+	ProductId string `json:"productId"`
+	VariantId string `json:"variantId,omitempty"`
+	Available int64  `json:"available"`
+	Reserved  int64  `json:"reserved"`
+}
+
+// Service is the IInventory serving the stock of the products and the reservations holding part of it.
+// The stock is read and changed through the products service
+type Service struct {
+	cfg      *config.Cfg
+	awsSvc   *aws_services.AWS
+	products products.IProduct
+}
+
+func NewService(cfg *config.Cfg, awsSvc *aws_services.AWS, products products.IProduct) *Service {
+	return &Service{cfg: cfg, awsSvc: awsSvc, products: products}
+}
+
+var _ IInventory = (*Service)(nil)
+
+// readStock reports the stock of the product, or of its variant given by the variantId query string parameter
+func (s *Service) readStock(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	productId := request.PathParameters["productId"]
+	variantId := request.QueryStringParameters["variantId"]
+	if len(productId) == 0 {
+		msj := fmt.Sprint("empty productId on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	p, err := s.products.GetProduct(ctx, productId, products.ReadOptions{})
+	if errors.Is(err, products.ErrNotFound) {
+		msj := fmt.Sprintf("no entries found with id: %v", productId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error looking up products", http.StatusNotFound))
+	}
+
+	stock := &Stock{
+		ProductId: p.Id,
+		Available: p.Stock,
+		Reserved:  p.Reserved,
+	}
+	if len(variantId) > 0 {
+		variant, ok := p.Variant(variantId)
+		if !ok {
+			msj := fmt.Sprintf("no variant found with id: %v, of product %v", variantId, productId)
+			return utils.SendErr(&utils.APIResponse{
+				StatusCode: http.StatusNotFound,
+				Data:       msj,
+				LogMessage: msj,
+			})
+		}
+		stock.VariantId = variant.Id
+		stock.Available = variant.Stock
+		stock.Reserved = variant.Reserved
+	}
+
+	out, err := json.Marshal(stock)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling stock: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusOK,
+		Data:       string(out),
+		LogMessage: string(out),
+	})
+}
+
+func (s *Service) reserveStock(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	reservation := new(Reservation)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(reservation); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if err := validator.WithPrintJSON(true).Validate(reservation); err != nil {
+		msj := "error reservation validation"
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: fmt.Sprintf("%v: %v", msj, err),
+			Errors:     utils.ValidationErrors(err),
+		})
+	}
+
+	item, err := s.Reserve(ctx, reservation.ProductId, reservation.VariantId, reservation.Quantity)
+	if errors.Is(err, products.ErrNotFound) {
+		msj := fmt.Sprintf("product not found: %v", reservation.ProductId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if errors.Is(err, products.ErrVariantNotFound) {
+		msj := fmt.Sprintf("variant not found: %v, of product %v", reservation.VariantId, reservation.ProductId)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if errors.Is(err, ErrInsufficientStock) {
+		msj := fmt.Sprintf("%v for product %v, quantity: %d", ErrInsufficientStock.Error(), reservation.ProductId, reservation.Quantity)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error reserving stock", http.StatusConflict))
+	}
+
+	out, err := json.Marshal(item)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling reservation: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusCreated,
+		Data:       string(out),
+		LogMessage: fmt.Sprintf("successfully created reservation with id: %s", item.Id),
+	})
+}
+
+func (s *Service) releaseReservation(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return settleReservation(ctx, request, s.Release, "released")
+}
+
+func (s *Service) commitReservation(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return settleReservation(ctx, request, s.Commit, "committed")
+}
+
+type settleFunc func(ctx context.Context, id string) (*Item, error)
+
+func settleReservation(ctx context.Context, request events.APIGatewayProxyRequest, settle settleFunc, verb string) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	_, err := settle(ctx, id)
+	if errors.Is(err, ErrReservationNotFound) {
+		msj := fmt.Sprintf("%v, id: %v", err.Error(), id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, fmt.Sprintf("error settling reservation with id: %v", id), http.StatusConflict))
+	}
+
+	msj := fmt.Sprintf("reservation with id: %v, was successfully %s", id, verb)
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusOK,
+		Data:       msj,
+		LogMessage: msj,
+	})
+}
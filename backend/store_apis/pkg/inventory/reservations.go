@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInsufficientStock is the error of the products service, so either can be matched
+	ErrInsufficientStock   = products.ErrInsufficientStock
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// Item is a reservation holding Quantity units of a product, or of the variant VariantId names, out of its
+// available stock until it is committed, released or expires. ExpiresAt, in epoch seconds, is when
+// ReleaseExpired gives the units back. It is no TTL attribute, as DynamoDB deleting the item on its own would
+// leave the units reserved
+type Item struct {
+	Id          string `dynamodbav:"id"`
+	ProductId   string `dynamodbav:"productId"`
+	VariantId   string `dynamodbav:"variantId,omitempty" json:",omitempty"`
+	Quantity    int64  `dynamodbav:"quantity"`
+	DateCreated int64  `dynamodbav:"dateCreated"`
+	ExpiresAt   int64  `dynamodbav:"expiresAt"`
+}
+
+// Reserve moves qty units of the product, or of its variant when variantId is set, from available to reserved,
+// putting the reservation in the same transaction. The products service checks the stock and guards the
+// product on its version, so concurrent reservations can never oversell
+func (s *Service) Reserve(ctx context.Context, productId, variantId string, qty int64) (*Item, error) {
+	now := time.Now().UTC()
+	item := &Item{
+		Id:          uuid.New().String(),
+		ProductId:   productId,
+		VariantId:   variantId,
+		Quantity:    qty,
+		DateCreated: now.Unix(),
+		ExpiresAt:   now.Add(s.cfg.ReservationTTL).Unix(),
+	}
+
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	putExpr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("id")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	_, err = s.products.ChangeStock(ctx, products.ActionReserve, []products.StockChange{{
+		ProductId: productId,
+		VariantId: variantId,
+		Stock:     -qty,
+		Reserved:  qty,
+	}}, []types.TransactWriteItem{{
+		Put: &types.Put{
+			TableName:                aws.String(s.cfg.ReservationsTable),
+			Item:                     avMap,
+			ExpressionAttributeNames: putExpr.Names(),
+			ConditionExpression:      putExpr.Condition(),
+		},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("error reserving stock for product %v: %w", productId, err)
+	}
+
+	return item, nil
+}
+
+// Release returns the reserved units back to available stock
+func (s *Service) Release(ctx context.Context, id string) (*Item, error) {
+	return s.settle(ctx, id, products.ActionRelease, true)
+}
+
+// Commit consumes the reserved units, once the order holding them has been placed
+func (s *Service) Commit(ctx context.Context, id string) (*Item, error) {
+	return s.settle(ctx, id, products.ActionCommit, false)
+}
+
+// settle deletes the reservation and takes its units out of the reserved ones of the product, returning
+// them to available stock when restock is set. Deleting conditionally makes sure a reservation is only
+// ever settled once
+func (s *Service) settle(ctx context.Context, id, action string, restock bool) (*Item, error) {
+	item, err := GetItem(ctx, s.cfg, s.awsSvc, id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrReservationNotFound
+	}
+
+	change := products.StockChange{ProductId: item.ProductId, VariantId: item.VariantId, Reserved: -item.Quantity}
+	if restock {
+		change.Stock = item.Quantity
+	}
+
+	deleteExpr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeExists(expression.Name("id")),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	_, err = s.products.ChangeStock(ctx, action, []products.StockChange{change}, []types.TransactWriteItem{{
+		Delete: &types.Delete{
+			TableName: aws.String(s.cfg.ReservationsTable),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: id},
+			},
+			ExpressionAttributeNames: deleteExpr.Names(),
+			ConditionExpression:      deleteExpr.Condition(),
+		},
+	}})
+	if err != nil {
+		var jwe *products.JoinedWriteError
+		if errors.As(err, &jwe) {
+			return nil, ErrReservationNotFound
+		}
+		return nil, fmt.Errorf("error settling reservation %v: %w", id, err)
+	}
+
+	return item, nil
+}
+
+// GetItem fetches a reservation by id. Returns nil when it does not exist
+func GetItem(ctx context.Context, cfg *config.Cfg, awsSvc *aws_services.AWS, id string) (*Item, error) {
+	getOutput, err := awsSvc.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(cfg.ReservationsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting item: %w", err)
+	}
+
+	if len(getOutput.Item) == 0 {
+		return nil, nil
+	}
+
+	item := new(Item)
+	if err := attributevalue.UnmarshalMap(getOutput.Item, item); err != nil {
+		return nil, fmt.Errorf("error unmarshalling get output: %v", err)
+	}
+
+	return item, nil
+}
+
+// ReleaseErrors lists the errors of the expired reservations ReleaseExpired could not release
+type ReleaseErrors []error
+
+func (e ReleaseErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d reservations not released: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e ReleaseErrors) Unwrap() []error {
+	return e
+}
+
+// ReleaseExpired releases every reservation that expired before now, returning how many were released.
+// Each is deleted in the same transaction as its units go back to stock, so expired reservations stay in
+// the table until this runs, and those committed or released meanwhile are skipped. A reservation failing
+// to release does not hold back the others: its error is logged and returned in ReleaseErrors once every
+// expired reservation was tried
+func (s *Service) ReleaseExpired(ctx context.Context, now time.Time) (int, error) {
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.Name("expiresAt").LessThanEqual(expression.Value(now.Unix())),
+	).Build()
+	if err != nil {
+		return 0, fmt.Errorf("error building filter expression: %v", err)
+	}
+
+	released := 0
+	var failed ReleaseErrors
+	var startKey map[string]types.AttributeValue
+	for {
+		scanOutput, err := s.awsSvc.DDBClient.Scan(ctx, &dynamodb.ScanInput{
+			TableName:                 aws.String(s.cfg.ReservationsTable),
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return released, fmt.Errorf("error scanning items: %w", err)
+		}
+
+		items := []Item{}
+		if err := attributevalue.UnmarshalListOfMaps(scanOutput.Items, &items); err != nil {
+			return released, fmt.Errorf("error unmarshalling scan output: %v", err)
+		}
+
+		for _, item := range items {
+			_, err := s.Release(ctx, item.Id)
+			// committed or released concurrently, nothing left to give back
+			if errors.Is(err, ErrReservationNotFound) {
+				continue
+			}
+			if err != nil {
+				log.Error().Msgf("error releasing expired reservation %v: %v", item.Id, err)
+				failed = append(failed, err)
+				continue
+			}
+			released++
+		}
+
+		if len(scanOutput.LastEvaluatedKey) == 0 {
+			if len(failed) > 0 {
+				return released, failed
+			}
+			return released, nil
+		}
+		startKey = scanOutput.LastEvaluatedKey
+	}
+}
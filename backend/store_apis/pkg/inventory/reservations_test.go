@@ -0,0 +1,388 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	mock_aws_services "store_apis/pkg/aws/mocks"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func testCfg(t *testing.T) *config.Cfg {
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "products")
+	os.Setenv("PRODUCTS_AUDIT_TABLE", "products-audit")
+	os.Setenv("RESERVATIONS_TABLE", "reservations")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+	return cfg
+}
+
+// newService builds the inventory service on a products service sharing its DynamoDB client
+func newService(cfg *config.Cfg, awsSvc *aws_services.AWS) *Service {
+	return NewService(cfg, awsSvc, products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil))
+}
+
+// expectProducts has the mock read product 100 with the given stock and reserved units
+func expectProducts(mockDdbClient *mock_aws_services.MockDynamoDBClientAPI, stock, reserved string) {
+	mockDdbClient.
+		EXPECT().
+		BatchGetItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			items := []map[string]types.AttributeValue{}
+			for _, key := range in.RequestItems["products"].Keys {
+				if key["id"].(*types.AttributeValueMemberS).Value != "100" {
+					continue
+				}
+				items = append(items, map[string]types.AttributeValue{
+					"id":       key["id"],
+					"version":  &types.AttributeValueMemberN{Value: "4"},
+					"stock":    &types.AttributeValueMemberN{Value: stock},
+					"reserved": &types.AttributeValueMemberN{Value: reserved},
+				})
+			}
+			return &dynamodb.BatchGetItemOutput{
+				Responses: map[string][]map[string]types.AttributeValue{"products": items},
+			}, nil
+		}).
+		AnyTimes()
+}
+
+func Test_Reserve(t *testing.T) {
+	subtests := []struct {
+		name      string
+		productId string
+		quantity  int64
+		expected  error
+	}{
+		{
+			name:      "reserved",
+			productId: "100",
+			quantity:  2,
+		},
+		{
+			name:      "insufficient_stock",
+			productId: "100",
+			quantity:  5,
+			expected:  ErrInsufficientStock,
+		},
+		{
+			name:      "product_not_found",
+			productId: "404",
+			quantity:  1,
+			expected:  products.ErrNotFound,
+		},
+	}
+
+	cfg := testCfg(t)
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+			expectProducts(mockDdbClient, "3", "0")
+
+			// the stock is checked before writing, so only a reservation that fits is written
+			mockDdbClient.
+				EXPECT().
+				TransactWriteItems(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					assert.Len(t, in.TransactItems, 3)
+					assert.Equal(t, "reservations", *in.TransactItems[0].Put.TableName)
+					update := in.TransactItems[1].Update
+					assert.Equal(t, "products", *update.TableName)
+					assert.Contains(t, update.ExpressionAttributeValues, ":0")
+					assert.Equal(t, "products-audit", *in.TransactItems[2].Put.TableName)
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				}).
+				MaxTimes(1)
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mockDdbClient,
+			}
+
+			item, err := newService(cfg, awsSvc).Reserve(context.TODO(), st.productId, "", st.quantity)
+			if st.expected != nil {
+				assert.ErrorIs(t, err, st.expected)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "100", item.ProductId)
+			assert.Greater(t, item.ExpiresAt, time.Now().Unix())
+		})
+	}
+}
+
+func Test_ReleaseExpired(t *testing.T) {
+	cfg := testCfg(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+	expectProducts(mockDdbClient, "0", "5")
+
+	reservation := func(id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"id":        &types.AttributeValueMemberS{Value: id},
+			"productId": &types.AttributeValueMemberS{Value: "100"},
+			"quantity":  &types.AttributeValueMemberN{Value: "1"},
+		}
+	}
+
+	gomock.InOrder(
+		mockDdbClient.
+			EXPECT().
+			Scan(gomock.Any(), gomock.Any()).
+			Return(&dynamodb.ScanOutput{
+				Items:            []map[string]types.AttributeValue{reservation("r1")},
+				LastEvaluatedKey: map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "r1"}},
+			}, nil),
+		mockDdbClient.
+			EXPECT().
+			Scan(gomock.Any(), gomock.Any()).
+			Return(&dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{reservation("r2")},
+			}, nil),
+	)
+
+	mockDdbClient.
+		EXPECT().
+		GetItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			id := in.Key["id"].(*types.AttributeValueMemberS).Value
+			return &dynamodb.GetItemOutput{Item: reservation(id)}, nil
+		}).
+		Times(2)
+
+	// r1 gets released, r2 was committed meanwhile
+	gomock.InOrder(
+		mockDdbClient.
+			EXPECT().
+			TransactWriteItems(gomock.Any(), gomock.Any()).
+			Return(&dynamodb.TransactWriteItemsOutput{}, nil),
+		mockDdbClient.
+			EXPECT().
+			TransactWriteItems(gomock.Any(), gomock.Any()).
+			Return(nil, &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("ConditionalCheckFailed")},
+					{Code: aws.String("None")},
+				},
+			}),
+	)
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: mockDdbClient,
+	}
+
+	released, err := newService(cfg, awsSvc).ReleaseExpired(context.TODO(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+}
+
+func Test_ReleaseExpired_KeepsGoing(t *testing.T) {
+	cfg := testCfg(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+	expectProducts(mockDdbClient, "0", "5")
+
+	reservation := func(id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"id":        &types.AttributeValueMemberS{Value: id},
+			"productId": &types.AttributeValueMemberS{Value: "100"},
+			"quantity":  &types.AttributeValueMemberN{Value: "1"},
+		}
+	}
+
+	mockDdbClient.
+		EXPECT().
+		Scan(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.ScanOutput{
+			Items: []map[string]types.AttributeValue{reservation("r1"), reservation("r2"), reservation("r3")},
+		}, nil)
+	mockDdbClient.
+		EXPECT().
+		GetItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			id := in.Key["id"].(*types.AttributeValueMemberS).Value
+			return &dynamodb.GetItemOutput{Item: reservation(id)}, nil
+		}).
+		Times(3)
+
+	// r2 fails, r1 and r3 are released all the same
+	gomock.InOrder(
+		mockDdbClient.
+			EXPECT().
+			TransactWriteItems(gomock.Any(), gomock.Any()).
+			Return(&dynamodb.TransactWriteItemsOutput{}, nil),
+		mockDdbClient.
+			EXPECT().
+			TransactWriteItems(gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("some detailed error")),
+		mockDdbClient.
+			EXPECT().
+			TransactWriteItems(gomock.Any(), gomock.Any()).
+			Return(&dynamodb.TransactWriteItemsOutput{}, nil),
+	)
+
+	released, err := newService(cfg, &aws_services.AWS{DDBClient: mockDdbClient}).ReleaseExpired(context.TODO(), time.Now())
+	assert.Equal(t, 2, released)
+
+	var failed ReleaseErrors
+	assert.True(t, errors.As(err, &failed), err)
+	assert.Len(t, failed, 1)
+	assert.ErrorContains(t, err, "some detailed error")
+}
+
+func Test_ReleaseExpired_Fake(t *testing.T) {
+	cfg := &config.Cfg{
+		ProductsTable:      "products",
+		ProductsAuditTable: "products-audit",
+		ReservationsTable:  "reservations",
+		ReservationTTL:     -time.Minute, // reservations are born expired
+	}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.ReservationsTable, "id", "")
+	awsSvc := &aws_services.AWS{DDBClient: ddb}
+
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+
+	inv := NewService(cfg, awsSvc, p)
+	expired, err := inv.Reserve(context.TODO(), created.Id, "", 2)
+	assert.NoError(t, err)
+	gone, err := inv.Reserve(context.TODO(), created.Id, "", 3)
+	assert.NoError(t, err)
+
+	// the second reservation disappears before reconciliation, taking its units back with it
+	_, err = inv.Release(context.TODO(), gone.Id)
+	assert.NoError(t, err)
+
+	stock := func() (int64, int64) {
+		item, err := p.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+		assert.NoError(t, err)
+		return item.Stock, item.Reserved
+	}
+	available, reserved := stock()
+	assert.Equal(t, []int64{8, 2}, []int64{available, reserved})
+
+	// the expired reservation is still there for the reconciler to give back, which deletes it
+	released, err := newService(cfg, awsSvc).ReleaseExpired(context.TODO(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	item, err := GetItem(context.TODO(), cfg, awsSvc, expired.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+
+	available, reserved = stock()
+	assert.Equal(t, []int64{10, 0}, []int64{available, reserved})
+
+	// nothing is given back twice
+	released, err = inv.ReleaseExpired(context.TODO(), time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, released)
+
+	available, reserved = stock()
+	assert.Equal(t, []int64{10, 0}, []int64{available, reserved})
+
+	// every move of the units is in the history of the product
+	history, err := p.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	actions := []string{}
+	for _, change := range history.Items {
+		actions = append(actions, change.Action)
+	}
+	assert.Equal(t, []string{products.ActionRelease, products.ActionRelease, products.ActionReserve, products.ActionReserve, products.ActionCreate}, actions)
+}
+
+func Test_Reserve_Variant_Fake(t *testing.T) {
+	cfg := &config.Cfg{
+		ProductsTable:      "products",
+		ProductsAuditTable: "products-audit",
+		ReservationsTable:  "reservations",
+		ReservationTTL:     time.Minute,
+	}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	ddb.CreateTable(cfg.ReservationsTable, "id", "")
+	awsSvc := &aws_services.AWS{DDBClient: ddb}
+
+	p := products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil)
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+	variant, _, err := p.CreateVariant(context.TODO(), created.Id, created.Version, &products.Variant{
+		Sku:     "VP-001-M",
+		Stock:   3,
+		Options: map[string]string{"size": "M"},
+	})
+	assert.NoError(t, err)
+
+	inv := NewService(cfg, awsSvc, p)
+	_, err = inv.Reserve(context.TODO(), created.Id, "unknown", 1)
+	assert.ErrorIs(t, err, products.ErrVariantNotFound)
+	_, err = inv.Reserve(context.TODO(), created.Id, variant.Id, 4)
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	reserved, err := inv.Reserve(context.TODO(), created.Id, variant.Id, 2)
+	assert.NoError(t, err)
+
+	stored, err := p.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10, 0}, []int64{stored.Stock, stored.Reserved})
+	storedVariant, _ := stored.Variant(variant.Id)
+	assert.Equal(t, []int64{1, 2}, []int64{storedVariant.Stock, storedVariant.Reserved})
+
+	// the variant cannot go while its reservation holds units of it
+	_, err = p.DeleteVariant(context.TODO(), created.Id, variant.Id, stored.Version)
+	assert.ErrorIs(t, err, products.ErrVariantReserved)
+
+	_, err = inv.Release(context.TODO(), reserved.Id)
+	assert.NoError(t, err)
+
+	stored, err = p.GetProduct(context.TODO(), created.Id, products.ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	storedVariant, _ = stored.Variant(variant.Id)
+	assert.Equal(t, []int64{3, 0}, []int64{storedVariant.Stock, storedVariant.Reserved})
+
+	_, err = p.DeleteVariant(context.TODO(), created.Id, variant.Id, stored.Version)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,127 @@
+package localserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"store_apis/pkg/router"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Server serves a router over net/http, translating each http.Request into the API Gateway proxy
+// request the Lambdas receive in AWS, and their proxy response back
+type Server struct {
+	router *router.Router
+}
+
+func New(r *router.Router) *Server {
+	return &Server{router: r}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resource, pathParams, ok := s.router.Match(req.URL.Path)
+	if !ok {
+		// unmatched paths are served as their own resource, which the router answers with a 404
+		resource = req.URL.Path
+	}
+
+	request, err := NewProxyRequest(req, resource, pathParams)
+	if err != nil {
+		msj := fmt.Sprintf("error reading request: %v", err.Error())
+		log.Error().Msg(msj)
+		http.Error(w, msj, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.router.Serve(req.Context(), request)
+	if err != nil {
+		msj := fmt.Sprintf("error serving request: %v", err.Error())
+		log.Error().Msg(msj)
+		http.Error(w, msj, http.StatusBadGateway)
+		return
+	}
+
+	if err := WriteProxyResponse(w, resp); err != nil {
+		log.Error().Msgf("error writing response: %v", err.Error())
+	}
+}
+
+// NewProxyRequest builds the API Gateway proxy request for req, matched to the resource template and
+// its path parameters. Header names are lowercased, as the HTTP API sends them to the Lambdas
+func NewProxyRequest(req *http.Request, resource string, pathParams map[string]string) (events.APIGatewayProxyRequest, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Resource:                        resource,
+		Path:                            req.URL.Path,
+		HTTPMethod:                      req.Method,
+		Headers:                         map[string]string{},
+		MultiValueHeaders:               map[string][]string{},
+		QueryStringParameters:           map[string]string{},
+		MultiValueQueryStringParameters: map[string][]string{},
+		PathParameters:                  pathParams,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:    uuid.New().String(),
+			ResourcePath: resource,
+			HTTPMethod:   req.Method,
+			Path:         req.URL.Path,
+			Stage:        "local",
+		},
+	}
+
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		request.Headers[name] = strings.Join(v, ",")
+		request.MultiValueHeaders[name] = v
+	}
+
+	for k, v := range req.URL.Query() {
+		request.QueryStringParameters[k] = strings.Join(v, ",")
+		request.MultiValueQueryStringParameters[k] = v
+	}
+
+	if utf8.Valid(body) {
+		request.Body = string(body)
+	} else {
+		request.Body = base64.StdEncoding.EncodeToString(body)
+		request.IsBase64Encoded = true
+	}
+
+	return request, nil
+}
+
+// WriteProxyResponse writes a Lambda proxy response as the HTTP response
+func WriteProxyResponse(w http.ResponseWriter, resp events.APIGatewayProxyResponse) error {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	for k, vs := range resp.MultiValueHeaders {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return fmt.Errorf("error decoding base64 body: %v", err)
+		}
+		body = decoded
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, err := w.Write(body)
+	return err
+}
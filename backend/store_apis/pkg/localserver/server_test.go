@@ -0,0 +1,101 @@
+package localserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	"store_apis/pkg/config"
+	"store_apis/pkg/handlers"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewProxyRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/baskets/b1/items/100?limit=5&tag=a&tag=b", strings.NewReader(`{"quantity": 2}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	request, err := NewProxyRequest(req, "/baskets/{id}/items/{productId}", map[string]string{"id": "b1", "productId": "100"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/baskets/{id}/items/{productId}", request.Resource)
+	assert.Equal(t, "/baskets/b1/items/100", request.Path)
+	assert.Equal(t, http.MethodPut, request.HTTPMethod)
+	assert.Equal(t, "application/json", request.Headers["content-type"])
+	assert.Equal(t, "5", request.QueryStringParameters["limit"])
+	assert.Equal(t, []string{"a", "b"}, request.MultiValueQueryStringParameters["tag"])
+	assert.Equal(t, "100", request.PathParameters["productId"])
+	assert.Equal(t, `{"quantity": 2}`, request.Body)
+	assert.False(t, request.IsBase64Encoded)
+	assert.NotEmpty(t, request.RequestContext.RequestID)
+}
+
+func Test_WriteProxyResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	err := WriteProxyResponse(rec, events.APIGatewayProxyResponse{
+		StatusCode:      http.StatusOK,
+		Headers:         map[string]string{"Content-Type": "image/png"},
+		Body:            "aGVsbG8=",
+		IsBase64Encoded: true,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "hello", rec.Body.String())
+}
+
+func Test_Server_Products(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products", ProductsAuditTable: "products-audit"}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+
+	srv := httptest.NewServer(New(handlers.NewWithAWS(cfg, &aws_services.AWS{DDBClient: ddb}).Router()))
+	defer srv.Close()
+
+	body := `{"name": "valid product", "description": "valid product description", "price": 1999, "currency": "USD", "sku": "VP-001", "stock": 10}`
+	resp, err := http.Post(srv.URL+"/products", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/products")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	page := new(products.ItemsPage)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(page))
+	resp.Body.Close()
+	assert.Len(t, page.Items, 1)
+
+	resp, err = http.Get(srv.URL + "/products/" + page.Items[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	item := new(products.Item)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(item))
+	resp.Body.Close()
+	assert.Equal(t, "VP-001", item.Sku)
+
+	resp, err = http.Get(srv.URL + "/unknown")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPatch, srv.URL+"/products", nil)
+	assert.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "GET, POST", resp.Header.Get("Allow"))
+}
@@ -0,0 +1,33 @@
+package orders
+
+import (
+	"context"
+	"net/http"
+	"store_apis/pkg/router"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func RegisterRoutes(r *router.Router, o IOrder) {
+	r.Handle(http.MethodPost, "/orders", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Post(ctx, request, o)
+	})
+	r.Handle(http.MethodGet, "/orders", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return List(ctx, request, o)
+	})
+	r.Handle(http.MethodGet, "/orders/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Get(ctx, request, o)
+	})
+}
+
+func Post(ctx context.Context, request events.APIGatewayProxyRequest, o IOrder) (events.APIGatewayProxyResponse, error) {
+	return o.createOneOrder(ctx, request)
+}
+
+func Get(ctx context.Context, request events.APIGatewayProxyRequest, o IOrder) (events.APIGatewayProxyResponse, error) {
+	return o.readOneOrder(ctx, request)
+}
+
+func List(ctx context.Context, request events.APIGatewayProxyRequest, o IOrder) (events.APIGatewayProxyResponse, error) {
+	return o.listOrders(ctx, request)
+}
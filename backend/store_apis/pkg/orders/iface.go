@@ -0,0 +1,13 @@
+package orders
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type IOrder interface {
+	createOneOrder(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	readOneOrder(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	listOrders(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+}
@@ -0,0 +1,390 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"gopkg.in/validator.v2"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusShipped   = "shipped"
+	StatusCancelled = "cancelled"
+)
+
+// ErrMixedCurrencies means the line items are priced in different currencies, whose totals do not add up
+var ErrMixedCurrencies = errors.New("line items are priced in different currencies")
+
+type Order struct {
+	CustomerId string     `json:"customerId" validate:"nonzero"`
+	LineItems  []LineItem `json:"lineItems" validate:"min=1"`
+}
+
+type LineItem struct {
+	ProductId string `json:"productId" validate:"nonzero"`
+	VariantId string `json:"variantId"` // orders a variant of the product, at its price
+	Quantity  int64  `json:"quantity" validate:"min=1"`
+}
+
+type Item struct {
+	Id           string      `dynamodbav:"id"`
+	DateCreated  int64       `dynamodbav:"dateCreated"`
+	DateModified int64       `dynamodbav:"dateModified"`
+	CustomerId   string      `dynamodbav:"customerId"`
+	LineItems    []OrderLine `dynamodbav:"lineItems"`
+	Total        int64       `dynamodbav:"total"`
+	Currency     string      `dynamodbav:"currency"` // of the total and of every line
+	Status       string      `dynamodbav:"status"`
+}
+
+// OrderLine is a line item with the product price snapshotted at order time, in minor units
+type OrderLine struct {
+	ProductId string `dynamodbav:"productId"`
+	VariantId string `dynamodbav:"variantId,omitempty" json:",omitempty"`
+	Quantity  int64  `dynamodbav:"quantity"`
+	UnitPrice int64  `dynamodbav:"unitPrice"`
+	Currency  string `dynamodbav:"currency"`
+	Total     int64  `dynamodbav:"total"`
+}
+
+type ItemsPage struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// NewItem builds a pending order priced from the given products, which must contain every line item product,
+// along with the variants of the lines ordering one. Returns ErrMixedCurrencies when the products are not all
+// priced in the same currency, and ErrVariantNotFound when a variant is gone
+func NewItem(customerId string, lineItems []LineItem, productItems map[string]*products.Item) (*Item, error) {
+	now := time.Now().UTC().Unix()
+	item := &Item{
+		Id:           uuid.New().String(),
+		DateCreated:  now,
+		DateModified: now,
+		CustomerId:   customerId,
+		LineItems:    make([]OrderLine, 0, len(lineItems)),
+		Status:       StatusPending,
+	}
+
+	for i, li := range lineItems {
+		p := productItems[li.ProductId]
+		if i == 0 {
+			item.Currency = p.Currency
+		}
+		if p.Currency != item.Currency {
+			return nil, fmt.Errorf("%w: %v and %v", ErrMixedCurrencies, item.Currency, p.Currency)
+		}
+
+		var variant *products.VariantItem
+		if len(li.VariantId) > 0 {
+			v, ok := p.Variant(li.VariantId)
+			if !ok {
+				return nil, fmt.Errorf("%w: %v, of product %v", products.ErrVariantNotFound, li.VariantId, li.ProductId)
+			}
+			variant = v
+		}
+
+		price := p.PriceOf(variant)
+		line := OrderLine{
+			ProductId: li.ProductId,
+			VariantId: li.VariantId,
+			Quantity:  li.Quantity,
+			UnitPrice: price,
+			Currency:  p.Currency,
+			Total:     price * li.Quantity,
+		}
+		item.LineItems = append(item.LineItems, line)
+		item.Total += line.Total
+	}
+
+	return item, nil
+}
+
+// FindProducts reads the products of the line items, returning the ones found by id and the ids missing.
+// The products of lines ordering a variant are read one at a time along with their variants, the others
+// in a batch
+func FindProducts(ctx context.Context, svc products.IProduct, lineItems []LineItem) (map[string]*products.Item, []string, error) {
+	withVariants := map[string]bool{}
+	for _, li := range lineItems {
+		if len(li.VariantId) > 0 {
+			withVariants[li.ProductId] = true
+		}
+	}
+
+	found := map[string]*products.Item{}
+	missing := []string{}
+	read := map[string]bool{}
+	batched := make([]string, 0, len(lineItems))
+	for _, li := range lineItems {
+		if !withVariants[li.ProductId] {
+			batched = append(batched, li.ProductId)
+			continue
+		}
+		if read[li.ProductId] {
+			continue
+		}
+		read[li.ProductId] = true
+
+		item, err := svc.GetProduct(ctx, li.ProductId, products.ReadOptions{})
+		if errors.Is(err, products.ErrNotFound) {
+			missing = append(missing, li.ProductId)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		found[li.ProductId] = item
+	}
+
+	if len(batched) > 0 {
+		batch, err := svc.GetProducts(ctx, batched, products.ReadOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for id, item := range batch.ByID() {
+			found[id] = item
+		}
+		missing = append(missing, batch.Missing...)
+	}
+	return found, missing, nil
+}
+
+// Service is the IOrder serving the orders API from the orders table, pricing new orders with the products service
+type Service struct {
+	cfg      *config.Cfg
+	awsSvc   *aws_services.AWS
+	products products.IProduct
+}
+
+func NewService(cfg *config.Cfg, awsSvc *aws_services.AWS, products products.IProduct) *Service {
+	return &Service{cfg: cfg, awsSvc: awsSvc, products: products}
+}
+
+var _ IOrder = (*Service)(nil)
+
+func (s *Service) createOneOrder(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	order := new(Order)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(order); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	if err := validator.WithPrintJSON(true).Validate(order); err != nil {
+		msj := "error order validation"
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: fmt.Sprintf("%v: %v", msj, err),
+			Errors:     utils.ValidationErrors(err),
+		})
+	}
+
+	// the products of the order are read at once
+	if len(order.LineItems) > int(utils.MaxPageLimit) {
+		msj := fmt.Sprintf("order cannot hold more than %d line items", utils.MaxPageLimit)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	productItems, missing, err := FindProducts(ctx, s.products, order.LineItems)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error looking up products", http.StatusNotFound))
+	}
+
+	if len(missing) > 0 {
+		msj := fmt.Sprintf("products not found: %v", strings.Join(missing, ", "))
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := NewItem(order.CustomerId, order.LineItems, productItems)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		msj := fmt.Sprintf("error mapping attribute values: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.cfg.OrdersTable),
+		Item:      avMap,
+	}
+	_, err = s.awsSvc.DDBClient.PutItem(ctx, input)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error putting item", http.StatusConflict))
+	}
+
+	return utils.SendCreated(
+		utils.Location(request, "/orders/"+item.Id),
+		item,
+		fmt.Sprintf("successfully created order with id: %s", item.Id),
+	)
+}
+
+func (s *Service) readOneOrder(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		msj := fmt.Sprint("empty id on path params") //nolint:all
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	getOutput, err := s.awsSvc.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.cfg.OrdersTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error getting item", http.StatusNotFound))
+	}
+
+	if len(getOutput.Item) == 0 {
+		msj := fmt.Sprintf("no entries found with id: %v", id)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item := new(Item)
+	err = attributevalue.UnmarshalMap(getOutput.Item, item)
+	if err != nil {
+		msj := fmt.Sprintf("error unmarshalling get output: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	out, err := json.Marshal(item)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling item: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusOK,
+		Data:       string(out),
+		LogMessage: string(out),
+	})
+}
+
+func (s *Service) listOrders(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	limit, err := utils.ParseLimit(request.QueryStringParameters)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	startKey, err := utils.DecodeCursor(request.QueryStringParameters["cursor"])
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	scanInput := &dynamodb.ScanInput{
+		TableName:         aws.String(s.cfg.OrdersTable),
+		Limit:             aws.Int32(limit),
+		ExclusiveStartKey: startKey,
+	}
+
+	scanOutput, err := s.awsSvc.DDBClient.Scan(ctx, scanInput)
+	if err != nil {
+		return utils.SendErr(utils.AWSErrResponse(err, "error scanning items", http.StatusNotFound))
+	}
+
+	page := &ItemsPage{Items: []Item{}}
+	err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &page.Items)
+	if err != nil {
+		msj := fmt.Sprintf("error unmarshalling scan output: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	page.Next, err = utils.EncodeCursor(scanOutput.LastEvaluatedKey)
+	if err != nil {
+		msj := fmt.Sprintf("error encoding cursor: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	out, err := json.Marshal(page)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling items: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendOK(&utils.APIResponse{
+		StatusCode: http.StatusOK,
+		Data:       string(out),
+		LogMessage: fmt.Sprintf("listed %d orders", len(page.Items)),
+	})
+}
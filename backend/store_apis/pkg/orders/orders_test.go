@@ -0,0 +1,212 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	aws_services "store_apis/pkg/aws"
+	mock_aws_services "store_apis/pkg/aws/mocks"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// newService builds the orders service on a products service sharing its DynamoDB client
+func newService(cfg *config.Cfg, awsSvc *aws_services.AWS) *Service {
+	return NewService(cfg, awsSvc, products.NewService(products.NewDynamoDBRepository(cfg, awsSvc), nil))
+}
+
+func Test_CreateOneOrder_ReturnOK(t *testing.T) {
+	body := `
+	{
+		"customerId": "customer-1",
+		"lineItems": [
+			{"productId": "100", "quantity": 2}
+		]
+	}
+	`
+
+	req := events.APIGatewayProxyRequest{
+		Headers:    map[string]string{"content-type": "application/json"},
+		Resource:   "/orders",
+		Path:       "/orders",
+		HTTPMethod: http.MethodPost,
+		Body:       body,
+	}
+
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "products")
+	os.Setenv("ORDERS_TABLE", "orders")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+	mockDdbClient.
+		EXPECT().
+		BatchGetItem(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]types.AttributeValue{
+				"products": {
+					{
+						"id":       &types.AttributeValueMemberS{Value: "100"},
+						"price":    &types.AttributeValueMemberN{Value: "250"},
+						"currency": &types.AttributeValueMemberS{Value: "USD"},
+					},
+				},
+			},
+		}, nil)
+
+	mockDdbClient.
+		EXPECT().
+		PutItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			assert.Equal(t, "orders", *in.TableName)
+
+			item := new(Item)
+			assert.NoError(t, attributevalue.UnmarshalMap(in.Item, item))
+			assert.Equal(t, StatusPending, item.Status)
+			assert.Equal(t, int64(500), item.Total)
+			assert.Equal(t, "USD", item.Currency)
+			assert.Equal(t, int64(250), item.LineItems[0].UnitPrice)
+			return &dynamodb.PutItemOutput{}, nil
+		})
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: mockDdbClient,
+	}
+
+	resp, err := newService(cfg, awsSvc).createOneOrder(context.TODO(), req)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	assert.Equal(t, "/orders/"+item.Id, resp.Headers["Location"])
+	assert.Equal(t, int64(500), item.Total)
+}
+
+func Test_CreateOneOrder_ReturnError(t *testing.T) {
+	subtests := []struct {
+		name          string
+		body          string
+		expected      int
+		expectedError string
+	}{
+		{
+			name: "no_line_items",
+			body: `
+				{
+					"customerId": "customer-1",
+					"lineItems": []
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "error order validation",
+		},
+		{
+			name: "invalid_quantity",
+			body: `
+				{
+					"customerId": "customer-1",
+					"lineItems": [{"productId": "100", "quantity": 0}]
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "error order validation",
+		},
+		{
+			name: "product_not_found",
+			body: `
+				{
+					"customerId": "customer-1",
+					"lineItems": [{"productId": "404", "quantity": 1}]
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "products not found: 404",
+		},
+		{
+			name: "mixed_currencies",
+			body: `
+				{
+					"customerId": "customer-1",
+					"lineItems": [{"productId": "100", "quantity": 1}, {"productId": "200", "quantity": 1}]
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "line items are priced in different currencies: USD and EUR",
+		},
+		{
+			name:          "too_many_line_items",
+			body:          `{"customerId": "customer-1", "lineItems": [` + strings.Repeat(`{"productId": "100", "quantity": 1},`, 100) + `{"productId": "100", "quantity": 1}]}`,
+			expected:      http.StatusBadRequest,
+			expectedError: "order cannot hold more than 100 line items",
+		},
+	}
+
+	cfg := &config.Cfg{ProductsTable: "products"}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				Headers:    map[string]string{"content-type": "application/json"},
+				Resource:   "/orders",
+				Path:       "/orders",
+				HTTPMethod: http.MethodPost,
+				Body:       st.body,
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+			mockDdbClient.
+				EXPECT().
+				BatchGetItem(gomock.Any(), gomock.Any()).
+				Return(&dynamodb.BatchGetItemOutput{
+					Responses: map[string][]map[string]types.AttributeValue{
+						"products": {
+							{
+								"id":       &types.AttributeValueMemberS{Value: "100"},
+								"price":    &types.AttributeValueMemberN{Value: "250"},
+								"currency": &types.AttributeValueMemberS{Value: "USD"},
+							},
+							{
+								"id":       &types.AttributeValueMemberS{Value: "200"},
+								"price":    &types.AttributeValueMemberN{Value: "900"},
+								"currency": &types.AttributeValueMemberS{Value: "EUR"},
+							},
+						},
+					},
+				}, nil).
+				AnyTimes() // expects zero or more calls
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mockDdbClient,
+			}
+
+			resp, err := newService(cfg, awsSvc).createOneOrder(context.TODO(), req)
+			assert.NoError(t, err)
+
+			assert.Equal(t, st.expected, resp.StatusCode)
+			assert.Contains(t, resp.Body, st.expectedError)
+		})
+	}
+}
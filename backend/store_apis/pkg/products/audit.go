@@ -0,0 +1,226 @@
+package products
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"store_apis/pkg/config"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Every write of the product service appends a Change to the history of the product, in the same
+// transaction as the write. Changes are keyed by product id and the version the write produced, so a
+// version is only ever recorded once and the history reads back in version order
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+
+	ActionCreateVariant = "createVariant"
+	ActionUpdateVariant = "updateVariant"
+	ActionDeleteVariant = "deleteVariant"
+
+	ActionAddImage      = "addImage"
+	ActionUpdateImages  = "updateImages"
+	ActionSetThumbnails = "setThumbnails"
+
+	// stock changes made by other domains, see ChangeStock
+	ActionCheckout = "checkout"
+	ActionReserve  = "reserve"
+	ActionRelease  = "release"
+	ActionCommit   = "commit"
+)
+
+// SystemActor is the actor of changes made outside of any request, such as by scheduled jobs
+const SystemActor = "system"
+
+// Change is the audit record of a write to a product, stock changes made by checkouts and reservations included
+type Change struct {
+	ProductId string                 `dynamodbav:"productId" json:"productId"`
+	Version   int64                  `dynamodbav:"version" json:"version"`
+	Action    string                 `dynamodbav:"action" json:"action"`
+	Actor     string                 `dynamodbav:"actor" json:"actor"`
+	RequestId string                 `dynamodbav:"requestId,omitempty" json:"requestId,omitempty"`
+	Timestamp int64                  `dynamodbav:"timestamp" json:"timestamp"` // in epoch seconds
+	Diff      map[string]FieldChange `dynamodbav:"diff" json:"diff"`           // attribute name to its values around the write
+}
+
+// FieldChange holds the values of an attribute before and after a write, nil when it did not exist
+type FieldChange struct {
+	Before interface{} `dynamodbav:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `dynamodbav:"after,omitempty" json:"after,omitempty"`
+}
+
+type ChangesPage struct {
+	Items []Change `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// newChange records the write turning before into after, either being nil for creations and purges.
+// The version and time of the change are those of after, or follow before when the product is gone
+func newChange(ctx context.Context, action string, before, after *Item, now int64) (*Change, error) {
+	change := newRecord(ctx, action, now)
+	if after != nil {
+		change.ProductId = after.Id
+		change.Version = after.Version
+	} else {
+		change.ProductId = before.Id
+		change.Version = before.Version + 1
+	}
+
+	beforeAttrs, err := attributesOf(before)
+	if err != nil {
+		return nil, err
+	}
+	afterAttrs, err := attributesOf(after)
+	if err != nil {
+		return nil, err
+	}
+
+	change.Diff = diff(beforeAttrs, afterAttrs, "")
+	return change, nil
+}
+
+// newVariantChange records a write to a variant as a change of its product
+func newVariantChange(ctx context.Context, action string, write *VariantWrite) (*Change, error) {
+	change := newRecord(ctx, action, write.DateModified)
+	change.ProductId = write.Product.Id
+	change.Version = write.Product.Version + 1
+
+	change.Diff = map[string]FieldChange{}
+	if err := addVariantDiff(change, write.Before, write.After); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// addVariantDiff records the write turning the variant before into after in the change of its product, the
+// attributes of the variant being diffed under `variants.<variantId>.`
+func addVariantDiff(change *Change, before, after *VariantItem) error {
+	beforeAttrs, err := variantAttributesOf(before)
+	if err != nil {
+		return err
+	}
+	afterAttrs, err := variantAttributesOf(after)
+	if err != nil {
+		return err
+	}
+
+	variantId := ""
+	if after != nil {
+		variantId = after.Id
+	} else {
+		variantId = before.Id
+	}
+	for name, field := range diff(beforeAttrs, afterAttrs, "variants."+variantId+".") {
+		change.Diff[name] = field
+	}
+	return nil
+}
+
+// newRecord starts a change made by the actor of the request in ctx
+func newRecord(ctx context.Context, action string, now int64) *Change {
+	change := &Change{
+		Action:    action,
+		Actor:     SystemActor,
+		Timestamp: now,
+	}
+	if info, ok := utils.RequestInfoFrom(ctx); ok {
+		change.Actor = info.Actor
+		change.RequestId = info.RequestId
+	}
+	return change
+}
+
+// diff maps the prefixed name of every attribute whose value differs to its values
+func diff(beforeAttrs, afterAttrs map[string]interface{}, prefix string) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	for name, value := range afterAttrs {
+		if !reflect.DeepEqual(beforeAttrs[name], value) {
+			changes[prefix+name] = FieldChange{Before: beforeAttrs[name], After: value}
+		}
+	}
+	for name, value := range beforeAttrs {
+		if _, ok := afterAttrs[name]; !ok {
+			changes[prefix+name] = FieldChange{Before: value}
+		}
+	}
+	return changes
+}
+
+// attributesOf returns the attributes of the item as stored, leaving out the bookkeeping the change
+// records by itself
+func attributesOf(item *Item) (map[string]interface{}, error) {
+	if item == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	attrs, err := attributeMap(item)
+	if err != nil {
+		return nil, err
+	}
+	delete(attrs, "version")
+	delete(attrs, "dateModified")
+	return attrs, nil
+}
+
+func variantAttributesOf(variant *VariantItem) (map[string]interface{}, error) {
+	if variant == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	attrs, err := attributeMap(variant)
+	if err != nil {
+		return nil, err
+	}
+	delete(attrs, "variantId")
+	delete(attrs, "dateModified")
+	return attrs, nil
+}
+
+func attributeMap(in interface{}) (map[string]interface{}, error) {
+	avMap, err := attributevalue.MarshalMap(in)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	attrs := map[string]interface{}{}
+	if err := attributevalue.UnmarshalMap(avMap, &attrs); err != nil {
+		return nil, fmt.Errorf("error unmarshalling attribute values: %v", err)
+	}
+	return attrs, nil
+}
+
+// putChange appends the change to the audit table, conditioned on the version not being recorded yet
+// so records are never overwritten
+func putChange(cfg *config.Cfg, change *Change) (types.TransactWriteItem, error) {
+	avMap, err := attributevalue.MarshalMap(change)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("productId")),
+	).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:                aws.String(cfg.ProductsAuditTable),
+			Item:                     avMap,
+			ExpressionAttributeNames: expr.Names(),
+			ConditionExpression:      expr.Condition(),
+		},
+	}, nil
+}
@@ -0,0 +1,184 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog/log"
+)
+
+// backfilledVersionAttr records on a product copied by Backfill the version it was copied at. A product
+// still at that version was not written in the products table since, so a newer legacy version may replace it
+const backfilledVersionAttr = "backfilledVersion"
+
+// backfillTarget is what Backfill reads of a product already in the products table
+type backfillTarget struct {
+	Version           int64  `dynamodbav:"version"`
+	Sku               string `dynamodbav:"sku"`
+	BackfilledVersion *int64 `dynamodbav:"backfilledVersion"`
+}
+
+// BackfillErrors lists the errors of the products Backfill could not copy
+type BackfillErrors []error
+
+func (e BackfillErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d products not copied: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e BackfillErrors) Unwrap() []error {
+	return e
+}
+
+// Backfill copies the products of legacyTable, the products table keyed by id alone, into the products table,
+// with the lookup items of their SKUs, returning how many were copied. Products keep their versions, so their
+// ETags and history carry over. A product is copied when missing, or when the copy was not written since and
+// the legacy product is newer, so the backfill can be rerun to catch up with writes to the legacy table
+// until the Lambdas move to the products table, and never overwrites what they wrote there. A product failing
+// to copy does not hold back the others: its error is logged and returned in BackfillErrors once every
+// product was tried
+func (r *DynamoDBRepository) Backfill(ctx context.Context, legacyTable string) (int, error) {
+	// the SKU lookup items are rebuilt from the products
+	expr, err := expression.NewBuilder().WithFilter(
+		expression.Not(expression.Name("id").BeginsWith(skuKeyPrefix)),
+	).Build()
+	if err != nil {
+		return 0, fmt.Errorf("error building filter expression: %v", err)
+	}
+
+	copied := 0
+	var failed BackfillErrors
+	var startKey map[string]types.AttributeValue
+	for {
+		scanOutput, err := r.awsSvc.DDBClient.Scan(ctx, &dynamodb.ScanInput{
+			TableName:                 aws.String(legacyTable),
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         startKey,
+			ConsistentRead:            aws.Bool(true),
+		})
+		if err != nil {
+			return copied, fmt.Errorf("error scanning items: %w", err)
+		}
+
+		for _, avMap := range scanOutput.Items {
+			done, err := r.backfill(ctx, avMap)
+			if err != nil {
+				log.Error().Msgf("error backfilling product: %v", err)
+				failed = append(failed, err)
+				continue
+			}
+			if done {
+				copied++
+			}
+		}
+
+		if len(scanOutput.LastEvaluatedKey) == 0 {
+			if len(failed) > 0 {
+				return copied, failed
+			}
+			return copied, nil
+		}
+		startKey = scanOutput.LastEvaluatedKey
+	}
+}
+
+// backfill copies the legacy product avMap, reporting whether it did. The product is written in the same
+// transaction as its SKU lookup items, conditioned on the copy read being unchanged
+func (r *DynamoDBRepository) backfill(ctx context.Context, avMap map[string]types.AttributeValue) (bool, error) {
+	source := new(Item)
+	if err := attributevalue.UnmarshalMap(avMap, source); err != nil {
+		return false, fmt.Errorf("error unmarshalling legacy item: %v", err)
+	}
+
+	getOutput, err := r.awsSvc.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.cfg.ProductsTable),
+		Key:            productKey(source.Id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error getting item with id: %v: %w", source.Id, err)
+	}
+
+	target := new(backfillTarget)
+	cond := expression.AttributeNotExists(expression.Name("id"))
+	if getOutput.Item != nil {
+		if err := attributevalue.UnmarshalMap(getOutput.Item, target); err != nil {
+			return false, fmt.Errorf("error unmarshalling get output: %v", err)
+		}
+		// written in the products table since, or already up to date
+		if target.BackfilledVersion == nil || *target.BackfilledVersion != target.Version || source.Version <= target.Version {
+			return false, nil
+		}
+		cond = versionCondition(target.Version)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	item := make(map[string]types.AttributeValue, len(avMap)+2)
+	for name, av := range avMap {
+		item[name] = av
+	}
+	item["sk"] = &types.AttributeValueMemberS{Value: productSk}
+	item[backfilledVersionAttr] = &types.AttributeValueMemberN{Value: fmt.Sprint(source.Version)}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:                 aws.String(r.cfg.ProductsTable),
+				Item:                      item,
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+	}
+
+	if len(target.Sku) > 0 && skuKey(target.Sku) != skuKey(source.Sku) {
+		deleteSku, err := deleteSkuLookup(r.cfg, target.Sku, source.Id)
+		if err != nil {
+			return false, err
+		}
+		transactItems = append(transactItems, deleteSku)
+	}
+	if len(source.Sku) > 0 && (getOutput.Item == nil || skuKey(target.Sku) != skuKey(source.Sku)) {
+		putSku, err := putSkuLookup(r.cfg, source.Sku, source.Id)
+		if err != nil {
+			return false, err
+		}
+		transactItems = append(transactItems, putSku)
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			// written in the products table meanwhile, which wins over the legacy table
+			if isConditionFailed(tce.CancellationReasons, 0) {
+				return false, nil
+			}
+			if isConditionFailed(tce.CancellationReasons, len(transactItems)-1) && len(source.Sku) > 0 {
+				return false, fmt.Errorf("%w: %v, of product with id: %v", ErrSkuInUse, source.Sku, source.Id)
+			}
+		}
+		return false, fmt.Errorf("error backfilling item with id: %v: %w", source.Id, err)
+	}
+
+	return true, nil
+}
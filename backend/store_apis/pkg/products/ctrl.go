@@ -2,24 +2,716 @@ package products
 
 import (
 	"context"
-	aws_services "store_apis/pkg/aws"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"store_apis/pkg/config"
+	"store_apis/pkg/router"
+	"store_apis/pkg/utils"
 
 	"github.com/aws/aws-lambda-go/events"
 )
 
-func Post(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	return p.createOneProduct(ctx, request, cfg, awsSvc)
+func RegisterRoutes(r *router.Router, p IProduct, cfg *config.Cfg) {
+	r.Handle(http.MethodPost, "/products", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Post(ctx, request, p)
+	})
+	r.Handle(http.MethodGet, "/products", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return List(ctx, request, p, cfg)
+	})
+	r.Handle(http.MethodGet, "/products/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Get(ctx, request, p, cfg)
+	})
+	r.Handle(http.MethodPut, "/products/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Put(ctx, request, p)
+	})
+	r.Handle(http.MethodPatch, "/products/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Patch(ctx, request, p)
+	})
+	r.Handle(http.MethodDelete, "/products/{id}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Delete(ctx, request, p)
+	})
+	r.Handle(http.MethodPost, "/products/{id}/restore", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Restore(ctx, request, p)
+	})
+	r.Handle(http.MethodGet, "/products/{id}/history", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return History(ctx, request, p)
+	})
+	r.Handle(http.MethodPost, "/products/{id}/images", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PostImage(ctx, request, p)
+	})
+	r.Handle(http.MethodPut, "/products/{id}/images", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PutImages(ctx, request, p)
+	})
+	r.Handle(http.MethodGet, "/products/{id}/variants", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return ListVariants(ctx, request, p, cfg)
+	})
+	r.Handle(http.MethodPost, "/products/{id}/variants", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PostVariant(ctx, request, p)
+	})
+	r.Handle(http.MethodGet, "/products/{id}/variants/{variantId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return GetVariant(ctx, request, p, cfg)
+	})
+	r.Handle(http.MethodPut, "/products/{id}/variants/{variantId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return PutVariant(ctx, request, p)
+	})
+	r.Handle(http.MethodDelete, "/products/{id}/variants/{variantId}", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return DeleteVariant(ctx, request, p)
+	})
+}
+
+func Post(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	product := new(Product)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(product); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	item, err := p.CreateProduct(ctx, product)
+	if err != nil {
+		return sendServiceErr(err, "error creating product")
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusCreated,
+		Body:       item,
+		LogMessage: fmt.Sprintf("successfully created product with id: %s", item.Id),
+		Headers: map[string]string{
+			"Location": utils.Location(request, "/products/"+item.Id),
+			"ETag":     etag(item),
+		},
+	})
+}
+
+// Get answers with the product, or 304 Not Modified when the copy of the client is still current.
+// See readOptions for the query parameters it takes
+func Get(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	opts, err := readOptions(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	item, err := p.GetProduct(ctx, id, opts)
+	if err != nil {
+		return sendServiceErr(err, "error reading product")
+	}
+
+	validators := utils.CacheValidators{
+		ETag:         etag(item),
+		CacheControl: cacheControl(cfg, opts),
+	}
+	if item.DateModified > 0 {
+		validators.LastModified = time.Unix(item.DateModified, 0)
+	}
+
+	return utils.SendConditional(request, &utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       item,
+		LogMessage: fmt.Sprintf("read product with id: %v", id),
+	}, validators)
+}
+
+// List answers with a page of products, or 304 Not Modified when the page is the one the client holds.
+// `?ids=a,b,c` reads the listed products instead, see BatchGet
+func List(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg) (events.APIGatewayProxyResponse, error) {
+	if ids, ok := request.QueryStringParameters["ids"]; ok {
+		return BatchGet(ctx, request, p, cfg, strings.Split(ids, ","))
+	}
+
+	limit, err := utils.ParseLimit(request.QueryStringParameters)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	opts, err := readOptions(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	page, err := p.ListProducts(ctx, limit, request.QueryStringParameters["cursor"], opts)
+	if err != nil {
+		return sendServiceErr(err, "error listing products")
+	}
+
+	// the page has no single version, its ETag is derived from its content
+	return utils.SendConditional(request, &utils.JSONResponse[*ItemsPage]{
+		StatusCode: http.StatusOK,
+		Body:       page,
+		LogMessage: fmt.Sprintf("listed %d products", len(page.Items)),
+	}, utils.CacheValidators{CacheControl: cacheControl(cfg, opts)})
+}
+
+// BatchGet answers with the products with the given ids, in the order they are listed, and the ids with
+// no product as missing
+func BatchGet(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg, ids []string) (events.APIGatewayProxyResponse, error) {
+	for i := range ids {
+		ids[i] = strings.TrimSpace(ids[i])
+	}
+
+	opts, err := readOptions(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	batch, err := p.GetProducts(ctx, ids, opts)
+	if err != nil {
+		return sendServiceErr(err, "error reading products")
+	}
+
+	return utils.SendConditional(request, &utils.JSONResponse[*ItemsBatch]{
+		StatusCode: http.StatusOK,
+		Body:       batch,
+		LogMessage: fmt.Sprintf("read %d products, %d missing", len(batch.Items), len(batch.Missing)),
+	}, utils.CacheValidators{CacheControl: cacheControl(cfg, opts)})
+}
+
+func Put(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	product := new(Product)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(product); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	updated, err := p.UpdateProduct(ctx, id, version, product)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error updating product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       updated,
+		LogMessage: fmt.Sprintf("product with id: %v, was successfully updated", id),
+		Headers:    map[string]string{"ETag": etag(updated)},
+	})
+}
+
+// Patch updates only the fields sent in a JSON merge patch, e.g. `{"price": 2499}`
+func Patch(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	if utils.MediaType(request) != utils.MergePatchContentType {
+		msj := fmt.Sprintf("unsupported content type, expected: %v", utils.MergePatchContentType)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusUnsupportedMediaType,
+			Data:       msj,
+			LogMessage: msj,
+			Headers:    map[string]string{"Accept-Patch": utils.MergePatchContentType},
+		})
+	}
+
+	patch := map[string]json.RawMessage{}
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(&patch); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	patched, err := p.PatchProduct(ctx, id, version, patch)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error patching product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       patched,
+		LogMessage: fmt.Sprintf("product with id: %v, was successfully patched", id),
+		Headers:    map[string]string{"ETag": etag(patched)},
+	})
+}
+
+func Delete(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	if err := p.DeleteProduct(ctx, id, version); err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error deleting product with id: %v", id))
+	}
+
+	return utils.SendNoContent(fmt.Sprintf("product with id: %v, was successfully deleted", id))
+}
+
+// Restore brings back a deleted product. Like the other writes, it takes the ETag of the deleted
+// product, read with `?includeDeleted=true`, as If-Match
+func Restore(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	restored, err := p.RestoreProduct(ctx, id, version)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error restoring product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       restored,
+		LogMessage: fmt.Sprintf("product with id: %v, was successfully restored", id),
+		Headers:    map[string]string{"ETag": etag(restored)},
+	})
+}
+
+// History answers with a page of the changes made to the product, newest first
+func History(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	limit, err := utils.ParseLimit(request.QueryStringParameters)
+	if err != nil {
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	page, err := p.ProductHistory(ctx, id, limit, request.QueryStringParameters["cursor"])
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error reading history of product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*ChangesPage]{
+		StatusCode: http.StatusOK,
+		Body:       page,
+		LogMessage: fmt.Sprintf("read %d changes of product with id: %v", len(page.Items), id),
+	})
+}
+
+// PostImage adds an image to the product and answers with the presigned request uploading its file. It takes
+// the ETag of the product as If-Match
+func PostImage(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	image := new(Image)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(image); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	upload, product, err := p.AddImage(ctx, id, version, image)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error adding image to product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*ImageUpload]{
+		StatusCode: http.StatusCreated,
+		Body:       upload,
+		LogMessage: fmt.Sprintf("handed out upload of image with key: %v, of product with id: %v", upload.Image.Key, id),
+		Headers:    map[string]string{"ETag": etag(product)},
+	})
+}
+
+// PutImages orders the images of the product as listed in the body, with their alt text, removing those left
+// out. It takes the ETag of the product as If-Match
+func PutImages(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	texts := []ImageText{}
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(&texts); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	updated, err := p.UpdateImages(ctx, id, version, texts)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error updating images of product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*Item]{
+		StatusCode: http.StatusOK,
+		Body:       updated,
+		LogMessage: fmt.Sprintf("images of product with id: %v, were successfully updated", id),
+		Headers:    map[string]string{"ETag": etag(updated)},
+	})
+}
+
+// ListVariants answers with the variants of the product. Like every variant read, it is validated with the
+// ETag of the product, which any write to its variants changes
+func ListVariants(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	opts, err := readOptions(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	item, err := p.GetProduct(ctx, id, opts)
+	if err != nil {
+		return sendServiceErr(err, "error reading product")
+	}
+
+	variants := &Variants{Items: item.Variants}
+	if variants.Items == nil {
+		variants.Items = []VariantItem{}
+	}
+
+	return utils.SendConditional(request, &utils.JSONResponse[*Variants]{
+		StatusCode: http.StatusOK,
+		Body:       variants,
+		LogMessage: fmt.Sprintf("read %d variants of product with id: %v", len(variants.Items), id),
+	}, variantValidators(item, cfg, opts))
+}
+
+// PostVariant adds a variant to the product. It takes the ETag of the product as If-Match
+func PostVariant(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	if len(id) == 0 {
+		return sendEmptyId()
+	}
+
+	variant := new(Variant)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(variant); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	created, product, err := p.CreateVariant(ctx, id, version, variant)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error creating variant of product with id: %v", id))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*VariantItem]{
+		StatusCode: http.StatusCreated,
+		Body:       created,
+		LogMessage: fmt.Sprintf("successfully created variant with id: %s, of product with id: %v", created.Id, id),
+		Headers: map[string]string{
+			"Location": utils.Location(request, "/products/"+id+"/variants/"+created.Id),
+			"ETag":     etag(product),
+		},
+	})
+}
+
+func GetVariant(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg) (events.APIGatewayProxyResponse, error) {
+	id, variantId := request.PathParameters["id"], request.PathParameters["variantId"]
+	if len(id) == 0 || len(variantId) == 0 {
+		return sendEmptyId()
+	}
+
+	opts, err := readOptions(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	item, err := p.GetProduct(ctx, id, opts)
+	if err != nil {
+		return sendServiceErr(err, "error reading product")
+	}
+
+	variant, ok := item.Variant(variantId)
+	if !ok {
+		return sendServiceErr(fmt.Errorf("%w: %v", ErrVariantNotFound, variantId), "")
+	}
+
+	return utils.SendConditional(request, &utils.JSONResponse[*VariantItem]{
+		StatusCode: http.StatusOK,
+		Body:       variant,
+		LogMessage: fmt.Sprintf("read variant with id: %v, of product with id: %v", variantId, id),
+	}, variantValidators(item, cfg, opts))
+}
+
+// PutVariant replaces the fields of a variant. It takes the ETag of the product as If-Match
+func PutVariant(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id, variantId := request.PathParameters["id"], request.PathParameters["variantId"]
+	if len(id) == 0 || len(variantId) == 0 {
+		return sendEmptyId()
+	}
+
+	variant := new(Variant)
+	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(variant); err != nil {
+		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	updated, product, err := p.UpdateVariant(ctx, id, variantId, version, variant)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error updating variant with id: %v", variantId))
+	}
+
+	return utils.SendJSON(&utils.JSONResponse[*VariantItem]{
+		StatusCode: http.StatusOK,
+		Body:       updated,
+		LogMessage: fmt.Sprintf("variant with id: %v, of product with id: %v, was successfully updated", variantId, id),
+		Headers:    map[string]string{"ETag": etag(product)},
+	})
+}
+
+// DeleteVariant removes a variant. It takes the ETag of the product as If-Match, and answers with the new one
+func DeleteVariant(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct) (events.APIGatewayProxyResponse, error) {
+	id, variantId := request.PathParameters["id"], request.PathParameters["variantId"]
+	if len(id) == 0 || len(variantId) == 0 {
+		return sendEmptyId()
+	}
+
+	version, err := ifMatchVersion(request)
+	if err != nil {
+		return sendServiceErr(err, "")
+	}
+
+	product, err := p.DeleteVariant(ctx, id, variantId, version)
+	if err != nil {
+		return sendServiceErr(err, fmt.Sprintf("error deleting variant with id: %v", variantId))
+	}
+
+	resp, err := utils.SendNoContent(fmt.Sprintf("variant with id: %v, of product with id: %v, was successfully deleted", variantId, id))
+	resp.Headers["ETag"] = etag(product)
+	return resp, err
+}
+
+func variantValidators(product *Item, cfg *config.Cfg, opts ReadOptions) utils.CacheValidators {
+	validators := utils.CacheValidators{
+		ETag:         etag(product),
+		CacheControl: cacheControl(cfg, opts),
+	}
+	if product.DateModified > 0 {
+		validators.LastModified = time.Unix(product.DateModified, 0)
+	}
+	return validators
+}
+
+var (
+	errPreconditionRequired = errors.New("missing If-Match header, send the ETag of the product being modified")
+	errIfMatchList          = errors.New("If-Match must hold a single ETag, or *")
+)
+
+func etag(item *Item) string {
+	return utils.ETag(strconv.FormatInt(item.Version, 10))
 }
 
-func Get(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	return p.readOneProduct(ctx, request, cfg, awsSvc)
+// ifMatchVersion reads the version of the product a write is based on from the If-Match header.
+// Tags that are not the ETag of any product version fail as ErrVersionMismatch
+func ifMatchVersion(request events.APIGatewayProxyRequest) (int64, error) {
+	tags := utils.ParseETags(utils.Header(request, "If-Match"))
+	switch {
+	case len(tags) == 0:
+		return 0, errPreconditionRequired
+	case len(tags) > 1:
+		return 0, errIfMatchList
+	case tags[0] == "*":
+		return AnyVersion, nil
+	}
+
+	value, ok := utils.ETagValue(tags[0])
+	if !ok {
+		return 0, fmt.Errorf("%w: weak ETag %v", ErrVersionMismatch, tags[0])
+	}
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("%w: unknown ETag %v", ErrVersionMismatch, tags[0])
+	}
+	return version, nil
 }
 
-func Put(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	return p.updateOneProduct(ctx, request, cfg, awsSvc)
+// readOptions reads the options of product reads from the query parameters:
+// `?consistent=true` reads strongly consistent, for clients that must see their own writes, and
+// `?includeDeleted=true` returns deleted products too, for admins
+func readOptions(request events.APIGatewayProxyRequest) (ReadOptions, error) {
+	opts := ReadOptions{}
+	for name, opt := range map[string]*bool{
+		"consistent":     &opts.Consistent,
+		"includeDeleted": &opts.IncludeDeleted,
+	} {
+		raw, ok := request.QueryStringParameters[name]
+		if !ok {
+			continue
+		}
+
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return ReadOptions{}, &ValidationError{Msg: fmt.Sprintf("%v must be true or false, got: %q", name, raw)}
+		}
+		*opt = value
+	}
+	return opts, nil
 }
 
-func Delete(ctx context.Context, request events.APIGatewayProxyRequest, p IProduct, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	return p.deleteOneProduct(ctx, request, cfg, awsSvc)
+// privateCacheControl answers the reads that asked for fresh data or for deleted products, which shared
+// caches must neither store nor serve to other clients
+const privateCacheControl = "private, no-store"
+
+// cacheControl is the Cache-Control of a read made with opts
+func cacheControl(cfg *config.Cfg, opts ReadOptions) string {
+	if opts.Consistent || opts.IncludeDeleted {
+		return privateCacheControl
+	}
+	return cfg.ProductsCacheControl
+}
+
+func sendEmptyId() (events.APIGatewayProxyResponse, error) {
+	msj := "empty id on path params"
+	return utils.SendErr(&utils.APIResponse{
+		StatusCode: http.StatusBadRequest,
+		Data:       msj,
+		LogMessage: msj,
+	})
+}
+
+// sendServiceErr answers an error returned by the product service. Errors it does not define are AWS or
+// internal errors, described to the client by action
+func sendServiceErr(err error, action string) (events.APIGatewayProxyResponse, error) {
+	var ve *ValidationError
+	switch {
+	case errors.As(err, &ve):
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       ve.Msg,
+			LogMessage: err.Error(),
+			Errors:     utils.ValidationErrors(ve.Err),
+		})
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrVariantNotFound):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, ErrVersionMismatch):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusPreconditionFailed,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, errPreconditionRequired):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusPreconditionRequired,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, errIfMatchList):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusBadRequest,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, ErrNotDeleted):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, ErrSkuInUse), errors.Is(err, ErrOptionsInUse), errors.Is(err, ErrVariantReserved):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusConflict,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	case errors.Is(err, ErrRequiredField):
+		msj := err.Error()
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusUnprocessableEntity,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return utils.SendErr(utils.AWSErrResponse(err, action, http.StatusConflict))
 }
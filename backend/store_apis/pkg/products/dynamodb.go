@@ -0,0 +1,751 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBRepository stores the products in the products table, each in an item collection with its
+// variants, next to the SKU lookup items guarding SKU uniqueness
+type DynamoDBRepository struct {
+	cfg    *config.Cfg
+	awsSvc *aws_services.AWS
+}
+
+func NewDynamoDBRepository(cfg *config.Cfg, awsSvc *aws_services.AWS) *DynamoDBRepository {
+	return &DynamoDBRepository{cfg: cfg, awsSvc: awsSvc}
+}
+
+var _ ProductRepository = (*DynamoDBRepository)(nil)
+
+func (r *DynamoDBRepository) Create(ctx context.Context, item *Item, change *Change) error {
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("error mapping attribute values: %v", err)
+	}
+	avMap["sk"] = &types.AttributeValueMemberS{Value: productSk}
+
+	putSku, err := putSkuLookup(r.cfg, item.Sku, item.Id)
+	if err != nil {
+		return err
+	}
+
+	putAudit, err := putChange(r.cfg, change)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName: aws.String(r.cfg.ProductsTable),
+					Item:      avMap,
+				},
+			},
+			putSku,
+			putAudit,
+		},
+	}
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, input)
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) && isSkuConflict(tce.CancellationReasons, 1) {
+			return fmt.Errorf("%w: %v", ErrSkuInUse, item.Sku)
+		}
+		return fmt.Errorf("error putting item: %w", err)
+	}
+
+	return nil
+}
+
+// Get queries the item collection of the product, which holds the product followed by its variants, so both
+// are read as of the same point. Strongly consistent reads cost twice the capacity of eventually consistent
+// ones, so they are left to the callers that need to see their own writes
+func (r *DynamoDBRepository) Get(ctx context.Context, id string, opts ReadOptions) (*Item, error) {
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.
+			Key("id").Equal(expression.Value(id)),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building query expression: %v", err)
+	}
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:                 aws.String(r.cfg.ProductsTable),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConsistentRead:            aws.Bool(opts.Consistent),
+	}
+
+	var item *Item
+	variants := []VariantItem{}
+	for {
+		queryOutput, err := r.awsSvc.DDBClient.Query(ctx, queryInput)
+		if err != nil {
+			return nil, fmt.Errorf("error query items: %w", err)
+		}
+
+		for _, avMap := range queryOutput.Items {
+			sk, _ := avMap["sk"].(*types.AttributeValueMemberS)
+			switch {
+			case sk == nil:
+				continue
+			case sk.Value == productSk:
+				item = new(Item)
+				if err := attributevalue.UnmarshalMap(avMap, item); err != nil {
+					return nil, fmt.Errorf("error unmarshalling query output: %v", err)
+				}
+			case strings.HasPrefix(sk.Value, variantSkPrefix):
+				variant := VariantItem{}
+				if err := attributevalue.UnmarshalMap(avMap, &variant); err != nil {
+					return nil, fmt.Errorf("error unmarshalling query output: %v", err)
+				}
+				variants = append(variants, variant)
+			}
+		}
+
+		if len(queryOutput.LastEvaluatedKey) == 0 {
+			break
+		}
+		queryInput.ExclusiveStartKey = queryOutput.LastEvaluatedKey
+	}
+
+	if item == nil || (item.Deleted() && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, id)
+	}
+	if len(variants) > 0 {
+		item.Variants = variants
+	}
+	return item, nil
+}
+
+// BatchGet reads the products with BatchGetItem, in chunks of batchGetSize keys
+func (r *DynamoDBRepository) BatchGet(ctx context.Context, ids []string, opts ReadOptions) (*ItemsBatch, error) {
+	found := make(map[string]*Item, len(ids))
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, productKey(id))
+	}
+
+	for start := 0; start < len(keys); start += batchGetSize {
+		end := start + batchGetSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		items, err := r.batchGetItems(ctx, keys[start:end], opts.Consistent)
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			if items[i].Deleted() && !opts.IncludeDeleted {
+				continue
+			}
+			found[items[i].Id] = &items[i]
+		}
+	}
+
+	batch := &ItemsBatch{Items: make([]Item, 0, len(found)), Missing: []string{}}
+	for _, id := range ids {
+		if item, ok := found[id]; ok {
+			batch.Items = append(batch.Items, *item)
+		} else {
+			batch.Missing = append(batch.Missing, id)
+		}
+	}
+	return batch, nil
+}
+
+// List scans the table, the cursor being the encoded LastEvaluatedKey of the previous page
+func (r *DynamoDBRepository) List(ctx context.Context, limit int32, cursor string, opts ReadOptions) (*ItemsPage, error) {
+	startKey, err := utils.DecodeCursor(cursor)
+	if err != nil {
+		return nil, &ValidationError{Msg: err.Error()}
+	}
+
+	// skip the variants and SKU lookup items stored in the same table
+	filter := expression.Name("sk").Equal(expression.Value(productSk))
+	if !opts.IncludeDeleted {
+		filter = filter.And(expression.AttributeNotExists(expression.Name("deletedAt")))
+	}
+
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building filter expression: %v", err)
+	}
+
+	scanInput := &dynamodb.ScanInput{
+		TableName:                 aws.String(r.cfg.ProductsTable),
+		Limit:                     aws.Int32(limit),
+		ExclusiveStartKey:         startKey,
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConsistentRead:            aws.Bool(opts.Consistent),
+	}
+
+	scanOutput, err := r.awsSvc.DDBClient.Scan(ctx, scanInput)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning items: %w", err)
+	}
+
+	page := &ItemsPage{Items: []Item{}}
+	err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &page.Items)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling scan output: %v", err)
+	}
+
+	page.Next, err = utils.EncodeCursor(scanOutput.LastEvaluatedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cursor: %v", err)
+	}
+
+	return page, nil
+}
+
+// Update builds the UpdateExpression from the attributes of the update, and writes it in a transaction
+// with the change. When the SKU changes, the lookup items are moved in the same transaction
+func (r *DynamoDBRepository) Update(ctx context.Context, update *ItemUpdate, change *Change) (*Item, error) {
+	id := update.Current.Id
+
+	var ub expression.UpdateBuilder
+	names := make([]string, 0, len(update.Set))
+	for name := range update.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ub = ub.Set(expression.Name(name), expression.Value(update.Set[name]))
+	}
+	for _, name := range update.Remove {
+		ub = ub.Remove(expression.Name(name))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(ub).WithCondition(
+		versionCondition(update.Current.Version),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building update expression: %v", err)
+	}
+
+	putAudit, err := putChange(r.cfg, change)
+	if err != nil {
+		return nil, err
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                 aws.String(r.cfg.ProductsTable),
+				Key:                       productKey(id),
+				UpdateExpression:          expr.Update(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+		putAudit,
+	}
+
+	newSku, changed := update.newSku()
+	if changed {
+		skuItems, err := moveSkuLookup(r.cfg, id, update.Current.Sku, newSku)
+		if err != nil {
+			return nil, err
+		}
+		transactItems = append(transactItems, skuItems...)
+	}
+
+	// transactions return no values, the product is what was read with the update applied
+	updated, err := update.applyTo(update.Current)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if changed && errors.As(err, &tce) && isSkuConflict(tce.CancellationReasons, 2) {
+			return nil, fmt.Errorf("%w: %v", ErrSkuInUse, newSku)
+		}
+
+		// a failed condition means the product was modified, or deleted, since it was read
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return nil, fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+		}
+		return nil, fmt.Errorf("error updating item with id: %v: %w", id, err)
+	}
+
+	return updated, nil
+}
+
+// moveSkuLookup claims the new SKU of the product and releases the old one
+func moveSkuLookup(cfg *config.Cfg, id, oldSku, newSku string) ([]types.TransactWriteItem, error) {
+	putSku, err := putSkuLookup(cfg, newSku, id)
+	if err != nil {
+		return nil, err
+	}
+
+	transactItems := []types.TransactWriteItem{putSku}
+
+	// products created before SKUs were introduced have no lookup item to release
+	if len(oldSku) > 0 {
+		deleteSku, err := deleteSkuLookup(cfg, oldSku, id)
+		if err != nil {
+			return nil, err
+		}
+		transactItems = append(transactItems, deleteSku)
+	}
+	return transactItems, nil
+}
+
+// Delete removes the product together with the lookup item of its sku, if it has one, and its variants with
+// theirs. Every transaction checks the product is still deleted at the version of current, so a delete
+// failing midway leaves a product whose next delete completes it, and a product restored meanwhile keeps
+// the variants not deleted yet
+func (r *DynamoDBRepository) Delete(ctx context.Context, current *Item, change *Change) error {
+	id := current.Id
+
+	stored, err := r.Get(ctx, id, ReadOptions{Consistent: true, IncludeDeleted: true})
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+	}
+	if err != nil {
+		return err
+	}
+	variants := stored.Variants
+
+	// only a product still deleted at the version it was read at is purged, not one restored meanwhile
+	expr, err := expression.NewBuilder().WithCondition(
+		versionCondition(current.Version).And(expression.AttributeExists(expression.Name("deletedAt"))),
+	).Build()
+	if err != nil {
+		return fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	putAudit, err := putChange(r.cfg, change)
+	if err != nil {
+		return err
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName:                 aws.String(r.cfg.ProductsTable),
+				Key:                       productKey(id),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+		putAudit,
+	}
+
+	if sku := current.Sku; len(sku) > 0 {
+		deleteSku, err := deleteSkuLookup(r.cfg, sku, id)
+		if err != nil {
+			return err
+		}
+		transactItems = append(transactItems, deleteSku)
+	}
+
+	// the variants that fit go along with the product, the others are deleted before it in transactions
+	// checking the product on the same condition, so none is lost to a restore
+	check := types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(r.cfg.ProductsTable),
+			Key:                       productKey(id),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ConditionExpression:       expr.Condition(),
+		},
+	}
+	chunk := []types.TransactWriteItem{check}
+	for i := range variants {
+		deletes, err := variantDeletes(r.cfg, id, &variants[i])
+		if err != nil {
+			return err
+		}
+
+		if len(transactItems)+len(deletes) <= maxTransactItems {
+			transactItems = append(transactItems, deletes...)
+			continue
+		}
+		if len(chunk)+len(deletes) > maxTransactItems {
+			if err := r.purge(ctx, id, chunk); err != nil {
+				return err
+			}
+			chunk = []types.TransactWriteItem{check}
+		}
+		chunk = append(chunk, deletes...)
+	}
+	if len(chunk) > 1 {
+		if err := r.purge(ctx, id, chunk); err != nil {
+			return err
+		}
+	}
+
+	return r.purge(ctx, id, transactItems)
+}
+
+// purge writes a transaction of Delete, failing with ErrVersionMismatch when the product was written since
+func (r *DynamoDBRepository) purge(ctx context.Context, id string, transactItems []types.TransactWriteItem) error {
+	_, err := r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+		}
+		return fmt.Errorf("error deleting item with id: %v: %w", id, err)
+	}
+	return nil
+}
+
+// putVariant builds the put of the variant into the item collection of its product, left unconditional as
+// the version of the product guards its variants
+func putVariant(cfg *config.Cfg, productId string, variant *VariantItem) (types.TransactWriteItem, error) {
+	avMap, err := attributevalue.MarshalMap(variant)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+	for name, av := range variantKey(productId, variant.Id) {
+		avMap[name] = av
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String(cfg.ProductsTable),
+			Item:      avMap,
+		},
+	}, nil
+}
+
+// variantDeletes builds the deletes of the variant and of its SKU lookup item
+func variantDeletes(cfg *config.Cfg, productId string, variant *VariantItem) ([]types.TransactWriteItem, error) {
+	transactItems := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String(cfg.ProductsTable),
+				Key:       variantKey(productId, variant.Id),
+			},
+		},
+	}
+
+	if len(variant.Sku) > 0 {
+		deleteSku, err := deleteSkuLookup(cfg, variant.Sku, productId)
+		if err != nil {
+			return nil, err
+		}
+		transactItems = append(transactItems, deleteSku)
+	}
+	return transactItems, nil
+}
+
+// WriteVariant puts or deletes the variant in a transaction with the version of the product, the change,
+// and the lookup items of the SKUs claimed or released
+func (r *DynamoDBRepository) WriteVariant(ctx context.Context, write *VariantWrite, change *Change) (*Item, error) {
+	id := write.Product.Id
+
+	expr, err := expression.NewBuilder().WithUpdate(
+		expression.
+			Set(expression.Name("version"), expression.Value(write.Product.Version+1)).
+			Set(expression.Name("dateModified"), expression.Value(write.DateModified)),
+	).WithCondition(
+		versionCondition(write.Product.Version),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building update expression: %v", err)
+	}
+
+	putAudit, err := putChange(r.cfg, change)
+	if err != nil {
+		return nil, err
+	}
+
+	transactItems := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                 aws.String(r.cfg.ProductsTable),
+				Key:                       productKey(id),
+				UpdateExpression:          expr.Update(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		},
+		putAudit,
+	}
+
+	// the variant is written unconditionally, the version of the product guarding it
+	if write.After != nil {
+		putVariant, err := putVariant(r.cfg, id, write.After)
+		if err != nil {
+			return nil, err
+		}
+		transactItems = append(transactItems, putVariant)
+	} else {
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Delete: &types.Delete{
+				TableName: aws.String(r.cfg.ProductsTable),
+				Key:       variantKey(id, write.Before.Id),
+			},
+		})
+	}
+
+	newSku, claimed := write.newSku()
+	if claimed {
+		putSku, err := putSkuLookup(r.cfg, newSku, id)
+		if err != nil {
+			return nil, err
+		}
+		putSku.Put.Item["variantId"] = &types.AttributeValueMemberS{Value: write.After.Id}
+		transactItems = append(transactItems, putSku)
+	}
+	if oldSku, released := write.oldSku(); released && len(oldSku) > 0 {
+		deleteSku, err := deleteSkuLookup(r.cfg, oldSku, id)
+		if err != nil {
+			return nil, err
+		}
+		transactItems = append(transactItems, deleteSku)
+	}
+
+	_, err = r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if claimed && errors.As(err, &tce) && isSkuConflict(tce.CancellationReasons, 3) {
+			return nil, fmt.Errorf("%w: %v", ErrSkuInUse, newSku)
+		}
+
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return nil, fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+		}
+		return nil, fmt.Errorf("error writing variant of item with id: %v: %w", id, err)
+	}
+
+	// transactions return no values, the product is what was read with the write applied
+	return write.applyTo(write.Product), nil
+}
+
+// ChangeStock sets the stock and reserved units of each product, guarded on its version, along with those
+// of its changed variants, and appends its change, after joined in the same transaction so JoinedWriteError
+// can report their indexes
+func (r *DynamoDBRepository) ChangeStock(ctx context.Context, updates []StockUpdate, joined []types.TransactWriteItem) error {
+	transactItems := make([]types.TransactWriteItem, 0, len(joined)+3*len(updates))
+	transactItems = append(transactItems, joined...)
+
+	for _, update := range updates {
+		expr, err := expression.NewBuilder().WithUpdate(
+			expression.
+				Set(expression.Name("stock"), expression.Value(update.Updated.Stock)).
+				Set(expression.Name("reserved"), expression.Value(update.Updated.Reserved)).
+				Set(expression.Name("version"), expression.Value(update.Updated.Version)).
+				Set(expression.Name("dateModified"), expression.Value(update.Updated.DateModified)),
+		).WithCondition(
+			versionCondition(update.Current.Version),
+		).Build()
+		if err != nil {
+			return fmt.Errorf("error building update expression: %v", err)
+		}
+
+		putAudit, err := putChange(r.cfg, update.Change)
+		if err != nil {
+			return err
+		}
+
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName:                 aws.String(r.cfg.ProductsTable),
+				Key:                       productKey(update.Current.Id),
+				UpdateExpression:          expr.Update(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				ConditionExpression:       expr.Condition(),
+			},
+		}, putAudit)
+
+		for i := range update.Variants {
+			putVariant, err := putVariant(r.cfg, update.Current.Id, &update.Variants[i])
+			if err != nil {
+				return err
+			}
+			transactItems = append(transactItems, putVariant)
+		}
+	}
+
+	_, err := r.awsSvc.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) {
+			failed := []int{}
+			for idx := range joined {
+				if isConditionFailed(tce.CancellationReasons, idx) {
+					failed = append(failed, idx)
+				}
+			}
+			if len(failed) > 0 {
+				return &JoinedWriteError{Failed: failed, Err: err}
+			}
+		}
+
+		// a failed condition means a product was modified, or purged, since it was read
+		if utils.ClassifyAWSError(err) == utils.KindConditionFailed {
+			return fmt.Errorf("%w: stock of %d products", ErrVersionMismatch, len(updates))
+		}
+		return fmt.Errorf("error changing stock: %w", err)
+	}
+
+	return nil
+}
+
+// History queries the changes of the product newest first, the cursor being the encoded LastEvaluatedKey
+// of the previous page
+func (r *DynamoDBRepository) History(ctx context.Context, id string, limit int32, cursor string) (*ChangesPage, error) {
+	startKey, err := utils.DecodeCursor(cursor)
+	if err != nil {
+		return nil, &ValidationError{Msg: err.Error()}
+	}
+
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.
+			Key("productId").Equal(expression.Value(id)),
+	).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building query expression: %v", err)
+	}
+
+	queryOutput, err := r.awsSvc.DDBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(r.cfg.ProductsAuditTable),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(limit),
+		ExclusiveStartKey:         startKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error query items: %w", err)
+	}
+
+	page := &ChangesPage{Items: []Change{}}
+	if err := attributevalue.UnmarshalListOfMaps(queryOutput.Items, &page.Items); err != nil {
+		return nil, fmt.Errorf("error unmarshalling query output: %v", err)
+	}
+
+	page.Next, err = utils.EncodeCursor(queryOutput.LastEvaluatedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cursor: %v", err)
+	}
+
+	return page, nil
+}
+
+// Every item of the products table is keyed by id and a sort key telling what it holds, so that a product
+// and its variants form one item collection, read with a single Query
+const (
+	productSk       = "product"
+	variantSkPrefix = "variant#"
+	skuLookupSk     = "sku"
+)
+
+func productKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+		"sk": &types.AttributeValueMemberS{Value: productSk},
+	}
+}
+
+func variantKey(productId, variantId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: productId},
+		"sk": &types.AttributeValueMemberS{Value: variantSkPrefix + variantId},
+	}
+}
+
+// versionCondition guards a write on the product existing at version. Products written before versions
+// were introduced have no version attribute, and are read as version 0
+func versionCondition(version int64) expression.ConditionBuilder {
+	cond := expression.Name("version").Equal(expression.Value(version))
+	if version == 0 {
+		cond = cond.Or(expression.AttributeNotExists(expression.Name("version")))
+	}
+	return expression.AttributeExists(expression.Name("id")).And(cond)
+}
+
+// isConditionFailed reports whether the transaction was cancelled by the condition of the action at idx
+func isConditionFailed(reasons []types.CancellationReason, idx int) bool {
+	return idx < len(reasons) && aws.ToString(reasons[idx].Code) == "ConditionalCheckFailed"
+}
+
+const (
+	// batchGetSize is the most keys a single BatchGetItem call accepts
+	batchGetSize = 100
+	// batchGetAttempts bounds the calls made for a chunk of keys DynamoDB keeps handing back as unprocessed
+	batchGetAttempts = 5
+)
+
+// batchGetBackoff is the wait before the first retry of unprocessed keys, doubled on every following one
+var batchGetBackoff = 50 * time.Millisecond
+
+// batchGetItems reads the products with the given keys, retrying the keys DynamoDB leaves unprocessed
+// when the batch exceeds the response size or the table throughput, with exponential backoff
+func (r *DynamoDBRepository) batchGetItems(ctx context.Context, keys []map[string]types.AttributeValue, consistent bool) ([]Item, error) {
+	items := []Item{}
+	request := map[string]types.KeysAndAttributes{
+		r.cfg.ProductsTable: {Keys: keys, ConsistentRead: aws.Bool(consistent)},
+	}
+	backoff := batchGetBackoff
+
+	for attempt := 1; ; attempt++ {
+		batchOutput, err := r.awsSvc.DDBClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: request,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error batch getting items: %w", err)
+		}
+
+		page := []Item{}
+		if err := attributevalue.UnmarshalListOfMaps(batchOutput.Responses[r.cfg.ProductsTable], &page); err != nil {
+			return nil, fmt.Errorf("error unmarshalling batch get output: %v", err)
+		}
+		items = append(items, page...)
+
+		unprocessed := batchOutput.UnprocessedKeys[r.cfg.ProductsTable]
+		if len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		if attempt == batchGetAttempts {
+			return nil, fmt.Errorf("error batch getting items: %d keys still unprocessed after %d attempts", len(unprocessed.Keys), attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error batch getting items: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		request = map[string]types.KeysAndAttributes{r.cfg.ProductsTable: unprocessed}
+	}
+}
@@ -2,15 +2,78 @@ package products
 
 import (
 	"context"
-	aws_services "store_apis/pkg/aws"
-	"store_apis/pkg/config"
+	"encoding/json"
+	"time"
 
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// IProduct manages the store catalog. It works on domain types only, so it can be driven by the HTTP
+// routes in ctrl.go as well as by queue consumers, CLI tools or other Lambdas. ChangeStock is the exception,
+// taking the DynamoDB writes other domains commit along with the stock
 type IProduct interface {
-	createOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error)
-	readOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error)
-	updateOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error)
-	deleteOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error)
+	CreateProduct(ctx context.Context, product *Product) (*Item, error)
+	GetProduct(ctx context.Context, id string, opts ReadOptions) (*Item, error)
+	// GetProducts reads the products with the given ids at once, in the order they are requested
+	GetProducts(ctx context.Context, ids []string, opts ReadOptions) (*ItemsBatch, error)
+	ListProducts(ctx context.Context, limit int32, cursor string, opts ReadOptions) (*ItemsPage, error)
+	// UpdateProduct, PatchProduct and DeleteProduct only write the product if it is at version, or AnyVersion
+	UpdateProduct(ctx context.Context, id string, version int64, product *Product) (*Item, error)
+	PatchProduct(ctx context.Context, id string, version int64, patch map[string]json.RawMessage) (*Item, error)
+	DeleteProduct(ctx context.Context, id string, version int64) error
+	RestoreProduct(ctx context.Context, id string, version int64) (*Item, error)
+	// PurgeDeletedProducts is run on a schedule to drop the products deleted longer than the retention period
+	PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int, error)
+	// ProductHistory pages through the changes made to the product, newest first
+	ProductHistory(ctx context.Context, id string, limit int32, cursor string) (*ChangesPage, error)
+	// CreateVariant, UpdateVariant and DeleteVariant only write the variant if its product is at version, or
+	// AnyVersion, and return the product as stored. The product is read with its variants by GetProduct
+	CreateVariant(ctx context.Context, productId string, version int64, variant *Variant) (*VariantItem, *Item, error)
+	UpdateVariant(ctx context.Context, productId, variantId string, version int64, variant *Variant) (*VariantItem, *Item, error)
+	DeleteVariant(ctx context.Context, productId, variantId string, version int64) (*Item, error)
+	// AddImage and UpdateImages only write the images if the product is at version, or AnyVersion. AddImage
+	// returns the upload the client sends the file of the image with
+	AddImage(ctx context.Context, productId string, version int64, image *Image) (*ImageUpload, *Item, error)
+	UpdateImages(ctx context.Context, productId string, version int64, texts []ImageText) (*Item, error)
+	// SetThumbnails records the thumbnails generated for an image of the product, on whatever version it is at
+	SetThumbnails(ctx context.Context, productId, key string, thumbnails []Thumbnail) (*Item, error)
+	// ChangeStock applies the stock changes in one transaction with joined, failing with JoinedWriteError when
+	// the conditions of joined fail, and returns the products as stored
+	ChangeStock(ctx context.Context, action string, changes []StockChange, joined []types.TransactWriteItem) ([]Item, error)
+}
+
+// ProductRepository persists the products. Implementations report a missing product as ErrNotFound,
+// a SKU taken by another product as ErrSkuInUse and a write to a product no longer at the version it was
+// read at as ErrVersionMismatch, wrapped with the offending id or SKU
+type ProductRepository interface {
+	// Create, Update and Delete write the product together with the change appended to its history, so
+	// either both are stored or neither is
+	Create(ctx context.Context, item *Item, change *Change) error
+	// Get, BatchGet and List leave out deleted products unless opts include them. Get reports them as
+	// ErrNotFound and BatchGet as missing. Only Get reads the variants of the product
+	Get(ctx context.Context, id string, opts ReadOptions) (*Item, error)
+	// BatchGet reads the products with the given distinct ids, reporting the ids with no product as missing
+	BatchGet(ctx context.Context, ids []string, opts ReadOptions) (*ItemsBatch, error)
+	// List returns a page of at most limit products. The cursor is opaque, taken from ItemsPage.Next
+	List(ctx context.Context, limit int32, cursor string, opts ReadOptions) (*ItemsPage, error)
+	// Update writes the attributes of the update, guarded on the product still being at the version of
+	// update.Current, and returns it as stored. A new sku is claimed in place of the one of update.Current
+	Update(ctx context.Context, update *ItemUpdate, change *Change) (*Item, error)
+	// Delete removes the product for good along with its SKU and its variants, guarded on it still being
+	// deleted at the version of current
+	Delete(ctx context.Context, current *Item, change *Change) error
+	// WriteVariant writes the variant of the write with its SKU, guarded on the product still being at the
+	// version of write.Product, bumps the version of the product and returns it as stored
+	WriteVariant(ctx context.Context, write *VariantWrite, change *Change) (*Item, error)
+	// History returns a page of at most limit changes of the product, newest first
+	History(ctx context.Context, id string, limit int32, cursor string) (*ChangesPage, error)
+	// ChangeStock writes the stock updates with their changes, each guarded on its product still being at the
+	// version of update.Current, in one transaction with joined, writes to tables outside of the repository
+	ChangeStock(ctx context.Context, updates []StockUpdate, joined []types.TransactWriteItem) error
+}
+
+// ImageStore holds the image files of the products, which clients upload straight to it
+type ImageStore interface {
+	// PresignUpload signs a request uploading a file of contentType and exactly size bytes under key
+	PresignUpload(ctx context.Context, key, contentType string, size int64) (*ImageUpload, error)
 }
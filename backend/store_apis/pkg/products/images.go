@@ -0,0 +1,229 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/validator.v2"
+)
+
+// Image describes an image file a client is about to upload for a product
+type Image struct {
+	ContentType string `json:"contentType" validate:"nonzero"`
+	Size        int64  `json:"size" validate:"min=1"` // in bytes, the upload must be exactly this size
+	Alt         string `json:"alt" validate:"max=250"`
+}
+
+// ImageItem is an image of a product, stored in the order the images are shown. It is listed as soon as its
+// upload is handed out, so its file may not be in the store yet
+type ImageItem struct {
+	Key         string `dynamodbav:"key"` // of the file in the image store
+	ContentType string `dynamodbav:"contentType"`
+	Alt         string `dynamodbav:"alt,omitempty"`
+	DateAdded   int64  `dynamodbav:"dateAdded"`
+
+	Thumbnails []Thumbnail `dynamodbav:"thumbnails,omitempty" json:",omitempty"` // set once the file is uploaded and resized
+}
+
+// Thumbnail is a resized copy of an image, fitting in a square of Size pixels with the aspect ratio of the image
+type Thumbnail struct {
+	Size   int    `dynamodbav:"size"`
+	Key    string `dynamodbav:"key"`
+	Width  int    `dynamodbav:"width"`
+	Height int    `dynamodbav:"height"`
+}
+
+// ImageText sets the place and alt text of an image already added to a product
+type ImageText struct {
+	Key string `json:"key" validate:"nonzero"`
+	Alt string `json:"alt" validate:"max=250"`
+}
+
+// ImageUpload is the request a client sends to upload the file of an image. The headers are signed and must
+// be sent as they are, so the store refuses a file of another type or size
+type ImageUpload struct {
+	Image     ImageItem         `json:"image"`
+	Url       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt int64             `json:"expiresAt"` // in epoch seconds
+}
+
+const (
+	// ImagesPrefix starts the keys of the image files uploaded for products
+	ImagesPrefix = "products/"
+	// ThumbnailsPrefix starts the keys of the thumbnails, kept apart from the uploads so writing them does not
+	// trigger another resize
+	ThumbnailsPrefix = "thumbnails/"
+	// MaxImages bounds the images of a product
+	MaxImages = 20
+	// MaxImageSize bounds the size of an image file, in bytes
+	MaxImageSize = 10 << 20
+)
+
+// ErrImageNotFound means the product has no image with the key, as when it was removed after its upload
+var ErrImageNotFound = errors.New("no image of the product with key")
+
+// imageExtensions maps the content types accepted for images to the extension of their keys
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+func imageKey(productId, contentType string) string {
+	return ImagesPrefix + productId + "/" + uuid.New().String() + imageExtensions[contentType]
+}
+
+// ImageProductId returns the id of the product an image file was uploaded for, from its key
+func ImageProductId(key string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, ImagesPrefix), "/")
+	if !strings.HasPrefix(key, ImagesPrefix) || len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// ThumbnailKey derives the key of the thumbnail of size from the key of its image
+func ThumbnailKey(key string, size int) string {
+	return ThumbnailsPrefix + strconv.Itoa(size) + "/" + key
+}
+
+func validateImage(image *Image) error {
+	if err := validator.WithPrintJSON(true).Validate(image); err != nil {
+		return &ValidationError{Msg: "error image validation", Err: err}
+	}
+	if _, ok := imageExtensions[image.ContentType]; !ok {
+		return &ValidationError{Msg: fmt.Sprintf("images must be image/jpeg or image/png, not %v", image.ContentType)}
+	}
+	if image.Size > MaxImageSize {
+		return &ValidationError{Msg: fmt.Sprintf("images cannot be larger than %d bytes", MaxImageSize)}
+	}
+	return nil
+}
+
+// AddImage hands out the upload of a new image of the product with the given id, as long as it is still at
+// version, and lists the image last among those of the product
+func (s *Service) AddImage(ctx context.Context, productId string, version int64, image *Image) (*ImageUpload, *Item, error) {
+	if err := validateImage(image); err != nil {
+		return nil, nil, err
+	}
+
+	current, err := s.getVersion(ctx, productId, version, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(current.Images) >= MaxImages {
+		return nil, nil, &ValidationError{Msg: fmt.Sprintf("products cannot have more than %d images", MaxImages)}
+	}
+
+	added := ImageItem{
+		Key:         imageKey(productId, image.ContentType),
+		ContentType: image.ContentType,
+		Alt:         image.Alt,
+		DateAdded:   time.Now().UTC().Unix(),
+	}
+
+	upload, err := s.images.PresignUpload(ctx, added.Key, added.ContentType, image.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	upload.Image = added
+
+	images := append(append([]ImageItem{}, current.Images...), added)
+	updated, err := s.update(ctx, ActionAddImage, &ItemUpdate{
+		Current: current,
+		Set:     map[string]interface{}{"images": images},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return upload, updated, nil
+}
+
+// UpdateImages orders the images of the product with the given id as listed, setting their alt text, as
+// long as it is still at version. Images left out are removed from the product, their files staying in
+// the store
+func (s *Service) UpdateImages(ctx context.Context, productId string, version int64, texts []ImageText) (*Item, error) {
+	for i := range texts {
+		if err := validator.WithPrintJSON(true).Validate(&texts[i]); err != nil {
+			return nil, &ValidationError{Msg: "error image validation", Err: err}
+		}
+	}
+
+	current, err := s.getVersion(ctx, productId, version, false)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]ImageItem, len(current.Images))
+	for _, image := range current.Images {
+		byKey[image.Key] = image
+	}
+
+	images := make([]ImageItem, 0, len(texts))
+	for _, text := range texts {
+		image, ok := byKey[text.Key]
+		if !ok {
+			return nil, &ValidationError{Msg: fmt.Sprintf("no image of the product with key: %v", text.Key)}
+		}
+		// listing an image twice would find it gone the second time
+		delete(byKey, text.Key)
+
+		image.Alt = text.Alt
+		images = append(images, image)
+	}
+
+	update := &ItemUpdate{Current: current, Set: map[string]interface{}{}}
+	if len(images) == 0 {
+		update.Remove = []string{"images"}
+	} else {
+		update.Set["images"] = images
+	}
+	return s.update(ctx, ActionUpdateImages, update)
+}
+
+// thumbnailAttempts bounds the writes SetThumbnails tries, as other writes to the product can come first
+const thumbnailAttempts = 3
+
+// SetThumbnails records the thumbnails of the image with the given key on the product, whatever version it
+// is at. The version is bumped as for any write, so clients holding the previous ETag must read it again
+func (s *Service) SetThumbnails(ctx context.Context, productId, key string, thumbnails []Thumbnail) (*Item, error) {
+	var err error
+	for attempt := 0; attempt < thumbnailAttempts; attempt++ {
+		var updated *Item
+		updated, err = s.setThumbnails(ctx, productId, key, thumbnails)
+		if !errors.Is(err, ErrVersionMismatch) {
+			return updated, err
+		}
+	}
+	return nil, err
+}
+
+func (s *Service) setThumbnails(ctx context.Context, productId, key string, thumbnails []Thumbnail) (*Item, error) {
+	current, err := s.getVersion(ctx, productId, AnyVersion, false)
+	if err != nil {
+		return nil, err
+	}
+
+	images := append([]ImageItem{}, current.Images...)
+	found := false
+	for i := range images {
+		if images[i].Key == key {
+			images[i].Thumbnails = thumbnails
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %v", ErrImageNotFound, key)
+	}
+
+	return s.update(ctx, ActionSetThumbnails, &ItemUpdate{
+		Current: current,
+		Set:     map[string]interface{}{"images": images},
+	})
+}
@@ -0,0 +1,243 @@
+package products
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MemoryRepository keeps the products in memory, enforcing the same SKU uniqueness as the table.
+// It backs tests of the product rules and tools that need no persistence
+type MemoryRepository struct {
+	mu      sync.Mutex
+	items   map[string]Item
+	skus    map[string]string   // sku key to product id
+	changes map[string][]Change // product id to its changes, oldest first
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		items:   map[string]Item{},
+		skus:    map[string]string{},
+		changes: map[string][]Change{},
+	}
+}
+
+var _ ProductRepository = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) Create(ctx context.Context, item *Item, change *Change) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.skus[skuKey(item.Sku)]; ok {
+		return fmt.Errorf("%w: %v", ErrSkuInUse, item.Sku)
+	}
+
+	r.items[item.Id] = *item
+	r.skus[skuKey(item.Sku)] = item.Id
+	r.changes[item.Id] = append(r.changes[item.Id], *change)
+	return nil
+}
+
+// Get is always consistent, there being no replicas to lag behind
+func (r *MemoryRepository) Get(ctx context.Context, id string, opts ReadOptions) (*Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, ok := r.items[id]
+	if !ok || (item.Deleted() && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, id)
+	}
+	return &item, nil
+}
+
+func (r *MemoryRepository) BatchGet(ctx context.Context, ids []string, opts ReadOptions) (*ItemsBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch := &ItemsBatch{Items: []Item{}, Missing: []string{}}
+	for _, id := range ids {
+		item, ok := r.items[id]
+		if !ok || (item.Deleted() && !opts.IncludeDeleted) {
+			batch.Missing = append(batch.Missing, id)
+			continue
+		}
+		batch.Items = append(batch.Items, item)
+	}
+	return batch, nil
+}
+
+// List pages through the products in id order, the cursor being the id of the last product of the previous page
+func (r *MemoryRepository) List(ctx context.Context, limit int32, cursor string, opts ReadOptions) (*ItemsPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.items))
+	for id, item := range r.items {
+		if id > cursor && (!item.Deleted() || opts.IncludeDeleted) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	page := &ItemsPage{Items: []Item{}}
+	for _, id := range ids {
+		if len(page.Items) == int(limit) {
+			page.Next = page.Items[len(page.Items)-1].Id
+			break
+		}
+		page.Items = append(page.Items, r.items[id])
+	}
+	return page, nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, update *ItemUpdate, change *Change) (*Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := update.Current.Id
+	stored, ok := r.items[id]
+	if !ok || stored.Version != update.Current.Version {
+		return nil, fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+	}
+
+	updated, err := update.applyTo(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	if newSku, changed := update.newSku(); changed {
+		if _, ok := r.skus[skuKey(newSku)]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrSkuInUse, newSku)
+		}
+		delete(r.skus, skuKey(update.Current.Sku))
+		r.skus[skuKey(newSku)] = id
+	}
+
+	r.items[id] = *updated
+	r.changes[id] = append(r.changes[id], *change)
+	return updated, nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, current *Item, change *Change) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.items[current.Id]
+	if !ok || stored.Version != current.Version || !stored.Deleted() {
+		return fmt.Errorf("%w: %v", ErrVersionMismatch, current.Id)
+	}
+
+	delete(r.items, current.Id)
+	for _, sku := range append([]string{stored.Sku}, variantSkus(&stored)...) {
+		if r.skus[skuKey(sku)] == current.Id {
+			delete(r.skus, skuKey(sku))
+		}
+	}
+	r.changes[current.Id] = append(r.changes[current.Id], *change)
+	return nil
+}
+
+func (r *MemoryRepository) WriteVariant(ctx context.Context, write *VariantWrite, change *Change) (*Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := write.Product.Id
+	stored, ok := r.items[id]
+	if !ok || stored.Version != write.Product.Version {
+		return nil, fmt.Errorf("%w: %v", ErrVersionMismatch, id)
+	}
+
+	if newSku, claimed := write.newSku(); claimed {
+		if _, ok := r.skus[skuKey(newSku)]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrSkuInUse, newSku)
+		}
+		r.skus[skuKey(newSku)] = id
+	}
+	if oldSku, released := write.oldSku(); released {
+		delete(r.skus, skuKey(oldSku))
+	}
+
+	updated := write.applyTo(&stored)
+	r.items[id] = *updated
+	r.changes[id] = append(r.changes[id], *change)
+	return updated, nil
+}
+
+// ChangeStock applies the updates alone: the repository has no tables for joined writes to go to, so it
+// refuses any
+func (r *MemoryRepository) ChangeStock(ctx context.Context, updates []StockUpdate, joined []types.TransactWriteItem) error {
+	if len(joined) > 0 {
+		return fmt.Errorf("error changing stock: %d joined writes, the memory repository cannot take part in transactions", len(joined))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, update := range updates {
+		if stored, ok := r.items[update.Current.Id]; !ok || stored.Version != update.Current.Version {
+			return fmt.Errorf("%w: %v", ErrVersionMismatch, update.Current.Id)
+		}
+	}
+
+	for _, update := range updates {
+		stored := r.items[update.Current.Id]
+		stored.Stock = update.Updated.Stock
+		stored.Reserved = update.Updated.Reserved
+		stored.Version = update.Updated.Version
+		stored.DateModified = update.Updated.DateModified
+		if len(update.Variants) > 0 {
+			stored.Variants = append([]VariantItem(nil), stored.Variants...)
+			for _, variant := range update.Variants {
+				if v, ok := stored.Variant(variant.Id); ok {
+					*v = variant
+				}
+			}
+		}
+		r.items[stored.Id] = stored
+		r.changes[stored.Id] = append(r.changes[stored.Id], *update.Change)
+	}
+	return nil
+}
+
+func variantSkus(item *Item) []string {
+	skus := make([]string, 0, len(item.Variants))
+	for _, variant := range item.Variants {
+		skus = append(skus, variant.Sku)
+	}
+	return skus
+}
+
+// History pages through the changes newest first, the cursor being the version of the last change of the
+// previous page
+func (r *MemoryRepository) History(ctx context.Context, id string, limit int32, cursor string) (*ChangesPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := int64(-1)
+	if len(cursor) > 0 {
+		v, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, &ValidationError{Msg: fmt.Sprintf("malformed cursor: %v", err)}
+		}
+		before = v
+	}
+
+	changes := r.changes[id]
+	page := &ChangesPage{Items: []Change{}}
+	for i := len(changes) - 1; i >= 0; i-- {
+		if before >= 0 && changes[i].Version >= before {
+			continue
+		}
+		if len(page.Items) == int(limit) {
+			page.Next = strconv.FormatInt(page.Items[len(page.Items)-1].Version, 10)
+			break
+		}
+		page.Items = append(page.Items, changes[i])
+	}
+	return page, nil
+}
@@ -1,23 +1,16 @@
 package products
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"strings"
 	"time"
 
-	aws_services "store_apis/pkg/aws"
-	"store_apis/pkg/config"
 	"store_apis/pkg/utils"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 	"gopkg.in/validator.v2"
 )
@@ -25,267 +18,468 @@ import (
 type Product struct {
 	Name        string `json:"name" validate:"nonzero"`
 	Description string `json:"description" validate:"nonzero"`
+	Price       int64  `json:"price" validate:"min=0"` // in minor units, e.g. cents
+	Currency    string `json:"currency" validate:"currency"`
+	Sku         string `json:"sku" validate:"nonzero"`
+	Stock       int64  `json:"stock" validate:"min=0"`
 }
 
 type Item struct {
 	Id           string `dynamodbav:"id"`
 	DateModified int64  `dynamodbav:"dateModified"`
+	Version      int64  `dynamodbav:"version"` // bumped by every write to the item, served as its ETag
 	Name         string `dynamodbav:"name"`
 	Description  string `dynamodbav:"description"`
+	Price        int64  `dynamodbav:"price"`
+	Currency     string `dynamodbav:"currency"`
+	Sku          string `dynamodbav:"sku"`
+	Stock        int64  `dynamodbav:"stock"`    // available units
+	Reserved     int64  `dynamodbav:"reserved"` // units held by inventory reservations
+	Status       string `dynamodbav:"status"`
+	DeletedAt    int64  `dynamodbav:"deletedAt,omitempty"` // set while the product is deleted, in epoch seconds
+
+	Images []ImageItem `dynamodbav:"images,omitempty" json:",omitempty"` // in the order they are shown
+
+	// Variants are stored as items of their own, only read along with the product by GetProduct
+	Variants []VariantItem `dynamodbav:"-" json:",omitempty"`
 }
 
-func (p *Product) createOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	product := new(Product)
-	if err := json.NewDecoder(strings.NewReader(request.Body)).Decode(product); err != nil {
-		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
+// A deleted product stays in the table as a tombstone, so the orders referencing it can still be served,
+// until it is purged once the retention period is over
+const (
+	StatusActive  = "active"
+	StatusDeleted = "deleted"
+)
+
+func (i *Item) Deleted() bool {
+	return i.DeletedAt != 0
+}
+
+// ReadOptions tune product reads. The zero value reads eventually consistent and hides deleted products
+type ReadOptions struct {
+	Consistent     bool // see every write acknowledged before the read
+	IncludeDeleted bool
+}
+
+type ItemsPage struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// ItemsBatch holds the products read by id, in the order they were requested, and the ids not found
+type ItemsBatch struct {
+	Items   []Item   `json:"items"`
+	Missing []string `json:"missing"`
+}
+
+// ByID indexes the products read by their id
+func (b *ItemsBatch) ByID() map[string]*Item {
+	byID := make(map[string]*Item, len(b.Items))
+	for i := range b.Items {
+		byID[b.Items[i].Id] = &b.Items[i]
+	}
+	return byID
+}
+
+// ItemUpdate describes a write to the product attributes of a stored product
+type ItemUpdate struct {
+	Current *Item                  // the product as read before the update
+	Set     map[string]interface{} // attribute name to its new value
+	Remove  []string               // attributes to drop
+}
+
+// applyTo returns a copy of item with the update applied
+func (u *ItemUpdate) applyTo(item *Item) (*Item, error) {
+	avMap, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping attribute values: %v", err)
+	}
+
+	for name, value := range u.Set {
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("error mapping attribute value of %v: %v", name, err)
+		}
+		avMap[name] = av
+	}
+	for _, name := range u.Remove {
+		delete(avMap, name)
+	}
+
+	updated := new(Item)
+	if err := attributevalue.UnmarshalMap(avMap, updated); err != nil {
+		return nil, fmt.Errorf("error unmarshalling attribute values: %v", err)
+	}
+	updated.Variants = item.Variants
+	return updated, nil
+}
+
+// newSku returns the SKU set by the update, if it is not the one the product already has
+func (u *ItemUpdate) newSku() (string, bool) {
+	sku, ok := u.Set["sku"].(string)
+	if !ok || skuKey(sku) == skuKey(u.Current.Sku) {
+		return "", false
+	}
+	return sku, true
+}
+
+// productFields maps the JSON fields of a Product to the attributes of its Item
+var productFields = map[string]string{
+	"name":        "name",
+	"description": "description",
+	"price":       "price",
+	"currency":    "currency",
+	"sku":         "sku",
+	"stock":       "stock",
+}
+
+func productAttributes(product *Product) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        product.Name,
+		"description": product.Description,
+		"price":       product.Price,
+		"currency":    product.Currency,
+		"sku":         product.Sku,
+		"stock":       product.Stock,
+	}
+}
+
+func productOf(item *Item) *Product {
+	return &Product{
+		Name:        item.Name,
+		Description: item.Description,
+		Price:       item.Price,
+		Currency:    item.Currency,
+		Sku:         item.Sku,
+		Stock:       item.Stock,
 	}
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
 
-	if err := validator.Validate(product); err != nil {
-		msj := "error product validation"
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
+var (
+	ErrNotFound   = errors.New("no entries found with id")
+	ErrSkuInUse   = errors.New("sku already in use")
+	ErrNotDeleted = errors.New("product is not deleted")
+	// ErrRequiredField means a patch set to null a field every product must have, such as its price or stock
+	ErrRequiredField = errors.New("field is required and cannot be null")
+	// ErrVersionMismatch means the product changed since the version the write was based on
+	ErrVersionMismatch = errors.New("product was modified, version does not match")
+)
+
+// AnyVersion makes a write apply to whatever version of the product is stored, as `If-Match: *` does
+const AnyVersion int64 = -1
+
+// ValidationError is returned when the input of a product service call is rejected before reaching the table.
+// Err holds the validator.v2 errors, if any, for utils.ValidationErrors
+type ValidationError struct {
+	Msg string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return fmt.Sprintf("%v: %v", e.Msg, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Service is the IProduct enforcing the catalog rules on top of a ProductRepository. It hands out the uploads
+// of product images from an ImageStore
+type Service struct {
+	repo   ProductRepository
+	images ImageStore
+}
+
+func NewService(repo ProductRepository, images ImageStore) *Service {
+	return &Service{repo: repo, images: images}
+}
+
+var _ IProduct = (*Service)(nil)
+
+func (s *Service) CreateProduct(ctx context.Context, product *Product) (*Item, error) {
+	if err := validator.WithPrintJSON(true).Validate(product); err != nil {
+		return nil, &ValidationError{Msg: "error product validation", Err: err}
 	}
 
 	item := &Item{
 		Id:           uuid.New().String(),
 		DateModified: time.Now().UTC().Unix(),
+		Version:      1,
+		Status:       StatusActive,
 		Name:         product.Name,
 		Description:  product.Description,
+		Price:        product.Price,
+		Currency:     product.Currency,
+		Sku:          product.Sku,
+		Stock:        product.Stock,
 	}
 
-	avMap, err := attributevalue.MarshalMap(item)
+	change, err := newChange(ctx, ActionCreate, nil, item, item.DateModified)
 	if err != nil {
-		msj := fmt.Sprintf("error mapping attribute values: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, item, change); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (s *Service) GetProduct(ctx context.Context, id string, opts ReadOptions) (*Item, error) {
+	return s.repo.Get(ctx, id, opts)
+}
+
+// GetProducts reads up to utils.MaxPageLimit products by id. Ids requested twice are read once
+func (s *Service) GetProducts(ctx context.Context, ids []string, opts ReadOptions) (*ItemsBatch, error) {
+	if len(ids) == 0 || len(ids) > int(utils.MaxPageLimit) {
+		return nil, &ValidationError{Msg: fmt.Sprintf("ids must hold between 1 and %d product ids", utils.MaxPageLimit)}
+	}
+
+	distinct := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if len(id) == 0 {
+			return nil, &ValidationError{Msg: "ids must not be empty"}
+		}
+		if !seen[id] {
+			seen[id] = true
+			distinct = append(distinct, id)
+		}
+	}
+
+	return s.repo.BatchGet(ctx, distinct, opts)
+}
+
+// ListProducts returns a page of at most limit products, starting after the cursor of the previous page
+func (s *Service) ListProducts(ctx context.Context, limit int32, cursor string, opts ReadOptions) (*ItemsPage, error) {
+	if limit < 1 || limit > utils.MaxPageLimit {
+		return nil, &ValidationError{Msg: fmt.Sprintf("limit must be an integer between 1 and %d", utils.MaxPageLimit)}
 	}
 
-	input := &dynamodb.PutItemInput{
-		TableName: aws.String(cfg.ProductsTable),
-		Item:      avMap,
+	return s.repo.List(ctx, limit, cursor, opts)
+}
+
+// UpdateProduct replaces the fields of the product with the given id, as long as it is still at version,
+// and returns it as stored
+func (s *Service) UpdateProduct(ctx context.Context, id string, version int64, product *Product) (*Item, error) {
+	if err := validator.WithPrintJSON(true).Validate(product); err != nil {
+		return nil, &ValidationError{Msg: "error product validation", Err: err}
 	}
-	_, err = awsSvc.DDBClient.PutItem(ctx, input)
+
+	current, err := s.getVersion(ctx, id, version, false)
 	if err != nil {
-		msj := fmt.Sprintf("error putting item: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	msj := fmt.Sprintf("successfully created product with id: %s", item.Id)
-	return utils.SendOK(&utils.APIResponse{
-		StatusCode: http.StatusCreated,
-		Data:       msj,
-		LogMessage: msj,
+		return nil, err
+	}
+
+	return s.update(ctx, ActionUpdate, &ItemUpdate{
+		Current: current,
+		Set:     productAttributes(product),
 	})
 }
 
-func (p *Product) readOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	id := request.PathParameters["id"]
-	if len(id) == 0 {
-		msj := fmt.Sprint("empty id on path params") //nolint:all
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
+// PatchProduct applies a JSON merge patch (RFC 7396) to the product with the given id. Only the fields in
+// the patch are written and the patched product must still be valid. Every product field is required, so a
+// null, which would remove it, is rejected with ErrRequiredField
+func (s *Service) PatchProduct(ctx context.Context, id string, version int64, patch map[string]json.RawMessage) (*Item, error) {
+	for field := range patch {
+		if _, ok := productFields[field]; !ok {
+			return nil, &ValidationError{Msg: fmt.Sprintf("unknown field in patch: %v", field)}
+		}
+		if isNull(patch[field]) {
+			return nil, fmt.Errorf("%w: %v", ErrRequiredField, field)
+		}
 	}
 
-	expr, err := expression.NewBuilder().WithKeyCondition(
-		expression.
-			Key("id").Equal(expression.Value(id)),
-	).Build()
+	current, err := s.getVersion(ctx, id, version, false)
 	if err != nil {
-		msj := fmt.Sprintf("error building query expression: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, err
 	}
 
-	queryInput := &dynamodb.QueryInput{
-		TableName:                 aws.String(cfg.ProductsTable),
-		KeyConditionExpression:    expr.KeyCondition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		Limit:                     aws.Int32(1), // expecting one record only
+	if len(patch) == 0 {
+		return current, nil
 	}
 
-	queryOutput, err := awsSvc.DDBClient.Query(ctx, queryInput)
+	doc, err := json.Marshal(productOf(current))
 	if err != nil {
-		msj := fmt.Sprintf("error query item: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, fmt.Errorf("error marshalling product: %v", err)
 	}
 
-	if len(queryOutput.Items) == 0 {
-		msj := fmt.Sprintf("no entries found with id: %v", id)
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+	merged := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &merged); err != nil {
+		return nil, fmt.Errorf("error unmarshalling product: %v", err)
 	}
 
-	item := new(Item)
-	err = attributevalue.UnmarshalMap(queryOutput.Items[0], item)
+	for field, value := range patch {
+		merged[field] = value
+	}
+
+	doc, err = json.Marshal(merged)
 	if err != nil {
-		msj := fmt.Sprintf("error unmarshalling query output: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
+		return nil, fmt.Errorf("error marshalling patched product: %v", err)
 	}
 
-	out, err := json.Marshal(item)
+	product := new(Product)
+	if err := json.Unmarshal(doc, product); err != nil {
+		return nil, &ValidationError{Msg: fmt.Sprintf("error decoding patched product: %v", err)}
+	}
+
+	if err := validator.WithPrintJSON(true).Validate(product); err != nil {
+		return nil, &ValidationError{Msg: "error product validation", Err: err}
+	}
+
+	update := &ItemUpdate{
+		Current: current,
+		Set:     map[string]interface{}{},
+	}
+	attributes := productAttributes(product)
+	for field := range patch {
+		update.Set[productFields[field]] = attributes[productFields[field]]
+	}
+
+	return s.update(ctx, ActionUpdate, update)
+}
+
+// DeleteProduct marks the product as deleted, hiding it from reads. Its SKU stays taken until it is purged,
+// so it can always be restored
+func (s *Service) DeleteProduct(ctx context.Context, id string, version int64) error {
+	current, err := s.getVersion(ctx, id, version, false)
 	if err != nil {
-		msj := fmt.Sprintf("error marshalling item: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	return utils.SendOK(&utils.APIResponse{
-		StatusCode: http.StatusOK,
-		Data:       string(out),
-		LogMessage: string(out),
+		return err
+	}
+
+	_, err = s.update(ctx, ActionDelete, &ItemUpdate{
+		Current: current,
+		Set: map[string]interface{}{
+			"status":    StatusDeleted,
+			"deletedAt": time.Now().UTC().Unix(),
+		},
 	})
+	return err
 }
 
-func (p *Product) updateOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	id := request.PathParameters["id"]
-	if len(id) == 0 {
-		msj := fmt.Sprint("empty id on path params") //nolint:all
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
+// RestoreProduct brings back a deleted product, as long as it is still at version and not purged yet
+func (s *Service) RestoreProduct(ctx context.Context, id string, version int64) (*Item, error) {
+	current, err := s.getVersion(ctx, id, version, true)
+	if err != nil {
+		return nil, err
 	}
 
-	product := new(Product)
-	err := json.NewDecoder(strings.NewReader(request.Body)).Decode(product)
-	if err != nil {
-		msj := fmt.Sprintf("error decoding request body: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	expr, err := expression.NewBuilder().WithUpdate(
-		expression.
-			Set(expression.Name("name"), expression.Value(product.Name)).
-			Set(expression.Name("description"), expression.Value(product.Description)),
-	).WithCondition(
-		expression.
-			AttributeExists(expression.Name("id")),
-	).Build()
-	if err != nil {
-		msj := fmt.Sprintf("error building update expression: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	updateInput := &dynamodb.UpdateItemInput{
-		TableName: aws.String(cfg.ProductsTable),
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: id},
-		},
-		UpdateExpression:          expr.Update(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		ConditionExpression:       expr.Condition(),
+	if !current.Deleted() {
+		return nil, fmt.Errorf("%w: %v", ErrNotDeleted, id)
 	}
-	_, err = awsSvc.DDBClient.UpdateItem(ctx, updateInput)
-	if err != nil {
-		msj := fmt.Sprintf("error updating item with id: %v. error: %v", id, err)
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	msj := fmt.Sprintf("product with id: %v, was successfully updated", id)
-	return utils.SendOK(&utils.APIResponse{
-		StatusCode: 200,
-		Data:       msj,
-		LogMessage: msj,
+
+	return s.update(ctx, ActionRestore, &ItemUpdate{
+		Current: current,
+		Set:     map[string]interface{}{"status": StatusActive},
+		Remove:  []string{"deletedAt"},
 	})
 }
 
-func (p *Product) deleteOneProduct(ctx context.Context, request events.APIGatewayProxyRequest, cfg *config.Cfg, awsSvc *aws_services.AWS) (events.APIGatewayProxyResponse, error) {
-	id := request.PathParameters["id"]
-	if len(id) == 0 {
-		msj := fmt.Sprintf("empty id on path params") //nolint:all
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusBadRequest,
-			Data:       msj,
-			LogMessage: msj,
-		})
+// PurgeDeletedProducts removes for good the products deleted before deletedBefore, returning how many
+func (s *Service) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	cursor := ""
+	for {
+		page, err := s.repo.List(ctx, utils.MaxPageLimit, cursor, ReadOptions{IncludeDeleted: true})
+		if err != nil {
+			return purged, err
+		}
+
+		for i := range page.Items {
+			item := &page.Items[i]
+			if !item.Deleted() || item.DeletedAt > deletedBefore.Unix() {
+				continue
+			}
+
+			change, err := newChange(ctx, ActionPurge, item, nil, time.Now().UTC().Unix())
+			if err != nil {
+				return purged, err
+			}
+
+			err = s.repo.Delete(ctx, item, change)
+			// restored or purged concurrently
+			if errors.Is(err, ErrVersionMismatch) {
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(page.Next) == 0 {
+			return purged, nil
+		}
+		cursor = page.Next
+	}
+}
+
+// ProductHistory returns a page of at most limit changes of the product, newest first. It is kept after the
+// product is purged
+func (s *Service) ProductHistory(ctx context.Context, id string, limit int32, cursor string) (*ChangesPage, error) {
+	if limit < 1 || limit > utils.MaxPageLimit {
+		return nil, &ValidationError{Msg: fmt.Sprintf("limit must be an integer between 1 and %d", utils.MaxPageLimit)}
 	}
 
-	expr, err := expression.NewBuilder().WithCondition(
-		expression.
-			AttributeExists(expression.Name("id")),
-	).Build()
+	return s.repo.History(ctx, id, limit, cursor)
+}
+
+// getVersion reads the product a write is based on, failing with ErrVersionMismatch when it is not at version.
+// Deleted products are not found, unless includeDeleted is set
+func (s *Service) getVersion(ctx context.Context, id string, version int64, includeDeleted bool) (*Item, error) {
+	// the version must be the latest, a stale read would only fail the write on its condition
+	current, err := s.repo.Get(ctx, id, ReadOptions{Consistent: true, IncludeDeleted: includeDeleted})
 	if err != nil {
-		msj := fmt.Sprintf("error building condition expression: %v", err.Error())
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	deleteInput := &dynamodb.DeleteItemInput{
-		TableName: aws.String(cfg.ProductsTable),
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: id},
-		},
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		ConditionExpression:       expr.Condition(),
+		return nil, err
+	}
+
+	if version != AnyVersion && current.Version != version {
+		return nil, fmt.Errorf("%w: %v is at version %d, not %d", ErrVersionMismatch, id, current.Version, version)
 	}
-	_, err = awsSvc.DDBClient.DeleteItem(ctx, deleteInput)
+	return current, nil
+}
+
+// update bumps the version and modification date along with the attributes of the update, recording it
+// as action in the history of the product
+func (s *Service) update(ctx context.Context, action string, update *ItemUpdate) (*Item, error) {
+	now := time.Now().UTC().Unix()
+	update.Set["version"] = update.Current.Version + 1
+	update.Set["dateModified"] = now
+
+	after, err := update.applyTo(update.Current)
 	if err != nil {
-		msj := fmt.Sprintf("error deleting item with id: %v", id)
-		return utils.SendErr(&utils.APIResponse{
-			StatusCode: http.StatusInternalServerError,
-			Data:       msj,
-			LogMessage: msj,
-		})
-	}
-
-	msj := fmt.Sprintf("product with id: %v, was successfully deleted", id)
-	return utils.SendOK(&utils.APIResponse{
-		StatusCode: 200,
-		Data:       msj,
-		LogMessage: msj,
-	})
+		return nil, err
+	}
+
+	change, err := newChange(ctx, action, update.Current, after, now)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.Update(ctx, update, change)
+	if err != nil {
+		return nil, s.writeErr(ctx, update.Current.Id, err)
+	}
+	return updated, nil
+}
+
+// writeErr tells apart the two reasons a write guarded on the version fails: the product was deleted,
+// or modified, since it was read
+func (s *Service) writeErr(ctx context.Context, id string, err error) error {
+	if !errors.Is(err, ErrVersionMismatch) {
+		return err
+	}
+
+	if _, getErr := s.repo.Get(ctx, id, ReadOptions{Consistent: true}); errors.Is(getErr, ErrNotFound) {
+		return getErr
+	}
+	return err
 }
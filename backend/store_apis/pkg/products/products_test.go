@@ -2,26 +2,52 @@ package products
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
 	"store_apis/pkg/config"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
 	mock_aws_services "store_apis/pkg/aws/mocks"
+	"store_apis/pkg/utils"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
 
+// newFakeDynamoDB creates the products and audit tables of cfg on an in-memory DynamoDB
+func newFakeDynamoDB(cfg *config.Cfg) *fake_aws_services.DynamoDB {
+	if len(cfg.ProductsAuditTable) == 0 {
+		cfg.ProductsAuditTable = cfg.ProductsTable + "-audit"
+	}
+
+	ddb := fake_aws_services.NewDynamoDB()
+	ddb.CreateTable(cfg.ProductsTable, "id", "sk")
+	ddb.CreateTable(cfg.ProductsAuditTable, "productId", "version")
+	return ddb
+}
+
 func Test_CreateOneProduct_ReturnOK(t *testing.T) {
 	body := `
 	{
 		"name": "valid product",
-  	"description": "valid product description"
+  	"description": "valid product description",
+		"price": 1999,
+		"currency": "USD",
+		"sku": "VP-001",
+		"stock": 10
 	}
 	`
 
@@ -45,20 +71,29 @@ func Test_CreateOneProduct_ReturnOK(t *testing.T) {
 
 	mockDdbClient.
 		EXPECT().
-		PutItem(gomock.Any(), gomock.Any()).
-		Return(nil, nil)
+		TransactWriteItems(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			assert.Len(t, in.TransactItems, 3) // the product, its sku lookup and its first change
+			assert.Equal(t, &types.AttributeValueMemberS{Value: "sku#VP-001"}, in.TransactItems[1].Put.Item["id"])
+			assert.Equal(t, in.TransactItems[0].Put.Item["id"], in.TransactItems[1].Put.Item["productId"])
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		})
 
 	awsSvc := &aws_services.AWS{
 		DDBClient: mockDdbClient,
 	}
 
-	p := new(Product)
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
 
-	resp, err := p.createOneProduct(context.TODO(), req, cfg, awsSvc)
+	resp, err := Post(context.TODO(), req, p)
 	assert.NoError(t, err)
 
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
-	assert.Contains(t, resp.Body, "successfully created product with id:")
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	assert.Equal(t, "/products/"+item.Id, resp.Headers["Location"])
+	assert.Equal(t, "VP-001", item.Sku)
 }
 
 func Test_CreateOneProduct_ReturnError(t *testing.T) {
@@ -90,16 +125,61 @@ func Test_CreateOneProduct_ReturnError(t *testing.T) {
 			expected:      http.StatusBadRequest,
 			expectedError: "error product validation",
 		},
+		{
+			name: "invalid_product_currency",
+			body: `
+				{
+					"name": "invalid product",
+					"description": "invalid product description",
+					"price": 1999,
+					"currency": "XXX",
+					"sku": "IP-001"
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "error product validation",
+		},
+		{
+			name: "invalid_product_price",
+			body: `
+				{
+					"name": "invalid product",
+					"description": "invalid product description",
+					"price": -1,
+					"currency": "USD",
+					"sku": "IP-001"
+				}
+			`,
+			expected:      http.StatusBadRequest,
+			expectedError: "error product validation",
+		},
+		{
+			name: "duplicated_sku",
+			body: `
+				{
+					"name": "valid product name",
+					"description": "valid product description",
+					"price": 1999,
+					"currency": "USD",
+					"sku": "VP-001"
+				}
+			`,
+			expected:      http.StatusConflict,
+			expectedError: "sku already in use: VP-001",
+		},
 		{
 			name: "error_putting_item",
 			body: `
 				{
 					"name": "valid product name",
-					"description": "valid product description"
+					"description": "valid product description",
+					"price": 1999,
+					"currency": "USD",
+					"sku": "VP-001"
 				}
 			`,
 			expected:      http.StatusInternalServerError,
-			expectedError: "error putting item",
+			expectedError: "error creating product: internal error",
 		},
 	}
 
@@ -123,16 +203,26 @@ func Test_CreateOneProduct_ReturnError(t *testing.T) {
 
 			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
 
-			switch st.expectedError {
-			case "error putting item":
+			switch st.name {
+			case "error_putting_item":
 				mockDdbClient.
 					EXPECT().
-					PutItem(gomock.Any(), gomock.Any()).
+					TransactWriteItems(gomock.Any(), gomock.Any()).
 					Return(nil, errors.New("error putting item: some detailed error"))
+			case "duplicated_sku":
+				mockDdbClient.
+					EXPECT().
+					TransactWriteItems(gomock.Any(), gomock.Any()).
+					Return(nil, &types.TransactionCanceledException{
+						CancellationReasons: []types.CancellationReason{
+							{Code: aws.String("None")},
+							{Code: aws.String("ConditionalCheckFailed")},
+						},
+					})
 			default:
 				mockDdbClient.
 					EXPECT().
-					PutItem(gomock.Any(), gomock.Any()).
+					TransactWriteItems(gomock.Any(), gomock.Any()).
 					Return(nil, nil).
 					AnyTimes() // expects zero or more calls
 			}
@@ -141,8 +231,8 @@ func Test_CreateOneProduct_ReturnError(t *testing.T) {
 				DDBClient: mockDdbClient,
 			}
 
-			p := new(Product)
-			resp, err := p.createOneProduct(context.TODO(), req, cfg, awsSvc)
+			p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+			resp, err := Post(context.TODO(), req, p)
 			assert.NoError(t, err)
 
 			assert.Equal(t, st.expected, resp.StatusCode)
@@ -150,3 +240,1704 @@ func Test_CreateOneProduct_ReturnError(t *testing.T) {
 		})
 	}
 }
+
+func Test_ListProducts_ReturnOK(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		Resource:              "/products",
+		Path:                  "/products",
+		HTTPMethod:            http.MethodGet,
+		QueryStringParameters: map[string]string{"limit": "1"},
+	}
+
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "test")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+
+	mockDdbClient.
+		EXPECT().
+		Scan(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			assert.Equal(t, int32(1), *in.Limit)
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"id":   &types.AttributeValueMemberS{Value: "100"},
+						"name": &types.AttributeValueMemberS{Value: "valid product"},
+					},
+				},
+				LastEvaluatedKey: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: "100"},
+				},
+			}, nil
+		})
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: mockDdbClient,
+	}
+
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+
+	resp, err := List(context.TODO(), req, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	page := new(ItemsPage)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+	assert.Len(t, page.Items, 1)
+	assert.NotEmpty(t, page.Next)
+
+	startKey, err := utils.DecodeCursor(page.Next)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "100"}, startKey["id"])
+}
+
+func Test_ListProducts_ReturnError(t *testing.T) {
+	subtests := []struct {
+		name        string
+		queryParams map[string]string
+	}{
+		{
+			name:        "invalid_limit",
+			queryParams: map[string]string{"limit": "0"},
+		},
+		{
+			name:        "invalid_cursor",
+			queryParams: map[string]string{"cursor": "not a cursor"},
+		},
+	}
+
+	cfg := new(config.Cfg)
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				Resource:              "/products",
+				Path:                  "/products",
+				HTTPMethod:            http.MethodGet,
+				QueryStringParameters: st.queryParams,
+			}
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mock_aws_services.NewMockDynamoDBClientAPI(ctrl),
+			}
+
+			p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+			resp, err := List(context.TODO(), req, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func Test_ProductLifecycle_Fake(t *testing.T) {
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "test")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	ddb := newFakeDynamoDB(cfg)
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: ddb,
+	}
+
+	body := `
+	{
+		"name": "valid product",
+		"description": "valid product description",
+		"price": 1999,
+		"currency": "USD",
+		"sku": "VP-001",
+		"stock": 10
+	}
+	`
+
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+
+	resp, err := Post(context.TODO(), events.APIGatewayProxyRequest{Body: body}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = Post(context.TODO(), events.APIGatewayProxyRequest{Body: body}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, err = List(context.TODO(), events.APIGatewayProxyRequest{}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	page := new(ItemsPage)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+	assert.Len(t, page.Items, 1) // sku lookups are filtered out
+	id := page.Items[0].Id
+
+	pathParams := map[string]string{"id": id}
+	resp, err = Put(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"1"`},
+		Body: `
+		{
+			"name": "renamed product",
+			"description": "valid product description",
+			"price": 2499,
+			"currency": "USD",
+			"sku": "VP-002",
+			"stock": 5
+		}
+		`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	updated := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), updated))
+	assert.Equal(t, "VP-002", updated.Sku)
+	assert.Equal(t, `"2"`, resp.Headers["ETag"])
+
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{PathParameters: pathParams}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	assert.Equal(t, "renamed product", item.Name)
+	assert.Equal(t, int64(2499), item.Price)
+	assert.Equal(t, "VP-002", item.Sku)
+	assert.Equal(t, int64(2), item.Version)
+	etag := resp.Headers["ETag"]
+	assert.Equal(t, cfg.ProductsCacheControl, resp.Headers["Cache-Control"])
+	assert.NotEmpty(t, resp.Headers["Last-Modified"])
+
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-None-Match": etag},
+	}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+
+	resp, err = Put(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": etag},
+		Body:           `{"name": "renamed product", "description": "valid product description", "price": 2999, "currency": "USD", "sku": "VP-002", "stock": 5}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	updated = new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), updated))
+	assert.Equal(t, id, updated.Id)
+	assert.Equal(t, int64(2999), updated.Price)
+
+	// the old sku was released by the update
+	resp, err = Post(context.TODO(), events.APIGatewayProxyRequest{Body: body}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{PathParameters: pathParams}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	// the etag read before the last update is stale
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": etag},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"3"`},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+
+	resp, err = Delete(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": "*"},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the deleted product is kept, hidden from reads unless they include deleted products
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{PathParameters: pathParams}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters:        pathParams,
+		QueryStringParameters: map[string]string{"includeDeleted": "true"},
+	}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	deletedETag := resp.Headers["ETag"]
+	deleted := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), deleted))
+	assert.Equal(t, StatusDeleted, deleted.Status)
+	assert.NotZero(t, deleted.DeletedAt)
+
+	for includeDeleted, expected := range map[string]int{"false": 1, "true": 2} {
+		resp, err = List(context.TODO(), events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"includeDeleted": includeDeleted},
+		}, p, cfg)
+		assert.NoError(t, err)
+
+		page = new(ItemsPage)
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), page))
+		assert.Len(t, page.Items, expected)
+	}
+
+	resp, err = Restore(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": etag},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = Restore(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": deletedETag},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	restored := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), restored))
+	assert.Equal(t, StatusActive, restored.Status)
+	assert.Zero(t, restored.DeletedAt)
+	assert.Equal(t, deleted.Version+1, restored.Version)
+
+	resp, err = Restore(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": "*"},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// every write was recorded, the history reads back newest first
+	changes := []Change{}
+	query := map[string]string{"limit": "2"}
+	for {
+		resp, err = History(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters:        pathParams,
+			QueryStringParameters: query,
+		}, p)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		history := new(ChangesPage)
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), history))
+		changes = append(changes, history.Items...)
+		if len(history.Next) == 0 {
+			break
+		}
+		query["cursor"] = history.Next
+	}
+
+	actions := []string{}
+	for _, change := range changes {
+		actions = append(actions, change.Action)
+		assert.Equal(t, SystemActor, change.Actor) // called without a request
+	}
+	assert.Equal(t, []string{ActionRestore, ActionDelete, ActionUpdate, ActionUpdate, ActionCreate}, actions)
+	assert.Equal(t, int64(5), changes[0].Version)
+	assert.Equal(t, FieldChange{Before: "VP-001", After: "VP-002"}, changes[3].Diff["sku"])
+	assert.Equal(t, FieldChange{Before: float64(2499), After: float64(2999)}, changes[2].Diff["price"])
+	assert.Len(t, changes[2].Diff, 1)
+	assert.Equal(t, FieldChange{Before: StatusActive, After: StatusDeleted}, changes[1].Diff["status"])
+	assert.Equal(t, FieldChange{After: "valid product"}, changes[4].Diff["name"])
+}
+
+func Test_ReadOneProduct_ReturnError(t *testing.T) {
+	subtests := []struct {
+		name     string
+		id       string
+		query    map[string]string
+		items    []map[string]types.AttributeValue
+		getErr   error
+		expected int
+	}{
+		{
+			name:     "not_found",
+			id:       "100",
+			expected: http.StatusNotFound,
+		},
+		{
+			name: "sku_lookup_id",
+			id:   "sku#VP-001",
+			items: []map[string]types.AttributeValue{
+				{
+					"id":        &types.AttributeValueMemberS{Value: "sku#VP-001"},
+					"sk":        &types.AttributeValueMemberS{Value: "sku"},
+					"productId": &types.AttributeValueMemberS{Value: "100"},
+				},
+			},
+			expected: http.StatusNotFound,
+		},
+		{
+			name:     "invalid_consistent",
+			id:       "100",
+			query:    map[string]string{"consistent": "yes"},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "throttled",
+			id:       "100",
+			getErr:   &types.ProvisionedThroughputExceededException{},
+			expected: http.StatusTooManyRequests,
+		},
+		{
+			name:     "table_not_found",
+			id:       "100",
+			getErr:   &types.ResourceNotFoundException{},
+			expected: http.StatusServiceUnavailable,
+		},
+	}
+
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "test")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+			mockDdbClient.
+				EXPECT().
+				Query(gomock.Any(), gomock.Any()).
+				Return(&dynamodb.QueryOutput{Items: st.items}, st.getErr).
+				MaxTimes(1) // invalid requests are never read
+
+			awsSvc := &aws_services.AWS{
+				DDBClient: mockDdbClient,
+			}
+
+			req := events.APIGatewayProxyRequest{
+				Resource:              "/products/{id}",
+				HTTPMethod:            http.MethodGet,
+				PathParameters:        map[string]string{"id": st.id},
+				QueryStringParameters: st.query,
+			}
+
+			p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+			resp, err := Get(context.TODO(), req, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, st.expected, resp.StatusCode)
+		})
+	}
+}
+
+func Test_UpdateOneProduct_DeletedConcurrently(t *testing.T) {
+	cfg := new(config.Cfg)
+	os.Setenv("PRODUCTS_TABLE", "test")
+	err := envconfig.Process("", cfg)
+	assert.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+	mockDdbClient.
+		EXPECT().
+		Query(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{
+					"id":  &types.AttributeValueMemberS{Value: "100"},
+					"sk":  &types.AttributeValueMemberS{Value: "product"},
+					"sku": &types.AttributeValueMemberS{Value: "VP-001"},
+				},
+			},
+		}, nil)
+	mockDdbClient.
+		EXPECT().
+		TransactWriteItems(gomock.Any(), gomock.Any()).
+		Return(nil, &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+				{Code: aws.String("None")},
+			},
+		})
+	// the failed condition is told apart from a concurrent modification by reading the product again
+	mockDdbClient.
+		EXPECT().
+		Query(gomock.Any(), gomock.Any()).
+		Return(&dynamodb.QueryOutput{}, nil)
+
+	awsSvc := &aws_services.AWS{
+		DDBClient: mockDdbClient,
+	}
+
+	req := events.APIGatewayProxyRequest{
+		Resource:       "/products/{id}",
+		HTTPMethod:     http.MethodPut,
+		Headers:        map[string]string{"If-Match": "*"},
+		PathParameters: map[string]string{"id": "100"},
+		Body:           `{"name": "valid product", "description": "valid product description", "price": 1999, "currency": "USD", "sku": "VP-001"}`,
+	}
+
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), nil)
+	resp, err := Put(context.TODO(), req, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, resp.Body, "no entries found with id: 100")
+}
+
+func Test_CreateOneProduct_ValidationProblem(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		Resource:   "/products",
+		Path:       "/products",
+		HTTPMethod: http.MethodPost,
+		Body:       `{"name": "", "description": "invalid product description", "price": -1, "currency": "XXX", "sku": "IP-001"}`,
+	}
+
+	resp, err := Post(context.TODO(), req, NewService(NewDynamoDBRepository(new(config.Cfg), nil), nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, utils.ProblemContentType, resp.Headers["Content-Type"])
+
+	problem := new(utils.Problem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), problem))
+	assert.Equal(t, utils.ProblemTypeValidation, problem.Type)
+	assert.Equal(t, []utils.FieldError{
+		{Field: "currency", Rule: "currency", Message: ErrUnknownCurrency.Error()},
+		{Field: "name", Rule: "nonzero", Message: "zero value"},
+		{Field: "price", Rule: "min", Message: "less than min"},
+	}, problem.Errors)
+}
+
+func Test_Service_Rules(t *testing.T) {
+	s := NewService(NewMemoryRepository(), nil)
+
+	product := &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	}
+
+	created, err := s.CreateProduct(context.TODO(), product)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.Id)
+
+	// skus are unique regardless of case and surrounding spaces
+	_, err = s.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         " vp-001 ",
+	})
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	_, err = s.CreateProduct(context.TODO(), &Product{Name: "invalid product"})
+	var ve *ValidationError
+	assert.ErrorAs(t, err, &ve)
+	assert.NotEmpty(t, utils.ValidationErrors(ve.Err))
+
+	_, err = s.ListProducts(context.TODO(), 0, "", ReadOptions{})
+	assert.ErrorAs(t, err, &ve)
+
+	page, err := s.ListProducts(context.TODO(), 10, "", ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.Next)
+
+	// changing the sku releases the old one
+	renamed := *product
+	renamed.Sku = "VP-002"
+	updated, err := s.UpdateProduct(context.TODO(), created.Id, 1, &renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, "VP-002", updated.Sku)
+	assert.Equal(t, int64(2), updated.Version)
+
+	_, err = s.CreateProduct(context.TODO(), product)
+	assert.NoError(t, err)
+
+	_, err = s.UpdateProduct(context.TODO(), created.Id, AnyVersion, product)
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	// a merge patch only touches the fields it holds, and the result must still be valid
+	patched, err := s.PatchProduct(context.TODO(), created.Id, 2, map[string]json.RawMessage{"price": json.RawMessage(`2999`)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2999), patched.Price)
+	assert.Equal(t, "valid product description", patched.Description)
+	assert.Equal(t, int64(3), patched.Version)
+
+	// writes based on a stale version are rejected
+	_, err = s.PatchProduct(context.TODO(), created.Id, 2, map[string]json.RawMessage{"price": json.RawMessage(`1`)})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.ErrorIs(t, s.DeleteProduct(context.TODO(), created.Id, 1), ErrVersionMismatch)
+
+	_, err = s.PatchProduct(context.TODO(), created.Id, AnyVersion, map[string]json.RawMessage{"description": json.RawMessage(`null`)})
+	assert.ErrorIs(t, err, ErrRequiredField)
+
+	_, err = s.PatchProduct(context.TODO(), created.Id, AnyVersion, map[string]json.RawMessage{"price": json.RawMessage(`null`)})
+	assert.ErrorIs(t, err, ErrRequiredField)
+
+	_, err = s.PatchProduct(context.TODO(), created.Id, AnyVersion, map[string]json.RawMessage{"id": json.RawMessage(`"other"`)})
+	assert.ErrorAs(t, err, &ve)
+
+	_, err = s.PatchProduct(context.TODO(), created.Id, AnyVersion, map[string]json.RawMessage{"sku": json.RawMessage(`"VP-001"`)})
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, 3))
+
+	_, err = s.GetProduct(context.TODO(), created.Id, ReadOptions{})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = s.UpdateProduct(context.TODO(), created.Id, AnyVersion, &renamed)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, s.DeleteProduct(context.TODO(), created.Id, AnyVersion), ErrNotFound)
+}
+
+func Test_Service_SoftDelete(t *testing.T) {
+	s := NewService(NewMemoryRepository(), nil)
+
+	product := &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+	}
+	created, err := s.CreateProduct(context.TODO(), product)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusActive, created.Status)
+
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, 1))
+
+	batch, err := s.GetProducts(context.TODO(), []string{created.Id}, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, batch.Items)
+	assert.Equal(t, []string{created.Id}, batch.Missing)
+
+	batch, err = s.GetProducts(context.TODO(), []string{created.Id}, ReadOptions{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Len(t, batch.Items, 1)
+
+	// the sku stays taken while the product can be restored
+	_, err = s.CreateProduct(context.TODO(), product)
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	// tombstones within the retention period are kept
+	purged, err := s.PurgeDeletedProducts(context.TODO(), time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	restored, err := s.RestoreProduct(context.TODO(), created.Id, 2)
+	assert.NoError(t, err)
+	assert.False(t, restored.Deleted())
+
+	_, err = s.RestoreProduct(context.TODO(), created.Id, AnyVersion)
+	assert.ErrorIs(t, err, ErrNotDeleted)
+
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, 3))
+
+	purged, err = s.PurgeDeletedProducts(context.TODO(), time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = s.GetProduct(context.TODO(), created.Id, ReadOptions{IncludeDeleted: true})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = s.RestoreProduct(context.TODO(), created.Id, AnyVersion)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// purging releases the sku
+	_, err = s.CreateProduct(context.TODO(), product)
+	assert.NoError(t, err)
+}
+
+func Test_PatchProduct(t *testing.T) {
+	subtests := []struct {
+		name                string
+		contentType         string
+		ifMatch             string
+		body                string
+		expected            int
+		expectedPrice       int64
+		expectedSku         string
+		expectedDescription string
+	}{
+		{
+			name:                "price_only",
+			contentType:         utils.MergePatchContentType,
+			body:                `{"price": 2499}`,
+			expected:            http.StatusOK,
+			expectedPrice:       2499,
+			expectedSku:         "VP-001",
+			expectedDescription: "valid product description",
+		},
+		{
+			name:                "sku_change",
+			contentType:         utils.MergePatchContentType + "; charset=utf-8",
+			body:                `{"sku": "VP-002", "stock": 3}`,
+			expected:            http.StatusOK,
+			expectedPrice:       1999,
+			expectedSku:         "VP-002",
+			expectedDescription: "valid product description",
+		},
+		{
+			name:        "null_required_field",
+			contentType: utils.MergePatchContentType,
+			body:        `{"description": null}`,
+			expected:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "null_price",
+			contentType: utils.MergePatchContentType,
+			body:        `{"price": null}`,
+			expected:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "null_stock",
+			contentType: utils.MergePatchContentType,
+			body:        `{"name": "renamed product", "stock": null}`,
+			expected:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "invalid_value",
+			contentType: utils.MergePatchContentType,
+			body:        `{"price": -1}`,
+			expected:    http.StatusBadRequest,
+		},
+		{
+			name:        "unknown_field",
+			contentType: utils.MergePatchContentType,
+			body:        `{"reserved": 0}`,
+			expected:    http.StatusBadRequest,
+		},
+		{
+			name:        "stale_etag",
+			contentType: utils.MergePatchContentType,
+			ifMatch:     `"2"`,
+			body:        `{"price": 2499}`,
+			expected:    http.StatusPreconditionFailed,
+		},
+		{
+			name:        "weak_etag",
+			contentType: utils.MergePatchContentType,
+			ifMatch:     `W/"1"`,
+			body:        `{"price": 2499}`,
+			expected:    http.StatusPreconditionFailed,
+		},
+		{
+			name:        "missing_if_match",
+			contentType: utils.MergePatchContentType,
+			ifMatch:     "-",
+			body:        `{"price": 2499}`,
+			expected:    http.StatusPreconditionRequired,
+		},
+		{
+			name:        "not_a_merge_patch",
+			contentType: "application/json",
+			body:        `{"price": 2499}`,
+			expected:    http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			cfg := &config.Cfg{ProductsTable: "test"}
+
+			ddb := newFakeDynamoDB(cfg)
+
+			p := NewService(NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb}), nil)
+
+			created, err := p.CreateProduct(context.TODO(), &Product{
+				Name:        "valid product",
+				Description: "valid product description",
+				Price:       1999,
+				Currency:    "USD",
+				Sku:         "VP-001",
+				Stock:       10,
+			})
+			assert.NoError(t, err)
+
+			headers := map[string]string{"Content-Type": st.contentType, "If-Match": `"1"`}
+			switch st.ifMatch {
+			case "":
+			case "-":
+				delete(headers, "If-Match")
+			default:
+				headers["If-Match"] = st.ifMatch
+			}
+
+			resp, err := Patch(context.TODO(), events.APIGatewayProxyRequest{
+				Resource:       "/products/{id}",
+				HTTPMethod:     http.MethodPatch,
+				Headers:        headers,
+				PathParameters: map[string]string{"id": created.Id},
+				Body:           st.body,
+			}, p)
+			assert.NoError(t, err)
+			assert.Equal(t, st.expected, resp.StatusCode)
+
+			stored, err := p.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+			assert.NoError(t, err)
+
+			if st.expected != http.StatusOK {
+				assert.Equal(t, created, stored)
+				return
+			}
+
+			patched := new(Item)
+			assert.NoError(t, json.Unmarshal([]byte(resp.Body), patched))
+			assert.Equal(t, stored, patched)
+			assert.Equal(t, `"2"`, resp.Headers["ETag"])
+			assert.Equal(t, st.expectedPrice, stored.Price)
+			assert.Equal(t, st.expectedSku, stored.Sku)
+			assert.Equal(t, st.expectedDescription, stored.Description)
+		})
+	}
+}
+
+func Test_DynamoDBRepository_UpdateRemove(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test"}
+
+	ddb := newFakeDynamoDB(cfg)
+
+	repo := NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})
+
+	item := &Item{Id: "100", Name: "valid product", Description: "valid product description", Sku: "VP-001"}
+	assert.NoError(t, repo.Create(context.TODO(), item, &Change{ProductId: item.Id, Version: 0}))
+
+	updated, err := repo.Update(context.TODO(), &ItemUpdate{
+		Current: item,
+		Set:     map[string]interface{}{"name": "renamed product", "version": 1},
+		Remove:  []string{"description"},
+	}, &Change{ProductId: item.Id, Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed product", updated.Name)
+	assert.Empty(t, updated.Description)
+
+	out, err := ddb.Scan(context.TODO(), &dynamodb.ScanInput{TableName: aws.String(cfg.ProductsTable)})
+	assert.NoError(t, err)
+	for _, it := range out.Items {
+		assert.NotContains(t, it, "description")
+	}
+}
+
+func Test_ListProducts_ByIds(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test", ProductsCacheControl: "no-cache"}
+
+	ddb := newFakeDynamoDB(cfg)
+	// a single key per call, so the unprocessed keys are retried until all are read
+	ddb.SetBatchGetLimit(1)
+	batchGetBackoff = 0
+
+	repo := NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})
+	for _, item := range []*Item{
+		{Id: "100", Name: "first product", Sku: "VP-001"},
+		{Id: "200", Name: "second product", Sku: "VP-002"},
+	} {
+		assert.NoError(t, repo.Create(context.TODO(), item, &Change{ProductId: item.Id, Version: item.Version}))
+	}
+
+	p := NewService(repo, nil)
+
+	subtests := []struct {
+		name     string
+		ids      string
+		expected int
+		items    []string
+		missing  []string
+	}{
+		{
+			name:     "in_request_order",
+			ids:      "200, 300,100,200,sku#VP-001",
+			expected: http.StatusOK,
+			items:    []string{"200", "100"},
+			missing:  []string{"300", "sku#VP-001"},
+		},
+		{
+			name:     "empty_id",
+			ids:      "100,,200",
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "too_many_ids",
+			ids:      strings.Repeat("100,", int(utils.MaxPageLimit)) + "200",
+			expected: http.StatusBadRequest,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			resp, err := List(context.TODO(), events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"ids": st.ids},
+			}, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, st.expected, resp.StatusCode)
+			if st.expected != http.StatusOK {
+				return
+			}
+
+			batch := new(ItemsBatch)
+			assert.NoError(t, json.Unmarshal([]byte(resp.Body), batch))
+			ids := []string{}
+			for _, item := range batch.Items {
+				ids = append(ids, item.Id)
+			}
+			assert.Equal(t, st.items, ids)
+			assert.Equal(t, st.missing, batch.Missing)
+		})
+	}
+}
+
+func Test_BatchGet_UnprocessedKeysExhausted(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test"}
+	batchGetBackoff = 0
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+	mockDdbClient.
+		EXPECT().
+		BatchGetItem(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			return &dynamodb.BatchGetItemOutput{UnprocessedKeys: in.RequestItems}, nil
+		}).
+		Times(batchGetAttempts)
+
+	repo := NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: mockDdbClient})
+	_, err := repo.BatchGet(context.TODO(), []string{"100"}, ReadOptions{})
+	assert.ErrorContains(t, err, "1 keys still unprocessed")
+}
+
+func Test_ReadOneProduct_Consistent(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test"}
+
+	for _, consistent := range []bool{false, true} {
+		ctrl := gomock.NewController(t)
+
+		// a single Query reads the product along with its variants
+		mockDdbClient := mock_aws_services.NewMockDynamoDBClientAPI(ctrl)
+		mockDdbClient.
+			EXPECT().
+			Query(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+				assert.Equal(t, consistent, aws.ToBool(in.ConsistentRead))
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{
+							"id": &types.AttributeValueMemberS{Value: "100"},
+							"sk": &types.AttributeValueMemberS{Value: "product"},
+						},
+						{
+							"id":        &types.AttributeValueMemberS{Value: "100"},
+							"sk":        &types.AttributeValueMemberS{Value: "variant#v1"},
+							"variantId": &types.AttributeValueMemberS{Value: "v1"},
+							"sku":       &types.AttributeValueMemberS{Value: "VP-001-M"},
+						},
+					},
+				}, nil
+			})
+
+		req := events.APIGatewayProxyRequest{
+			PathParameters:        map[string]string{"id": "100"},
+			QueryStringParameters: map[string]string{"consistent": strconv.FormatBool(consistent)},
+		}
+
+		p := NewService(NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: mockDdbClient}), nil)
+		resp, err := Get(context.TODO(), req, p, cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Body, `"Sku":"VP-001-M"`)
+
+		ctrl.Finish()
+	}
+}
+
+func Test_Variants_Fake(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test"}
+	ddb := newFakeDynamoDB(cfg)
+	p := NewService(NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb}), nil)
+
+	created, err := p.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+	pathParams := map[string]string{"id": created.Id}
+
+	resp, err := PostVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Body:           `{"sku": "VP-001-M", "stock": 3, "options": {"size": "M"}}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, err = PostVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"1"`},
+		Body:           `{"sku": "VP-001-M", "stock": 3, "options": {"size": "M"}}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Headers["ETag"])
+
+	medium := new(VariantItem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), medium))
+	assert.Equal(t, "/products/"+created.Id+"/variants/"+medium.Id, resp.Headers["Location"])
+	assert.Nil(t, medium.Price)
+
+	// skus are shared by products and variants, and a product has one variant per set of options
+	for body, expected := range map[string]int{
+		`{"sku": "VP-001", "stock": 1, "options": {"size": "L"}}`:    http.StatusConflict,
+		`{"sku": "VP-001-M2", "stock": 1, "options": {"size": "M"}}`: http.StatusConflict,
+		`{"sku": "VP-001-L", "stock": 1, "options": {}}`:             http.StatusBadRequest,
+		`{"sku": "VP-001-L", "stock": -1, "options": {"size": "L"}}`: http.StatusBadRequest,
+	} {
+		resp, err = PostVariant(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: pathParams,
+			Headers:        map[string]string{"If-Match": "*"},
+			Body:           body,
+		}, p)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp.StatusCode, body)
+	}
+
+	_, err = p.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         "VP-001-M",
+	})
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	resp, err = PostVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"2"`},
+		Body:           `{"sku": "VP-001-L", "price": 2499, "stock": 1, "options": {"size": "L"}}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	large := new(VariantItem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), large))
+
+	// the product is read with all its variants
+	resp, err = Get(context.TODO(), events.APIGatewayProxyRequest{PathParameters: pathParams}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"3"`, resp.Headers["ETag"])
+
+	item := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), item))
+	assert.Equal(t, "VP-001", item.Sku)
+	assert.Len(t, item.Variants, 2)
+
+	resp, err = ListVariants(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-None-Match": `"3"`},
+	}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// products are still listed once, without their variants
+	page, err := p.ListProducts(context.TODO(), 10, "", ReadOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+
+	variantParams := map[string]string{"id": created.Id, "variantId": medium.Id}
+	resp, err = PutVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: variantParams,
+		Headers:        map[string]string{"If-Match": `"2"`},
+		Body:           `{"sku": "VP-001-M", "stock": 5, "options": {"size": "M"}}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = PutVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: variantParams,
+		Headers:        map[string]string{"If-Match": `"3"`},
+		Body:           `{"sku": "VP-001-MED", "stock": 5, "options": {"size": "M"}}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"4"`, resp.Headers["ETag"])
+
+	resp, err = GetVariant(context.TODO(), events.APIGatewayProxyRequest{PathParameters: variantParams}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	medium = new(VariantItem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), medium))
+	assert.Equal(t, "VP-001-MED", medium.Sku)
+	assert.Equal(t, int64(5), medium.Stock)
+
+	// the old sku of the variant was released by the update
+	_, err = p.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         "VP-001-M",
+	})
+	assert.NoError(t, err)
+
+	resp, err = DeleteVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": created.Id, "variantId": large.Id},
+		Headers:        map[string]string{"If-Match": `"4"`},
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, `"5"`, resp.Headers["ETag"])
+
+	resp, err = GetVariant(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": created.Id, "variantId": large.Id},
+	}, p, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	history, err := p.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	actions := []string{}
+	for _, change := range history.Items {
+		actions = append(actions, change.Action)
+	}
+	assert.Equal(t, []string{ActionDeleteVariant, ActionUpdateVariant, ActionCreateVariant, ActionCreateVariant, ActionCreate}, actions)
+	assert.Equal(t, FieldChange{Before: "VP-001-M", After: "VP-001-MED"}, history.Items[1].Diff["variants."+medium.Id+".sku"])
+	assert.Equal(t, FieldChange{Before: "VP-001-L"}, history.Items[0].Diff["variants."+large.Id+".sku"])
+
+	// purging the product deletes its variants and releases their skus
+	assert.NoError(t, p.DeleteProduct(context.TODO(), created.Id, 5))
+	purged, err := p.PurgeDeletedProducts(context.TODO(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = p.GetProduct(context.TODO(), created.Id, ReadOptions{IncludeDeleted: true})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// nothing is left of the product, its variants or their skus, only the other product and its sku
+	remaining, err := ddb.Scan(context.TODO(), &dynamodb.ScanInput{TableName: aws.String(cfg.ProductsTable)})
+	assert.NoError(t, err)
+	assert.Len(t, remaining.Items, 2)
+	for _, avMap := range remaining.Items {
+		assert.NotEqual(t, &types.AttributeValueMemberS{Value: created.Id}, avMap["id"])
+		assert.NotEqual(t, &types.AttributeValueMemberS{Value: created.Id}, avMap["productId"])
+	}
+
+	_, err = p.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         "VP-001-MED",
+	})
+	assert.NoError(t, err)
+}
+
+func Test_Service_Variants(t *testing.T) {
+	s := NewService(NewMemoryRepository(), nil)
+
+	created, err := s.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+
+	variant, product, err := s.CreateVariant(context.TODO(), created.Id, 1, &Variant{Sku: "VP-001-M", Stock: 3, Options: map[string]string{"size": "M"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), product.Version)
+	assert.Equal(t, []VariantItem{*variant}, product.Variants)
+
+	_, _, err = s.CreateVariant(context.TODO(), created.Id, 1, &Variant{Sku: "VP-001-L", Options: map[string]string{"size": "L"}})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	_, _, err = s.CreateVariant(context.TODO(), created.Id, AnyVersion, &Variant{Sku: " vp-001-m ", Options: map[string]string{"size": "L"}})
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	_, _, err = s.UpdateVariant(context.TODO(), created.Id, "other", AnyVersion, &Variant{Sku: "VP-001-L", Options: map[string]string{"size": "L"}})
+	assert.ErrorIs(t, err, ErrVariantNotFound)
+
+	_, err = s.DeleteVariant(context.TODO(), "other", variant.Id, AnyVersion)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	product, err = s.DeleteVariant(context.TODO(), created.Id, variant.Id, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), product.Version)
+	assert.Empty(t, product.Variants)
+
+	// deleting the variant released its sku
+	_, _, err = s.CreateVariant(context.TODO(), created.Id, 3, &Variant{Sku: "VP-001-M", Options: map[string]string{"size": "M"}})
+	assert.NoError(t, err)
+}
+
+func Test_Images_Fake(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test", ImagesBucket: "images"}
+	fakeS3 := fake_aws_services.NewS3()
+	fakeS3.CreateBucket(cfg.ImagesBucket)
+	awsSvc := &aws_services.AWS{DDBClient: newFakeDynamoDB(cfg), S3Client: fakeS3, S3Presigner: fakeS3}
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), NewS3ImageStore(cfg, awsSvc))
+
+	created, err := p.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+	pathParams := map[string]string{"id": created.Id}
+
+	for body, expected := range map[string]int{
+		`{"contentType": "image/png", "size": 1024}`:                                         http.StatusPreconditionRequired,
+		`{"contentType": "image/gif", "size": 1024}`:                                         http.StatusBadRequest,
+		`{"contentType": "image/png", "size": 0}`:                                            http.StatusBadRequest,
+		`{"contentType": "image/png", "size": 10485761}`:                                     http.StatusBadRequest,
+		`{"contentType": "image/png", "size": 1, "alt": "` + strings.Repeat("a", 251) + `"}`: http.StatusBadRequest,
+	} {
+		headers := map[string]string{"If-Match": "*"}
+		if expected == http.StatusPreconditionRequired {
+			headers = nil
+		}
+		resp, err := PostImage(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: pathParams,
+			Headers:        headers,
+			Body:           body,
+		}, p)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp.StatusCode, body)
+	}
+
+	resp, err := PostImage(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"1"`},
+		Body:           `{"contentType": "image/png", "size": 1024, "alt": "front"}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Headers["ETag"])
+
+	front := new(ImageUpload)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), front))
+	assert.True(t, strings.HasPrefix(front.Image.Key, ImagesPrefix+created.Id+"/"))
+	assert.True(t, strings.HasSuffix(front.Image.Key, ".png"))
+	assert.Equal(t, "https://images.s3.amazonaws.com/"+front.Image.Key+"?X-Amz-Expires=900", front.Url)
+	assert.Equal(t, http.MethodPut, front.Method)
+	// the upload is held to the type and size of the image
+	assert.Equal(t, map[string]string{"Content-Type": "image/png", "Content-Length": "1024"}, front.Headers)
+	assert.NotZero(t, front.ExpiresAt)
+
+	resp, err = PostImage(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"1"`},
+		Body:           `{"contentType": "image/jpeg", "size": 2048, "alt": "back"}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = PostImage(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"2"`},
+		Body:           `{"contentType": "image/jpeg", "size": 2048, "alt": "back"}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	back := new(ImageUpload)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), back))
+	assert.True(t, strings.HasSuffix(back.Image.Key, ".jpg"))
+
+	item, err := p.GetProduct(context.TODO(), created.Id, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImageItem{front.Image, back.Image}, item.Images)
+
+	// images are reordered, their alt text set, and those left out removed
+	for body, expected := range map[string]int{
+		`[{"key": "products/other.png"}]`: http.StatusBadRequest,
+		`[{"key": ""}]`:                   http.StatusBadRequest,
+		`[{"key": "` + back.Image.Key + `"}, {"key": "` + back.Image.Key + `"}]`: http.StatusBadRequest,
+		`{"key": "` + back.Image.Key + `"}`:                                      http.StatusBadRequest,
+	} {
+		resp, err = PutImages(context.TODO(), events.APIGatewayProxyRequest{
+			PathParameters: pathParams,
+			Headers:        map[string]string{"If-Match": "*"},
+			Body:           body,
+		}, p)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp.StatusCode, body)
+	}
+
+	resp, err = PutImages(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: pathParams,
+		Headers:        map[string]string{"If-Match": `"3"`},
+		Body:           `[{"key": "` + back.Image.Key + `", "alt": "back view"}, {"key": "` + front.Image.Key + `", "alt": "front view"}]`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"4"`, resp.Headers["ETag"])
+
+	updated := new(Item)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), updated))
+	assert.Len(t, updated.Images, 2)
+	assert.Equal(t, back.Image.Key, updated.Images[0].Key)
+	assert.Equal(t, "back view", updated.Images[0].Alt)
+	assert.Equal(t, "front view", updated.Images[1].Alt)
+
+	// updating the product keeps its images
+	updated, err = p.UpdateProduct(context.TODO(), created.Id, 4, &Product{
+		Name:        "renamed product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       10,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, updated.Images, 2)
+
+	updated, err = p.UpdateImages(context.TODO(), created.Id, AnyVersion, []ImageText{})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Images)
+
+	item, err = p.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Empty(t, item.Images)
+
+	history, err := p.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, ActionUpdateImages, history.Items[0].Action)
+	assert.Equal(t, ActionAddImage, history.Items[4].Action)
+	assert.Contains(t, history.Items[4].Diff, "images")
+}
+
+func Test_AddImage_PresignError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := &config.Cfg{ProductsTable: "test", ImagesBucket: "images"}
+	mockPresigner := mock_aws_services.NewMockS3PresignAPI(ctrl)
+	mockPresigner.
+		EXPECT().
+		PresignPutObject(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("no credentials"))
+
+	awsSvc := &aws_services.AWS{DDBClient: newFakeDynamoDB(cfg), S3Presigner: mockPresigner}
+	p := NewService(NewDynamoDBRepository(cfg, awsSvc), NewS3ImageStore(cfg, awsSvc))
+
+	created, err := p.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	resp, err := PostImage(context.TODO(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": created.Id},
+		Headers:        map[string]string{"If-Match": "*"},
+		Body:           `{"contentType": "image/png", "size": 1024}`,
+	}, p)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// no image is listed without an upload
+	item, err := p.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Empty(t, item.Images)
+	assert.Equal(t, int64(1), item.Version)
+}
+
+func Test_ReadProducts_CacheControl(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "test", ProductsCacheControl: "public, max-age=60"}
+	p := NewService(NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: newFakeDynamoDB(cfg)}), nil)
+
+	created, err := p.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	subtests := []struct {
+		name     string
+		query    map[string]string
+		expected string
+	}{
+		{name: "shared", query: map[string]string{}, expected: cfg.ProductsCacheControl},
+		{name: "consistent", query: map[string]string{"consistent": "true"}, expected: "private, no-store"},
+		{name: "include_deleted", query: map[string]string{"includeDeleted": "true"}, expected: "private, no-store"},
+		{name: "not_consistent", query: map[string]string{"consistent": "false"}, expected: cfg.ProductsCacheControl},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			resp, err := Get(context.TODO(), events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"id": created.Id},
+				QueryStringParameters: st.query,
+			}, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, st.expected, resp.Headers["Cache-Control"])
+
+			resp, err = List(context.TODO(), events.APIGatewayProxyRequest{QueryStringParameters: st.query}, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, st.expected, resp.Headers["Cache-Control"])
+
+			byIds := map[string]string{"ids": created.Id}
+			for name, value := range st.query {
+				byIds[name] = value
+			}
+			resp, err = List(context.TODO(), events.APIGatewayProxyRequest{QueryStringParameters: byIds}, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, st.expected, resp.Headers["Cache-Control"])
+
+			resp, err = ListVariants(context.TODO(), events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"id": created.Id},
+				QueryStringParameters: st.query,
+			}, p, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, st.expected, resp.Headers["Cache-Control"])
+		})
+	}
+}
+
+func Test_Service_ChangeStock(t *testing.T) {
+	s := NewService(NewMemoryRepository(), nil)
+
+	created, err := s.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       5,
+	})
+	assert.NoError(t, err)
+
+	// changes to the same product are merged into one write
+	stored, err := s.ChangeStock(context.TODO(), ActionReserve, []StockChange{
+		{ProductId: created.Id, Stock: -1, Reserved: 1},
+		{ProductId: created.Id, Stock: -1, Reserved: 1},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+	assert.Equal(t, []int64{3, 2, 2}, []int64{stored[0].Stock, stored[0].Reserved, stored[0].Version})
+
+	price := int64(1999)
+	otherPrice := int64(999)
+	subtests := []struct {
+		name     string
+		change   StockChange
+		expected error
+	}{
+		{name: "insufficient_stock", change: StockChange{ProductId: created.Id, Stock: -4}, expected: ErrInsufficientStock},
+		{name: "insufficient_reserved", change: StockChange{ProductId: created.Id, Reserved: -3}, expected: ErrInsufficientReserved},
+		{name: "price_changed", change: StockChange{ProductId: created.Id, Stock: -1, Price: &otherPrice}, expected: ErrPriceChanged},
+		{name: "product_not_found", change: StockChange{ProductId: "404", Stock: -1}, expected: ErrNotFound},
+	}
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			_, err := s.ChangeStock(context.TODO(), ActionCheckout, []StockChange{st.change}, nil)
+			assert.ErrorIs(t, err, st.expected)
+		})
+	}
+
+	// refused changes leave the product as it was
+	item, err := s.GetProduct(context.TODO(), created.Id, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2, 2}, []int64{item.Stock, item.Reserved, item.Version})
+
+	_, err = s.ChangeStock(context.TODO(), ActionCheckout, []StockChange{{ProductId: created.Id, Stock: -3, Price: &price}}, nil)
+	assert.NoError(t, err)
+
+	history, err := s.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	assert.Len(t, history.Items, 3)
+	assert.Equal(t, ActionCheckout, history.Items[0].Action)
+	assert.Equal(t, FieldChange{Before: float64(3), After: float64(0)}, history.Items[0].Diff["stock"])
+	assert.Equal(t, ActionReserve, history.Items[1].Action)
+
+	// deleted products only take units back
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, AnyVersion))
+	_, err = s.ChangeStock(context.TODO(), ActionRelease, []StockChange{{ProductId: created.Id, Stock: 2, Reserved: -2}}, nil)
+	assert.NoError(t, err)
+	_, err = s.ChangeStock(context.TODO(), ActionReserve, []StockChange{{ProductId: created.Id, Stock: -1, Reserved: 1}}, nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the memory repository takes part in no transactions
+	_, err = s.ChangeStock(context.TODO(), ActionCheckout, []StockChange{{ProductId: created.Id, Stock: 1}}, []types.TransactWriteItem{{}})
+	assert.Error(t, err)
+}
+
+// racingRepository writes the product once more between the read and the write of the first stock change
+type racingRepository struct {
+	ProductRepository
+	race func()
+}
+
+func (r *racingRepository) ChangeStock(ctx context.Context, updates []StockUpdate, joined []types.TransactWriteItem) error {
+	if r.race != nil {
+		r.race()
+		r.race = nil
+	}
+	return r.ProductRepository.ChangeStock(ctx, updates, joined)
+}
+
+func Test_ChangeStock_Fake(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products"}
+	ddb := newFakeDynamoDB(cfg)
+	ddb.CreateTable("orders", "id", "")
+	repo := &racingRepository{ProductRepository: NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})}
+	s := NewService(repo, nil)
+
+	created, err := s.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Price:       1999,
+		Currency:    "USD",
+		Sku:         "VP-001",
+		Stock:       5,
+	})
+	assert.NoError(t, err)
+
+	putOrder := func(id string) types.TransactWriteItem {
+		return types.TransactWriteItem{Put: &types.Put{
+			TableName:                aws.String("orders"),
+			Item:                     map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+			ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+			ExpressionAttributeNames: map[string]string{"#id": "id"},
+		}}
+	}
+
+	// a product written meanwhile has the change read and checked again
+	repo.race = func() {
+		_, err := s.PatchProduct(context.TODO(), created.Id, AnyVersion, map[string]json.RawMessage{"name": json.RawMessage(`"renamed product"`)})
+		assert.NoError(t, err)
+	}
+	stored, err := s.ChangeStock(context.TODO(), ActionCheckout, []StockChange{{ProductId: created.Id, Stock: -2}}, []types.TransactWriteItem{putOrder("order-1")})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 3}, []int64{stored[0].Stock, stored[0].Version})
+
+	item, err := s.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed product", item.Name)
+	assert.Equal(t, int64(3), item.Stock)
+
+	// the joined writes failing cancel the change, and are reported by index
+	_, err = s.ChangeStock(context.TODO(), ActionCheckout, []StockChange{{ProductId: created.Id, Stock: -1}}, []types.TransactWriteItem{putOrder("order-2"), putOrder("order-1")})
+	var jwe *JoinedWriteError
+	assert.True(t, errors.As(err, &jwe), err)
+	assert.Equal(t, []int{1}, jwe.Failed)
+
+	item, err = s.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 3}, []int64{item.Stock, item.Version})
+
+	history, err := s.ProductHistory(context.TODO(), created.Id, 10, "")
+	assert.NoError(t, err)
+	assert.Len(t, history.Items, 3)
+	assert.Equal(t, ActionCheckout, history.Items[0].Action)
+}
+
+// restoringRepository restores the product between the read of the purge and its delete
+type restoringRepository struct {
+	ProductRepository
+	restore func(id string)
+}
+
+func (r *restoringRepository) Delete(ctx context.Context, current *Item, change *Change) error {
+	if r.restore != nil {
+		r.restore(current.Id)
+		r.restore = nil
+	}
+	return r.ProductRepository.Delete(ctx, current, change)
+}
+
+func Test_PurgeDeletedProducts_RestoredMeanwhile(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products"}
+	ddb := newFakeDynamoDB(cfg)
+	repo := &restoringRepository{ProductRepository: NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})}
+	s := NewService(repo, nil)
+
+	created, err := s.CreateProduct(context.TODO(), &Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	// more variants than a single transaction can delete along with the product
+	const variants = 60
+	for i := 0; i < variants; i++ {
+		_, _, err := s.CreateVariant(context.TODO(), created.Id, AnyVersion, &Variant{
+			Sku:     "VP-001-" + strconv.Itoa(i),
+			Options: map[string]string{"size": strconv.Itoa(i)},
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, AnyVersion))
+
+	repo.restore = func(id string) {
+		_, err := s.RestoreProduct(context.TODO(), id, AnyVersion)
+		assert.NoError(t, err)
+	}
+	purged, err := s.PurgeDeletedProducts(context.TODO(), time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	// the restored product keeps every variant, and their SKUs stay taken
+	item, err := s.GetProduct(context.TODO(), created.Id, ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Len(t, item.Variants, variants)
+	_, err = s.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         "VP-001-0",
+	})
+	assert.ErrorIs(t, err, ErrSkuInUse)
+
+	// purged for good once nobody restores it
+	assert.NoError(t, s.DeleteProduct(context.TODO(), created.Id, AnyVersion))
+	purged, err = s.PurgeDeletedProducts(context.TODO(), time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	out, err := ddb.Scan(context.TODO(), &dynamodb.ScanInput{TableName: aws.String(cfg.ProductsTable)})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Items)
+	_, err = s.CreateProduct(context.TODO(), &Product{
+		Name:        "other product",
+		Description: "other product description",
+		Currency:    "USD",
+		Sku:         "VP-001-0",
+	})
+	assert.NoError(t, err)
+}
+
+func Test_Backfill_Fake(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products"}
+	ddb := newFakeDynamoDB(cfg)
+	ddb.CreateTable("legacy-products", "id", "")
+	repo := NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})
+	s := NewService(repo, nil)
+
+	putLegacy := func(item *Item) {
+		avMap, err := attributevalue.MarshalMap(item)
+		assert.NoError(t, err)
+		_, err = ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: aws.String("legacy-products"), Item: avMap})
+		assert.NoError(t, err)
+	}
+	shirt := &Item{Id: "100", Version: 2, Name: "shirt", Currency: "USD", Sku: "SH-001", Stock: 5}
+	putLegacy(shirt)
+	putLegacy(&Item{Id: "200", Version: 1, Name: "socks", Currency: "USD"})
+	putLegacy(&Item{Id: "300", Version: 4, Name: "hat", Currency: "USD", Sku: "HA-001", DeletedAt: 1})
+	// the legacy lookup items are not products, the lookups are rebuilt from the products
+	_, err := ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String("legacy-products"),
+		Item: map[string]types.AttributeValue{
+			"id":        &types.AttributeValueMemberS{Value: "sku#SH-001"},
+			"productId": &types.AttributeValueMemberS{Value: "100"},
+		},
+	})
+	assert.NoError(t, err)
+
+	copied, err := repo.Backfill(context.TODO(), "legacy-products")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, copied)
+
+	item, err := s.GetProduct(context.TODO(), "100", ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, shirt, item)
+	item, err = s.GetProduct(context.TODO(), "300", ReadOptions{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), item.Version)
+	assert.True(t, item.Deleted())
+
+	newProduct := func(sku string) error {
+		_, err := s.CreateProduct(context.TODO(), &Product{Name: "other", Description: "other", Currency: "USD", Sku: sku})
+		return err
+	}
+	assert.ErrorIs(t, newProduct("SH-001"), ErrSkuInUse)
+	assert.ErrorIs(t, newProduct("HA-001"), ErrSkuInUse)
+
+	// rerunning copies nothing new
+	copied, err = repo.Backfill(context.TODO(), "legacy-products")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, copied)
+
+	// a legacy write is caught up with, moving the sku lookup along
+	shirt.Version, shirt.Sku = 3, "SH-002"
+	putLegacy(shirt)
+	copied, err = repo.Backfill(context.TODO(), "legacy-products")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, copied)
+
+	item, err = s.GetProduct(context.TODO(), "100", ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, shirt, item)
+	assert.NoError(t, newProduct("SH-001"))
+	assert.ErrorIs(t, newProduct("SH-002"), ErrSkuInUse)
+
+	// a product written since the switch is kept over a later legacy write
+	socks, err := s.UpdateProduct(context.TODO(), "200", 1, &Product{Name: "wool socks", Description: "warm", Currency: "USD", Sku: "SO-001"})
+	assert.NoError(t, err)
+	putLegacy(&Item{Id: "200", Version: 5, Name: "legacy socks", Currency: "USD"})
+	copied, err = repo.Backfill(context.TODO(), "legacy-products")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, copied)
+
+	item, err = s.GetProduct(context.TODO(), "200", ReadOptions{Consistent: true})
+	assert.NoError(t, err)
+	assert.Equal(t, socks, item)
+}
+
+func Test_Backfill_SkuInUse(t *testing.T) {
+	cfg := &config.Cfg{ProductsTable: "products"}
+	ddb := newFakeDynamoDB(cfg)
+	ddb.CreateTable("legacy-products", "id", "")
+	repo := NewDynamoDBRepository(cfg, &aws_services.AWS{DDBClient: ddb})
+
+	_, err := NewService(repo, nil).CreateProduct(context.TODO(), &Product{Name: "new", Description: "new", Currency: "USD", Sku: "SH-001"})
+	assert.NoError(t, err)
+	for _, item := range []*Item{{Id: "100", Version: 1, Sku: "SH-001"}, {Id: "200", Version: 1, Sku: "SO-001"}} {
+		avMap, err := attributevalue.MarshalMap(item)
+		assert.NoError(t, err)
+		_, err = ddb.PutItem(context.TODO(), &dynamodb.PutItemInput{TableName: aws.String("legacy-products"), Item: avMap})
+		assert.NoError(t, err)
+	}
+
+	// the conflicting product is reported without holding back the others
+	copied, err := repo.Backfill(context.TODO(), "legacy-products")
+	assert.Equal(t, 1, copied)
+	assert.ErrorIs(t, err, ErrSkuInUse)
+	var failed BackfillErrors
+	assert.ErrorAs(t, err, &failed)
+	assert.Len(t, failed, 1)
+}
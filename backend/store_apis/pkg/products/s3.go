@@ -0,0 +1,61 @@
+package products
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ImageUploadExpiry is how long a presigned image upload stays valid
+const ImageUploadExpiry = 15 * time.Minute
+
+// S3ImageStore is the ImageStore of the images bucket
+type S3ImageStore struct {
+	cfg    *config.Cfg
+	awsSvc *aws_services.AWS
+}
+
+func NewS3ImageStore(cfg *config.Cfg, awsSvc *aws_services.AWS) *S3ImageStore {
+	return &S3ImageStore{cfg: cfg, awsSvc: awsSvc}
+}
+
+var _ ImageStore = (*S3ImageStore)(nil)
+
+// PresignUpload signs a PutObject with the content type and length as headers, which S3 then requires the
+// upload to match
+func (st *S3ImageStore) PresignUpload(ctx context.Context, key, contentType string, size int64) (*ImageUpload, error) {
+	expiresAt := time.Now().UTC().Add(ImageUploadExpiry)
+
+	req, err := st.awsSvc.S3Presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(st.cfg.ImagesBucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: size,
+	}, s3.WithPresignExpires(ImageUploadExpiry))
+	if err != nil {
+		return nil, fmt.Errorf("error presigning upload of %v: %w", key, err)
+	}
+
+	headers := map[string]string{}
+	for name := range req.SignedHeader {
+		// set by the client from the url
+		if http.CanonicalHeaderKey(name) == "Host" {
+			continue
+		}
+		headers[http.CanonicalHeaderKey(name)] = req.SignedHeader.Get(name)
+	}
+
+	return &ImageUpload{
+		Url:       req.URL,
+		Method:    req.Method,
+		Headers:   headers,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
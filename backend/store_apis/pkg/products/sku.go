@@ -0,0 +1,72 @@
+package products
+
+import (
+	"fmt"
+	"strings"
+
+	"store_apis/pkg/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SKU uniqueness is enforced by a lookup item stored next to the products, keyed by the SKU.
+// It is written in the same transaction as the product, or variant, conditioned on not existing yet.
+// Products and variants share the SKUs
+const skuKeyPrefix = "sku#"
+
+func skuKey(sku string) string {
+	return skuKeyPrefix + strings.ToUpper(strings.TrimSpace(sku))
+}
+
+func putSkuLookup(cfg *config.Cfg, sku, productId string) (types.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			AttributeNotExists(expression.Name("id")),
+	).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String(cfg.ProductsTable),
+			Item: map[string]types.AttributeValue{
+				"id":        &types.AttributeValueMemberS{Value: skuKey(sku)},
+				"sk":        &types.AttributeValueMemberS{Value: skuLookupSk},
+				"productId": &types.AttributeValueMemberS{Value: productId},
+			},
+			ExpressionAttributeNames: expr.Names(),
+			ConditionExpression:      expr.Condition(),
+		},
+	}, nil
+}
+
+func deleteSkuLookup(cfg *config.Cfg, sku, productId string) (types.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().WithCondition(
+		expression.
+			Name("productId").Equal(expression.Value(productId)),
+	).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("error building condition expression: %v", err)
+	}
+
+	return types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName: aws.String(cfg.ProductsTable),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: skuKey(sku)},
+				"sk": &types.AttributeValueMemberS{Value: skuLookupSk},
+			},
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ConditionExpression:       expr.Condition(),
+		},
+	}, nil
+}
+
+// isSkuConflict reports whether the transaction was cancelled by the condition on the SKU lookup item at idx
+func isSkuConflict(reasons []types.CancellationReason, idx int) bool {
+	return idx < len(reasons) && reasons[idx].Code != nil && *reasons[idx].Code == "ConditionalCheckFailed"
+}
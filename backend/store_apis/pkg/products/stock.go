@@ -0,0 +1,274 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// StockChange moves units of a product, or of one of its variants, in or out of its available stock and the
+// units held by reservations. Checkouts and inventory reservations make them, along with writes of their own
+type StockChange struct {
+	ProductId string
+	VariantId string // when set, the change applies to this variant of the product instead of the product
+	Stock     int64  // added to the available units, negative to take them
+	Reserved  int64  // added to the units held by reservations, negative to settle them
+	Price     *int64 // when set, the change is refused unless the product, or variant, is still sold at this price
+}
+
+// StockUpdate is a stock change applied to a product as read, ready for a ProductRepository to write
+type StockUpdate struct {
+	Current  *Item         // the product as read before the change, with its variants when some are changed
+	Updated  *Item         // the product with the change applied and its version bumped
+	Variants []VariantItem // the variants the change applies to, as updated
+	Change   *Change
+}
+
+var (
+	// ErrInsufficientStock means a change takes more units than the product has available
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrInsufficientReserved means a change settles more units than the product has reserved
+	ErrInsufficientReserved = errors.New("fewer units reserved than settled")
+	// ErrPriceChanged means the product is no longer sold at the price of a change
+	ErrPriceChanged = errors.New("price changed")
+)
+
+// JoinedWriteError reports the writes joined to a stock change whose conditions failed, cancelling the
+// change along with them. Failed holds their indexes in the joined writes
+type JoinedWriteError struct {
+	Failed []int
+	Err    error
+}
+
+func (e *JoinedWriteError) Error() string {
+	return fmt.Sprintf("joined writes %v failed: %v", e.Failed, e.Err)
+}
+
+func (e *JoinedWriteError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// maxTransactItems is the DynamoDB limit of actions in a single TransactWriteItems call
+	maxTransactItems = 100
+	// maxStockAttempts bounds the reads and writes of a stock change racing other writes to its products
+	maxStockAttempts = 3
+)
+
+// MaxStockChanges is the most changes a stock change is sure to fit along with the given number of joined
+// writes, each taking at most three actions of the transaction: the update of its product, the change
+// appended to its history and the write of its variant
+func MaxStockChanges(joined int) int {
+	return (maxTransactItems - joined) / 3
+}
+
+// ChangeStock applies the changes to their products, recording action in their history, in a single
+// transaction with joined, the writes of the caller to tables of its own. Changes to the same product are
+// merged. Products are read consistently and checked against the changes, then written guarded on their
+// version, so a product written meanwhile has the changes read and checked again, up to maxStockAttempts
+// times. Deleted products can only be given units back, and purged ones are not found. It returns the
+// products as stored
+func (s *Service) ChangeStock(ctx context.Context, action string, changes []StockChange, joined []types.TransactWriteItem) ([]Item, error) {
+	merged, ids, err := mergeStockChanges(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// every product takes its update and its change, and every variant its write
+	actions := len(joined) + 2*len(ids)
+	for _, id := range ids {
+		for _, change := range merged[id] {
+			if change.VariantId != "" {
+				actions++
+			}
+		}
+	}
+	if actions > maxTransactItems {
+		return nil, &ValidationError{Msg: fmt.Sprintf("stock changes of %d products cannot be written along with %d writes, at most %d actions fit a transaction", len(ids), len(joined), maxTransactItems)}
+	}
+
+	for attempt := 1; ; attempt++ {
+		items, err := s.readStock(ctx, ids, merged)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC().Unix()
+		updates := make([]StockUpdate, 0, len(items))
+		for i := range items {
+			update, err := newStockUpdate(ctx, action, &items[i], merged[items[i].Id], now)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, *update)
+		}
+
+		err = s.repo.ChangeStock(ctx, updates, joined)
+		if errors.Is(err, ErrVersionMismatch) && attempt < maxStockAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stored := make([]Item, 0, len(updates))
+		for _, update := range updates {
+			stored = append(stored, *update.Updated)
+		}
+		return stored, nil
+	}
+}
+
+// readStock reads the products of the changes consistently, deleted ones included. The products having
+// variants changed are read along with their variants, one at a time, the others in a batch
+func (s *Service) readStock(ctx context.Context, ids []string, merged map[string][]*StockChange) ([]Item, error) {
+	opts := ReadOptions{Consistent: true, IncludeDeleted: true}
+
+	items := make([]Item, 0, len(ids))
+	batched := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !changesVariants(merged[id]) {
+			batched = append(batched, id)
+			continue
+		}
+
+		item, err := s.repo.Get(ctx, id, opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+
+	if len(batched) > 0 {
+		batch, err := s.repo.BatchGet(ctx, batched, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch.Missing) > 0 {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, batch.Missing[0])
+		}
+		items = append(items, batch.Items...)
+	}
+	return items, nil
+}
+
+func changesVariants(changes []*StockChange) bool {
+	for _, change := range changes {
+		if change.VariantId != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeStockChanges sums the changes to each product, and to each of its variants, returning them by product
+// id along with the ids in the order they first appear. The changes of a product come in the order they
+// first appear too
+func mergeStockChanges(changes []StockChange) (map[string][]*StockChange, []string, error) {
+	if len(changes) == 0 {
+		return nil, nil, &ValidationError{Msg: "stock changes must hold at least one change"}
+	}
+
+	merged := make(map[string][]*StockChange, len(changes))
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if len(change.ProductId) == 0 {
+			return nil, nil, &ValidationError{Msg: "stock changes must have a product id"}
+		}
+
+		var m *StockChange
+		for _, other := range merged[change.ProductId] {
+			if other.VariantId == change.VariantId {
+				m = other
+			}
+		}
+		if m == nil {
+			if _, ok := merged[change.ProductId]; !ok {
+				ids = append(ids, change.ProductId)
+			}
+			m = &StockChange{ProductId: change.ProductId, VariantId: change.VariantId}
+			merged[change.ProductId] = append(merged[change.ProductId], m)
+		}
+
+		m.Stock += change.Stock
+		m.Reserved += change.Reserved
+		if change.Price != nil {
+			if m.Price != nil && *m.Price != *change.Price {
+				return nil, nil, &ValidationError{Msg: fmt.Sprintf("stock changes of %v expect two prices", stockTarget(change.ProductId, change.VariantId))}
+			}
+			m.Price = change.Price
+		}
+	}
+	return merged, ids, nil
+}
+
+// newStockUpdate checks the changes can be applied to the product, and its variants, and records them
+func newStockUpdate(ctx context.Context, action string, current *Item, changes []*StockChange, now int64) (*StockUpdate, error) {
+	updated := *current
+	updated.Version = current.Version + 1
+	updated.DateModified = now
+	updated.Variants = append([]VariantItem(nil), current.Variants...)
+
+	update := &StockUpdate{Current: current, Updated: &updated}
+	for _, change := range changes {
+		stock, reserved, price := &updated.Stock, &updated.Reserved, updated.Price
+		var variant *VariantItem
+		if change.VariantId != "" {
+			v, ok := updated.Variant(change.VariantId)
+			if !ok {
+				return nil, fmt.Errorf("%w: %v, of product %v", ErrVariantNotFound, change.VariantId, current.Id)
+			}
+			variant = v
+			stock, reserved, price = &variant.Stock, &variant.Reserved, updated.PriceOf(variant)
+		}
+
+		target := stockTarget(current.Id, change.VariantId)
+		if current.Deleted() && change.Stock < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, current.Id)
+		}
+		if *stock+change.Stock < 0 {
+			return nil, fmt.Errorf("%w: %v has %d units available, not %d", ErrInsufficientStock, target, *stock, -change.Stock)
+		}
+		if *reserved+change.Reserved < 0 {
+			return nil, fmt.Errorf("%w: %v has %d units reserved, not %d", ErrInsufficientReserved, target, *reserved, -change.Reserved)
+		}
+		if change.Price != nil && price != *change.Price {
+			return nil, fmt.Errorf("%w: %v is sold at %d, not %d", ErrPriceChanged, target, price, *change.Price)
+		}
+
+		*stock += change.Stock
+		*reserved += change.Reserved
+		if variant != nil {
+			variant.DateModified = now
+		}
+	}
+
+	record, err := newChange(ctx, action, current, &updated, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.VariantId == "" {
+			continue
+		}
+		before, _ := current.Variant(change.VariantId)
+		after, _ := updated.Variant(change.VariantId)
+		if err := addVariantDiff(record, before, after); err != nil {
+			return nil, err
+		}
+		update.Variants = append(update.Variants, *after)
+	}
+	update.Change = record
+	return update, nil
+}
+
+// stockTarget names what a stock change applies to in its errors
+func stockTarget(productId, variantId string) string {
+	if variantId != "" {
+		return fmt.Sprintf("variant %v of product %v", variantId, productId)
+	}
+	return "product " + productId
+}
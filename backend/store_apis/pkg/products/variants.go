@@ -0,0 +1,261 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/validator.v2"
+)
+
+// Variant is a purchasable version of a product, e.g. a size and colour of a shirt, with its own SKU and stock.
+// Basket lines, orders and reservations naming a variant take its stock, at its price
+type Variant struct {
+	Sku     string            `json:"sku" validate:"nonzero"`
+	Price   *int64            `json:"price"` // overrides the price of the product when set, in minor units
+	Stock   int64             `json:"stock" validate:"min=0"`
+	Options map[string]string `json:"options"` // option name to value, e.g. {"size": "M", "colour": "blue"}
+}
+
+// VariantItem is stored in the item collection of its product, under a sort key made of its id. Writing
+// a variant bumps the version of the product, whose ETag then covers its variants too
+type VariantItem struct {
+	Id           string            `dynamodbav:"variantId"`
+	DateModified int64             `dynamodbav:"dateModified"`
+	Sku          string            `dynamodbav:"sku"`
+	Price        *int64            `dynamodbav:"price,omitempty"`
+	Stock        int64             `dynamodbav:"stock"`
+	Reserved     int64             `dynamodbav:"reserved"` // units held by inventory reservations
+	Options      map[string]string `dynamodbav:"options"`
+}
+
+// Variants lists the variants of a product, in no particular order
+type Variants struct {
+	Items []VariantItem `json:"items"`
+}
+
+// MaxVariants bounds the variants of a product, keeping them a single Query page
+const MaxVariants = 100
+
+var (
+	ErrVariantNotFound = errors.New("no variant found with id")
+	ErrOptionsInUse    = errors.New("another variant of the product has the same options")
+	ErrVariantReserved = errors.New("variant has units held by reservations")
+)
+
+// VariantWrite describes a write to a variant of a stored product. Before is nil for a new variant, and
+// After for a deleted one
+type VariantWrite struct {
+	Product      *Item // the product as read before the write, with its variants
+	Before       *VariantItem
+	After        *VariantItem
+	DateModified int64 // of the product once written
+}
+
+// applyTo returns a copy of the product with the write applied and its version bumped
+func (w *VariantWrite) applyTo(product *Item) *Item {
+	updated := *product
+	updated.Version = product.Version + 1
+	updated.DateModified = w.DateModified
+
+	updated.Variants = make([]VariantItem, 0, len(product.Variants)+1)
+	for _, variant := range product.Variants {
+		if w.Before == nil || variant.Id != w.Before.Id {
+			updated.Variants = append(updated.Variants, variant)
+		}
+	}
+	if w.After != nil {
+		updated.Variants = append(updated.Variants, *w.After)
+	}
+
+	// in the order of their sort keys, as a Query returns them
+	sort.Slice(updated.Variants, func(i, j int) bool {
+		return updated.Variants[i].Id < updated.Variants[j].Id
+	})
+	if len(updated.Variants) == 0 {
+		updated.Variants = nil
+	}
+	return &updated
+}
+
+// newSku returns the SKU the write claims, if it is not the one the variant already has
+func (w *VariantWrite) newSku() (string, bool) {
+	if w.After == nil || (w.Before != nil && skuKey(w.After.Sku) == skuKey(w.Before.Sku)) {
+		return "", false
+	}
+	return w.After.Sku, true
+}
+
+// oldSku returns the SKU the write releases, if the variant no longer has it afterwards
+func (w *VariantWrite) oldSku() (string, bool) {
+	if w.Before == nil || (w.After != nil && skuKey(w.After.Sku) == skuKey(w.Before.Sku)) {
+		return "", false
+	}
+	return w.Before.Sku, true
+}
+
+// Variant returns the variant of the product with the given id, as read along with the product
+func (i *Item) Variant(id string) (*VariantItem, bool) {
+	for v := range i.Variants {
+		if i.Variants[v].Id == id {
+			return &i.Variants[v], true
+		}
+	}
+	return nil, false
+}
+
+// PriceOf is the price the variant is sold at, that of the product unless the variant overrides it. A nil
+// variant stands for the product itself
+func (i *Item) PriceOf(variant *VariantItem) int64 {
+	if variant != nil && variant.Price != nil {
+		return *variant.Price
+	}
+	return i.Price
+}
+
+func validateVariant(variant *Variant) error {
+	if err := validator.WithPrintJSON(true).Validate(variant); err != nil {
+		return &ValidationError{Msg: "error variant validation", Err: err}
+	}
+	if variant.Price != nil && *variant.Price < 0 {
+		return &ValidationError{Msg: "variant price must not be negative"}
+	}
+	if len(variant.Options) == 0 {
+		return &ValidationError{Msg: "variant options must hold at least one option"}
+	}
+	for name, value := range variant.Options {
+		if len(strings.TrimSpace(name)) == 0 || len(strings.TrimSpace(value)) == 0 {
+			return &ValidationError{Msg: "variant option names and values must not be empty"}
+		}
+	}
+	return nil
+}
+
+// CreateVariant adds a variant to the product with the given id, as long as it is still at version, and
+// returns the variant along with the product as stored
+func (s *Service) CreateVariant(ctx context.Context, productId string, version int64, variant *Variant) (*VariantItem, *Item, error) {
+	if err := validateVariant(variant); err != nil {
+		return nil, nil, err
+	}
+
+	product, err := s.getVersion(ctx, productId, version, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(product.Variants) >= MaxVariants {
+		return nil, nil, &ValidationError{Msg: fmt.Sprintf("products cannot have more than %d variants", MaxVariants)}
+	}
+
+	now := time.Now().UTC().Unix()
+	created := &VariantItem{
+		Id:           uuid.New().String(),
+		DateModified: now,
+		Sku:          variant.Sku,
+		Price:        variant.Price,
+		Stock:        variant.Stock,
+		Options:      variant.Options,
+	}
+
+	updated, err := s.writeVariant(ctx, ActionCreateVariant, &VariantWrite{
+		Product:      product,
+		After:        created,
+		DateModified: now,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, updated, nil
+}
+
+// UpdateVariant replaces the fields of a variant of the product with the given id, as long as the product is
+// still at version, and returns the variant along with the product as stored
+func (s *Service) UpdateVariant(ctx context.Context, productId, variantId string, version int64, variant *Variant) (*VariantItem, *Item, error) {
+	if err := validateVariant(variant); err != nil {
+		return nil, nil, err
+	}
+
+	product, err := s.getVersion(ctx, productId, version, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, ok := product.Variant(variantId)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %v", ErrVariantNotFound, variantId)
+	}
+
+	// the reserved units are only moved by stock changes
+	now := time.Now().UTC().Unix()
+	replaced := &VariantItem{
+		Id:           variantId,
+		DateModified: now,
+		Sku:          variant.Sku,
+		Price:        variant.Price,
+		Stock:        variant.Stock,
+		Reserved:     current.Reserved,
+		Options:      variant.Options,
+	}
+
+	updated, err := s.writeVariant(ctx, ActionUpdateVariant, &VariantWrite{
+		Product:      product,
+		Before:       current,
+		After:        replaced,
+		DateModified: now,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return replaced, updated, nil
+}
+
+// DeleteVariant removes a variant of the product with the given id for good, releasing its SKU, as long as
+// the product is still at version, and returns the product as stored. A variant holding reserved units is
+// kept until its reservations are settled, as they could not give them back otherwise
+func (s *Service) DeleteVariant(ctx context.Context, productId, variantId string, version int64) (*Item, error) {
+	product, err := s.getVersion(ctx, productId, version, false)
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := product.Variant(variantId)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrVariantNotFound, variantId)
+	}
+	if current.Reserved > 0 {
+		return nil, fmt.Errorf("%w: %v has %d units reserved", ErrVariantReserved, variantId, current.Reserved)
+	}
+
+	return s.writeVariant(ctx, ActionDeleteVariant, &VariantWrite{
+		Product:      product,
+		Before:       current,
+		DateModified: time.Now().UTC().Unix(),
+	})
+}
+
+// writeVariant checks no other variant of the product has the options of the written one, then writes it
+// recording action in the history of the product
+func (s *Service) writeVariant(ctx context.Context, action string, write *VariantWrite) (*Item, error) {
+	if write.After != nil {
+		for _, other := range write.Product.Variants {
+			if other.Id != write.After.Id && reflect.DeepEqual(other.Options, write.After.Options) {
+				return nil, fmt.Errorf("%w: %v", ErrOptionsInUse, other.Id)
+			}
+		}
+	}
+
+	change, err := newVariantChange(ctx, action, write)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.WriteVariant(ctx, write, change)
+	if err != nil {
+		return nil, s.writeErr(ctx, write.Product.Id, err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type HandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Router dispatches API Gateway proxy requests on method + resource template, e.g. `GET /products/{id}`
+type Router struct {
+	routes map[string]map[string]HandlerFunc // resource -> method -> handler
+}
+
+func New() *Router {
+	return &Router{
+		routes: make(map[string]map[string]HandlerFunc),
+	}
+}
+
+func (r *Router) Handle(method, resource string, h HandlerFunc) {
+	if _, ok := r.routes[resource]; !ok {
+		r.routes[resource] = make(map[string]HandlerFunc)
+	}
+	r.routes[resource][method] = h
+}
+
+// Serve dispatches the request with its RequestInfo in ctx, then stamps its path and id on error responses
+func (r *Router) Serve(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	resp, err := r.serve(utils.WithRequestInfo(ctx, utils.NewRequestInfo(request)), request)
+	if err == nil {
+		utils.SetProblemRequest(&resp, request)
+	}
+	return resp, err
+}
+
+func (r *Router) serve(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	methods, ok := r.routes[request.Resource]
+	if !ok {
+		msj := fmt.Sprintf("resource not found: %v", request.Resource)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusNotFound,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	h, ok := methods[request.HTTPMethod]
+	if !ok {
+		msj := fmt.Sprintf("method %v not allowed on resource: %v", request.HTTPMethod, request.Resource)
+		return utils.SendErr(&utils.APIResponse{
+			StatusCode: http.StatusMethodNotAllowed,
+			Data:       msj,
+			LogMessage: msj,
+			Headers:    map[string]string{"Allow": allowed(methods)},
+		})
+	}
+
+	return h(ctx, request)
+}
+
+func allowed(methods map[string]HandlerFunc) string {
+	out := make([]string, 0, len(methods))
+	for m := range methods {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
+
+// Match resolves a request path to its registered resource template and path parameters, the way API
+// Gateway does before invoking the Lambda. Literal segments take precedence over `{param}` segments,
+// so `/inventory/reservations` wins over `/inventory/{productId}`
+func (r *Router) Match(path string) (string, map[string]string, bool) {
+	segments := splitPath(path)
+
+	var (
+		best       string
+		bestRank   string
+		bestParams map[string]string
+	)
+	for resource := range r.routes {
+		params, rank, ok := matchTemplate(splitPath(resource), segments)
+		if !ok {
+			continue
+		}
+		if bestParams == nil || rank > bestRank {
+			best, bestRank, bestParams = resource, rank, params
+		}
+	}
+
+	return best, bestParams, bestParams != nil
+}
+
+// matchTemplate returns the path parameters and a rank with one char per segment, `1` for literals
+// and `0` for parameters, so comparing ranks prefers the most literal template
+func matchTemplate(template, segments []string) (map[string]string, string, bool) {
+	if len(template) != len(segments) {
+		return nil, "", false
+	}
+
+	params := map[string]string{}
+	rank := make([]byte, 0, len(template))
+	for i, t := range template {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segments[i] == "" {
+				return nil, "", false
+			}
+			params[strings.Trim(t, "{}")] = segments[i]
+			rank = append(rank, '0')
+			continue
+		}
+		if t != segments[i] {
+			return nil, "", false
+		}
+		rank = append(rank, '1')
+	}
+
+	return params, string(rank), true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
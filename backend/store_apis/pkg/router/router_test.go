@@ -0,0 +1,168 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"store_apis/pkg/utils"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Serve(t *testing.T) {
+	r := New()
+	ok := func(status int) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{StatusCode: status}, nil
+		}
+	}
+	r.Handle(http.MethodGet, "/products", ok(http.StatusOK))
+	r.Handle(http.MethodPost, "/products", ok(http.StatusCreated))
+	r.Handle(http.MethodGet, "/products/{id}", ok(http.StatusAccepted))
+
+	subtests := []struct {
+		name          string
+		method        string
+		resource      string
+		expected      int
+		expectedAllow string
+	}{
+		{
+			name:     "list",
+			method:   http.MethodGet,
+			resource: "/products",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "create",
+			method:   http.MethodPost,
+			resource: "/products",
+			expected: http.StatusCreated,
+		},
+		{
+			name:     "read_one",
+			method:   http.MethodGet,
+			resource: "/products/{id}",
+			expected: http.StatusAccepted,
+		},
+		{
+			name:     "unknown_resource",
+			method:   http.MethodGet,
+			resource: "/orders",
+			expected: http.StatusNotFound,
+		},
+		{
+			name:          "method_not_allowed",
+			method:        http.MethodDelete,
+			resource:      "/products",
+			expected:      http.StatusMethodNotAllowed,
+			expectedAllow: "GET, POST",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			resp, err := r.Serve(context.TODO(), events.APIGatewayProxyRequest{
+				HTTPMethod: st.method,
+				Resource:   st.resource,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, st.expected, resp.StatusCode)
+			assert.Equal(t, st.expectedAllow, resp.Headers["Allow"])
+		})
+	}
+}
+
+func Test_Match(t *testing.T) {
+	r := New()
+	noop := func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{}, nil
+	}
+	r.Handle(http.MethodGet, "/products", noop)
+	r.Handle(http.MethodGet, "/products/{id}", noop)
+	r.Handle(http.MethodGet, "/inventory/{productId}", noop)
+	r.Handle(http.MethodPost, "/inventory/reservations", noop)
+	r.Handle(http.MethodPut, "/baskets/{id}/items/{productId}", noop)
+
+	subtests := []struct {
+		name             string
+		path             string
+		expectedResource string
+		expectedParams   map[string]string
+		expectedOk       bool
+	}{
+		{
+			name:             "literal",
+			path:             "/products",
+			expectedResource: "/products",
+			expectedParams:   map[string]string{},
+			expectedOk:       true,
+		},
+		{
+			name:             "trailing_slash",
+			path:             "/products/",
+			expectedResource: "/products",
+			expectedParams:   map[string]string{},
+			expectedOk:       true,
+		},
+		{
+			name:             "path_param",
+			path:             "/products/100",
+			expectedResource: "/products/{id}",
+			expectedParams:   map[string]string{"id": "100"},
+			expectedOk:       true,
+		},
+		{
+			name:             "literal_wins_over_param",
+			path:             "/inventory/reservations",
+			expectedResource: "/inventory/reservations",
+			expectedParams:   map[string]string{},
+			expectedOk:       true,
+		},
+		{
+			name:             "multiple_params",
+			path:             "/baskets/b1/items/100",
+			expectedResource: "/baskets/{id}/items/{productId}",
+			expectedParams:   map[string]string{"id": "b1", "productId": "100"},
+			expectedOk:       true,
+		},
+		{
+			name: "unknown_path",
+			path: "/products/100/variants",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			resource, params, ok := r.Match(st.path)
+			assert.Equal(t, st.expectedOk, ok)
+			assert.Equal(t, st.expectedResource, resource)
+			if st.expectedOk {
+				assert.Equal(t, st.expectedParams, params)
+			}
+		})
+	}
+}
+
+func Test_Serve_Problem(t *testing.T) {
+	r := New()
+
+	resp, err := r.Serve(context.TODO(), events.APIGatewayProxyRequest{
+		Resource:       "/orders",
+		Path:           "/orders",
+		HTTPMethod:     http.MethodGet,
+		RequestContext: events.APIGatewayProxyRequestContext{RequestID: "req-1"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, utils.ProblemContentType, resp.Headers["Content-Type"])
+
+	problem := new(utils.Problem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), problem))
+	assert.Equal(t, "/orders", problem.Instance)
+	assert.Equal(t, "req-1", problem.RequestId)
+}
@@ -0,0 +1,68 @@
+package thumbnails
+
+import (
+	"image"
+	"image/draw"
+)
+
+// fitSize returns the dimensions of an image of width by height scaled down to fit in a square of size,
+// keeping its aspect ratio. Images already fitting keep their dimensions
+func fitSize(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, maxInt(1, (height*size+width/2)/width)
+	}
+	return maxInt(1, (width*size+height/2)/height), size
+}
+
+// Fit scales src down to fit in a square of size, keeping its aspect ratio. Every pixel of the result is
+// the average of the source pixels it covers, which keeps thin lines and fine patterns from aliasing
+func Fit(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := fitSize(sw, sh, size)
+
+	// draw has fast paths from the decoded JPEG and PNG images to RGBA, reading pixels through At does not
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	if dw == sw && dh == sh {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[y*rgba.Stride+x0*4 : y*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					// RGBA is premultiplied by alpha, so transparent pixels add no colour
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+				}
+				n += uint64(x1 - x0)
+			}
+
+			off := dy*dst.Stride + dx*4
+			dst.Pix[off] = uint8((r + n/2) / n)
+			dst.Pix[off+1] = uint8((g + n/2) / n)
+			dst.Pix[off+2] = uint8((b + n/2) / n)
+			dst.Pix[off+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
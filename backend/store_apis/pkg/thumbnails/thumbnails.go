@@ -0,0 +1,150 @@
+// Package thumbnails resizes the product images uploaded to the images bucket, for list views and product
+// pages to load files of the size they show
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	aws_services "store_apis/pkg/aws"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// maxPixels bounds the decoded size of an image, as a small file can hold a huge image
+	maxPixels = 50_000_000
+	// jpegQuality is the quality of JPEG thumbnails, which are re-encoded from JPEG images only
+	jpegQuality = 85
+	// cacheControl of the thumbnails, which are never rewritten as every upload gets a key of its own
+	cacheControl = "public, max-age=31536000, immutable"
+)
+
+// ErrUnsupportedImage means the file is not an image that can be resized, retrying would not change that
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+// Generator writes the thumbnails of the uploaded images back to the bucket and records them on the products
+type Generator struct {
+	cfg      *config.Cfg
+	awsSvc   *aws_services.AWS
+	products products.IProduct
+}
+
+func NewGenerator(cfg *config.Cfg, awsSvc *aws_services.AWS, products products.IProduct) *Generator {
+	return &Generator{cfg: cfg, awsSvc: awsSvc, products: products}
+}
+
+// Generate resizes the image at key in bucket to each of the configured sizes, keeping its format, and
+// records the thumbnails on the image of the product. Products or images removed since the upload are
+// reported as products.ErrNotFound and products.ErrImageNotFound, after the thumbnails are written
+func (g *Generator) Generate(ctx context.Context, bucket, key string) ([]products.Thumbnail, error) {
+	productId, ok := products.ImageProductId(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v is not the key of a product image", ErrUnsupportedImage, key)
+	}
+
+	src, format, err := g.read(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails := make([]products.Thumbnail, 0, len(g.cfg.ThumbnailSizes))
+	for _, size := range g.cfg.ThumbnailSizes {
+		thumbnail, err := g.write(ctx, bucket, key, src, format, size)
+		if err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, *thumbnail)
+	}
+
+	if _, err := g.products.SetThumbnails(ctx, productId, key, thumbnails); err != nil {
+		return nil, err
+	}
+	return thumbnails, nil
+}
+
+// read downloads and decodes the image, returning the name of its format
+func (g *Generator) read(ctx context.Context, bucket, key string) (image.Image, string, error) {
+	out, err := g.awsSvc.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting object %v: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	// uploads are held to products.MaxImageSize, anything larger did not come through a presigned upload
+	data, err := io.ReadAll(io.LimitReader(out.Body, products.MaxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading object %v: %w", key, err)
+	}
+	if len(data) > products.MaxImageSize {
+		return nil, "", fmt.Errorf("%w: %v is larger than %d bytes", ErrUnsupportedImage, key, products.MaxImageSize)
+	}
+
+	imgCfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v: %v", ErrUnsupportedImage, key, err)
+	}
+	if imgCfg.Width*imgCfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %v is %dx%d pixels", ErrUnsupportedImage, key, imgCfg.Width, imgCfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v: %v", ErrUnsupportedImage, key, err)
+	}
+	return src, format, nil
+}
+
+// write uploads the thumbnail of src fitting in a square of size
+func (g *Generator) write(ctx context.Context, bucket, key string, src image.Image, format string, size int) (*products.Thumbnail, error) {
+	dst := Fit(src, size)
+
+	buf := new(bytes.Buffer)
+	contentType := ""
+	switch format {
+	case "jpeg":
+		contentType = "image/jpeg"
+		if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("error encoding thumbnail of %v: %w", key, err)
+		}
+	case "png":
+		contentType = "image/png"
+		if err := png.Encode(buf, dst); err != nil {
+			return nil, fmt.Errorf("error encoding thumbnail of %v: %w", key, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v is %v", ErrUnsupportedImage, key, format)
+	}
+
+	thumbnail := &products.Thumbnail{
+		Size:   size,
+		Key:    products.ThumbnailKey(key, size),
+		Width:  dst.Bounds().Dx(),
+		Height: dst.Bounds().Dy(),
+	}
+
+	_, err := g.awsSvc.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(thumbnail.Key),
+		Body:          bytes.NewReader(buf.Bytes()),
+		ContentLength: int64(buf.Len()),
+		ContentType:   aws.String(contentType),
+		CacheControl:  aws.String(cacheControl),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error putting object %v: %w", thumbnail.Key, err)
+	}
+	return thumbnail, nil
+}
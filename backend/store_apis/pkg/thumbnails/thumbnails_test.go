@@ -0,0 +1,170 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"testing"
+
+	aws_services "store_apis/pkg/aws"
+	fake_aws_services "store_apis/pkg/aws/fakes"
+	"store_apis/pkg/config"
+	"store_apis/pkg/products"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeFixture(t *testing.T, name string) image.Image {
+	f, err := os.Open("testdata/" + name)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	assert.NoError(t, err)
+	return img
+}
+
+func Test_Fit(t *testing.T) {
+	photo := decodeFixture(t, "photo.jpg")
+	assert.Equal(t, image.Rect(0, 0, 200, 150), Fit(photo, 200).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 800, 600), Fit(photo, 800).Bounds())
+
+	// the top half of the logo is opaque red, the bottom half transparent
+	logo := Fit(decodeFixture(t, "logo.png"), 200)
+	assert.Equal(t, image.Rect(0, 0, 100, 200), logo.Bounds())
+	r, g, b, a := logo.At(50, 50).RGBA()
+	assert.Equal(t, []uint32{200, 30, 30, 255}, []uint32{r >> 8, g >> 8, b >> 8, a >> 8})
+	_, _, _, a = logo.At(50, 150).RGBA()
+	assert.Zero(t, a)
+
+	// images are never scaled up
+	assert.Equal(t, image.Rect(0, 0, 120, 80), Fit(decodeFixture(t, "small.png"), 200).Bounds())
+
+	w, h := fitSize(1000, 1, 200)
+	assert.Equal(t, []int{200, 1}, []int{w, h})
+	w, h = fitSize(333, 1000, 200)
+	assert.Equal(t, []int{67, 200}, []int{w, h})
+}
+
+// newTestGenerator sets up the products on an in-memory repository, uploading images to a fake bucket
+func newTestGenerator() (*Generator, products.IProduct, *fake_aws_services.S3, *config.Cfg) {
+	cfg := &config.Cfg{ImagesBucket: "images", ThumbnailSizes: []int{200, 800}}
+	fakeS3 := fake_aws_services.NewS3()
+	fakeS3.CreateBucket(cfg.ImagesBucket)
+	awsSvc := &aws_services.AWS{S3Client: fakeS3, S3Presigner: fakeS3}
+
+	p := products.NewService(products.NewMemoryRepository(), products.NewS3ImageStore(cfg, awsSvc))
+	return NewGenerator(cfg, awsSvc, p), p, fakeS3, cfg
+}
+
+// upload adds an image to the product and puts the fixture under its key, as the client would
+func upload(t *testing.T, p products.IProduct, fakeS3 *fake_aws_services.S3, cfg *config.Cfg, productId, fixture, contentType string) string {
+	data, err := os.ReadFile("testdata/" + fixture)
+	assert.NoError(t, err)
+
+	up, _, err := p.AddImage(context.TODO(), productId, products.AnyVersion, &products.Image{ContentType: contentType, Size: int64(len(data))})
+	assert.NoError(t, err)
+
+	_, err = fakeS3.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.ImagesBucket),
+		Key:         aws.String(up.Image.Key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	assert.NoError(t, err)
+	return up.Image.Key
+}
+
+func Test_Generate(t *testing.T) {
+	g, p, fakeS3, cfg := newTestGenerator()
+
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	photoKey := upload(t, p, fakeS3, cfg, created.Id, "photo.jpg", "image/jpeg")
+	logoKey := upload(t, p, fakeS3, cfg, created.Id, "logo.png", "image/png")
+
+	generated, err := g.Generate(context.TODO(), cfg.ImagesBucket, photoKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []products.Thumbnail{
+		{Size: 200, Key: "thumbnails/200/" + photoKey, Width: 200, Height: 150},
+		{Size: 800, Key: "thumbnails/800/" + photoKey, Width: 800, Height: 600},
+	}, generated)
+
+	_, err = g.Generate(context.TODO(), cfg.ImagesBucket, logoKey)
+	assert.NoError(t, err)
+
+	// thumbnails keep the format of their image
+	for key, expected := range map[string]string{
+		"thumbnails/800/" + photoKey: "jpeg",
+		"thumbnails/200/" + logoKey:  "png",
+	} {
+		out, err := fakeS3.GetObject(context.TODO(), &s3.GetObjectInput{Bucket: aws.String(cfg.ImagesBucket), Key: aws.String(key)})
+		assert.NoError(t, err)
+		assert.Equal(t, "image/"+expected, aws.ToString(out.ContentType))
+
+		imgCfg, format, err := image.DecodeConfig(out.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format)
+		assert.LessOrEqual(t, imgCfg.Width, 800)
+	}
+
+	item, err := p.GetProduct(context.TODO(), created.Id, products.ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, generated, item.Images[0].Thumbnails)
+	assert.Equal(t, 100, item.Images[1].Thumbnails[0].Width)
+	assert.Equal(t, int64(5), item.Version)
+
+	history, err := p.ProductHistory(context.TODO(), created.Id, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, products.ActionSetThumbnails, history.Items[0].Action)
+	assert.Equal(t, products.SystemActor, history.Items[0].Actor)
+}
+
+func Test_Generate_ReturnError(t *testing.T) {
+	g, p, fakeS3, cfg := newTestGenerator()
+
+	created, err := p.CreateProduct(context.TODO(), &products.Product{
+		Name:        "valid product",
+		Description: "valid product description",
+		Currency:    "USD",
+		Sku:         "VP-001",
+	})
+	assert.NoError(t, err)
+
+	_, err = g.Generate(context.TODO(), cfg.ImagesBucket, "thumbnails/200/products/"+created.Id+"/a.png")
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+
+	// the file is not there, which may be worth retrying
+	_, err = g.Generate(context.TODO(), cfg.ImagesBucket, "products/"+created.Id+"/a.png")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedImage)
+
+	key := upload(t, p, fakeS3, cfg, created.Id, "small.png", "image/png")
+	_, err = fakeS3.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(cfg.ImagesBucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte("not an image")),
+	})
+	assert.NoError(t, err)
+
+	_, err = g.Generate(context.TODO(), cfg.ImagesBucket, key)
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+
+	// an image removed after its upload still gets its thumbnails, which nothing refers to
+	key = upload(t, p, fakeS3, cfg, created.Id, "small.png", "image/png")
+	_, err = p.UpdateImages(context.TODO(), created.Id, products.AnyVersion, []products.ImageText{})
+	assert.NoError(t, err)
+
+	_, err = g.Generate(context.TODO(), cfg.ImagesBucket, key)
+	assert.ErrorIs(t, err, products.ErrImageNotFound)
+	assert.Contains(t, fakeS3.Keys(cfg.ImagesBucket), "thumbnails/200/"+key)
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrorKind groups AWS SDK errors by what they mean for the API client
+type ErrorKind int
+
+const (
+	KindInternal        ErrorKind = iota
+	KindConditionFailed           // a ConditionExpression did not hold
+	KindConflict                  // a concurrent transaction touched the same items
+	KindThrottled                 // provisioned throughput or request rate exceeded
+	KindUnavailable               // the table is missing or AWS is failing
+	KindInvalid                   // the request was rejected as malformed, which is a bug in how we built it
+)
+
+// ClassifyAWSError inspects err, and whatever it wraps, for the AWS SDK errors the APIs can answer
+// better than with a 500. Cancelled transactions are classified by their first failed action
+func ClassifyAWSError(err error) ErrorKind {
+	var (
+		ccfe *types.ConditionalCheckFailedException
+		tce  *types.TransactionCanceledException
+		tcfe *types.TransactionConflictException
+		tipe *types.TransactionInProgressException
+		pte  *types.ProvisionedThroughputExceededException
+		rle  *types.RequestLimitExceeded
+		rnfe *types.ResourceNotFoundException
+		ise  *types.InternalServerError
+		ae   smithy.APIError
+	)
+
+	switch {
+	case err == nil:
+		return KindInternal
+	case errors.As(err, &ccfe):
+		return KindConditionFailed
+	case errors.As(err, &tce):
+		return classifyCancellation(tce.CancellationReasons)
+	case errors.As(err, &tcfe), errors.As(err, &tipe):
+		return KindConflict
+	case errors.As(err, &pte), errors.As(err, &rle):
+		return KindThrottled
+	case errors.As(err, &rnfe), errors.As(err, &ise):
+		return KindUnavailable
+	case errors.As(err, &ae):
+		switch ae.ErrorCode() {
+		case "ThrottlingException":
+			return KindThrottled
+		case "ValidationException":
+			return KindInvalid
+		}
+		if ae.ErrorFault() == smithy.FaultServer {
+			return KindUnavailable
+		}
+	}
+
+	return KindInternal
+}
+
+func classifyCancellation(reasons []types.CancellationReason) ErrorKind {
+	for _, r := range reasons {
+		switch aws.ToString(r.Code) {
+		case "", "None":
+			continue
+		case "ConditionalCheckFailed":
+			return KindConditionFailed
+		case "TransactionConflict":
+			return KindConflict
+		case "ThrottlingError", "ProvisionedThroughputExceeded", "RequestLimitExceeded":
+			return KindThrottled
+		case "ValidationError", "ItemCollectionSizeLimitExceeded":
+			return KindInvalid
+		default:
+			return KindInternal
+		}
+	}
+	return KindInternal
+}
+
+// AWSErrResponse builds the error response for an AWS SDK error returned while doing action, e.g.
+// "error putting item". condFailedStatus is what a failed ConditionExpression means for this call, which
+// only the caller knows: http.StatusNotFound for `attribute_exists(id)` guards, http.StatusConflict for
+// `attribute_not_exists(id)` or version guards. The client gets a stable message, the log keeps the details,
+// as AWS error messages name tables and echo expressions
+func AWSErrResponse(err error, action string, condFailedStatus int) *APIResponse {
+	aR := &APIResponse{
+		LogMessage: fmt.Sprintf("%s: %v", action, err),
+	}
+
+	switch ClassifyAWSError(err) {
+	case KindConditionFailed:
+		aR.StatusCode = condFailedStatus
+		if condFailedStatus == http.StatusNotFound {
+			aR.Data = fmt.Sprintf("%s: item not found", action)
+		} else {
+			aR.Data = fmt.Sprintf("%s: item was modified concurrently or does not meet the required state", action)
+		}
+	case KindConflict:
+		aR.StatusCode = http.StatusConflict
+		aR.Data = fmt.Sprintf("%s: conflicting concurrent update, retry the request", action)
+	case KindThrottled:
+		aR.StatusCode = http.StatusTooManyRequests
+		aR.Data = fmt.Sprintf("%s: too many requests, retry later", action)
+		aR.Headers = map[string]string{"Retry-After": "1"}
+	case KindUnavailable:
+		aR.StatusCode = http.StatusServiceUnavailable
+		aR.Data = fmt.Sprintf("%s: service temporarily unavailable", action)
+	default:
+		// KindInvalid too: the requests are built from validated input, so a malformed one is ours to fix
+		aR.StatusCode = http.StatusInternalServerError
+		aR.Data = fmt.Sprintf("%s: internal error", action)
+	}
+
+	return aR
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AWSErrResponse(t *testing.T) {
+	subtests := []struct {
+		name             string
+		err              error
+		condFailedStatus int
+		expected         int
+		expectedData     string
+	}{
+		{
+			name:             "condition_failed_not_found",
+			err:              &types.ConditionalCheckFailedException{},
+			condFailedStatus: http.StatusNotFound,
+			expected:         http.StatusNotFound,
+			expectedData:     "error updating item: item not found",
+		},
+		{
+			name:             "condition_failed_conflict",
+			err:              fmt.Errorf("error putting item: %w", &types.ConditionalCheckFailedException{}),
+			condFailedStatus: http.StatusConflict,
+			expected:         http.StatusConflict,
+		},
+		{
+			name: "transaction_condition_failed",
+			err: &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed")},
+				},
+			},
+			condFailedStatus: http.StatusNotFound,
+			expected:         http.StatusNotFound,
+		},
+		{
+			name: "transaction_throttled",
+			err: &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("ThrottlingError")},
+				},
+			},
+			expected: http.StatusTooManyRequests,
+		},
+		{
+			name:     "transaction_conflict",
+			err:      &types.TransactionConflictException{},
+			expected: http.StatusConflict,
+		},
+		{
+			name:         "throughput_exceeded",
+			err:          &types.ProvisionedThroughputExceededException{},
+			expected:     http.StatusTooManyRequests,
+			expectedData: "error updating item: too many requests, retry later",
+		},
+		{
+			name:     "throttling",
+			err:      &smithy.GenericAPIError{Code: "ThrottlingException"},
+			expected: http.StatusTooManyRequests,
+		},
+		{
+			name:     "table_not_found",
+			err:      &types.ResourceNotFoundException{},
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "server_fault",
+			err:      &smithy.GenericAPIError{Code: "ServiceUnavailable", Fault: smithy.FaultServer},
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "validation",
+			err:          &smithy.GenericAPIError{Code: "ValidationException", Message: "Invalid UpdateExpression: #0", Fault: smithy.FaultClient},
+			expected:     http.StatusInternalServerError,
+			expectedData: "error updating item: internal error",
+		},
+		{
+			name: "transaction_validation",
+			err: &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("ValidationError")},
+				},
+			},
+			expected: http.StatusInternalServerError,
+		},
+		{
+			name:         "unknown",
+			err:          errors.New("table dev-my-store-products: some detailed error"),
+			expected:     http.StatusInternalServerError,
+			expectedData: "error updating item: internal error",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			aR := AWSErrResponse(st.err, "error updating item", st.condFailedStatus)
+			assert.Equal(t, st.expected, aR.StatusCode)
+			assert.Contains(t, aR.LogMessage, "error updating item")
+			assert.NotContains(t, aR.Data, "dev-my-store-products")
+			if st.expectedData != "" {
+				assert.Equal(t, st.expectedData, aR.Data)
+			}
+		})
+	}
+}
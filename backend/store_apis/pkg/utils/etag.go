@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+)
+
+// ETag quotes value as a strong entity tag, e.g. `"3"`
+func ETag(value string) string {
+	return `"` + value + `"`
+}
+
+// ParseETags splits an If-Match or If-None-Match header into its entity tags, `*` included
+func ParseETags(header string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ETagValue unquotes a strong entity tag. Weak tags, `W/"..."`, never match strongly and are rejected
+func ETagValue(tag string) (string, bool) {
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return "", false
+	}
+	return tag[1 : len(tag)-1], true
+}
+
+// WeakMatch compares two entity tags ignoring whether they are weak, as If-None-Match does
+func WeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseETags(t *testing.T) {
+	assert.Equal(t, []string{`"1"`, `W/"2"`, "*"}, ParseETags(` "1", W/"2" ,*`))
+	assert.Empty(t, ParseETags(""))
+
+	value, ok := ETagValue(ETag("3"))
+	assert.True(t, ok)
+	assert.Equal(t, "3", value)
+
+	_, ok = ETagValue(`W/"3"`)
+	assert.False(t, ok)
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	DefaultPageLimit int32 = 20
+	MaxPageLimit     int32 = 100
+)
+
+// EncodeCursor turns a DynamoDB LastEvaluatedKey into an opaque token clients can send back as `cursor`
+func EncodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	m := make(map[string]interface{})
+	if err := attributevalue.UnmarshalMap(key, &m); err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor turns a token produced by EncodeCursor back into an ExclusiveStartKey
+func DecodeCursor(token string) (map[string]types.AttributeValue, error) {
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %v", err)
+	}
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %v", err)
+	}
+
+	return attributevalue.MarshalMap(m)
+}
+
+// ParseLimit reads the `limit` query parameter, falling back to DefaultPageLimit
+func ParseLimit(queryParams map[string]string) (int32, error) {
+	raw := queryParams["limit"]
+	if len(raw) == 0 {
+		return DefaultPageLimit, nil
+	}
+
+	limit, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil || limit < 1 || int32(limit) > MaxPageLimit {
+		return 0, fmt.Errorf("limit must be an integer between 1 and %d", MaxPageLimit)
+	}
+
+	return int32(limit), nil
+}
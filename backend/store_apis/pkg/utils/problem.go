@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"gopkg.in/validator.v2"
+)
+
+const (
+	ProblemContentType    = "application/problem+json"
+	ProblemTypeDefault    = "about:blank"
+	ProblemTypeValidation = "/problems/validation-error"
+)
+
+// Problem is the RFC 7807 problem details document sent as the body of every error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError tells which field of the request body failed which validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var (
+	rulesMu sync.RWMutex
+	// rules names the validator.v2 rule behind each of its errors
+	rules = map[error]string{
+		validator.ErrZeroValue: "nonzero",
+		validator.ErrMin:       "min",
+		validator.ErrMax:       "max",
+		validator.ErrLen:       "len",
+		validator.ErrRegexp:    "regexp",
+	}
+)
+
+// RegisterValidationRule names the rule behind an error returned by a custom validation func,
+// registered with validator.SetValidationFunc, so it is reported in FieldError.Rule
+func RegisterValidationRule(err error, rule string) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[err] = rule
+}
+
+// ValidationErrors lists the field errors in a validator.v2 error, sorted by field. Fields are named as
+// reported by the validator, so validate with validator.WithPrintJSON(true) to get the JSON names
+func ValidationErrors(err error) []FieldError {
+	var errMap validator.ErrorMap
+	if !errors.As(err, &errMap) {
+		return nil
+	}
+
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	out := []FieldError{}
+	for field, errs := range errMap {
+		for _, e := range errs {
+			rule, ok := rules[e]
+			if !ok {
+				rule = "invalid"
+			}
+			out = append(out, FieldError{
+				Field:   field,
+				Rule:    rule,
+				Message: e.Error(),
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Field != out[j].Field {
+			return out[i].Field < out[j].Field
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	return out
+}
+
+func newProblem(aR *APIResponse) *Problem {
+	problem := &Problem{
+		Type:   ProblemTypeDefault,
+		Title:  http.StatusText(aR.StatusCode),
+		Status: aR.StatusCode,
+		Detail: aR.Data,
+		Errors: aR.Errors,
+	}
+	if len(aR.Errors) > 0 {
+		problem.Type = ProblemTypeValidation
+		problem.Title = "Request validation failed"
+	}
+	return problem
+}
+
+// SetProblemRequest stamps the request path and id on a problem response, which are only known once the
+// response gets back to the router. Any other response is left as is
+func SetProblemRequest(resp *events.APIGatewayProxyResponse, request events.APIGatewayProxyRequest) {
+	if resp.Headers["Content-Type"] != ProblemContentType {
+		return
+	}
+
+	problem := new(Problem)
+	if err := json.Unmarshal([]byte(resp.Body), problem); err != nil {
+		return
+	}
+
+	problem.Instance = request.Path
+	problem.RequestId = request.RequestContext.RequestID
+
+	out, err := json.Marshal(problem)
+	if err != nil {
+		return
+	}
+	resp.Body = string(out)
+}
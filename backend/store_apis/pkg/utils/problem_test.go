@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/validator.v2"
+)
+
+func Test_SendErr_Problem(t *testing.T) {
+	resp, err := SendErr(&APIResponse{
+		StatusCode: http.StatusNotFound,
+		Data:       "no entries found with id: 100",
+		LogMessage: "no entries found with id: 100",
+		Headers:    map[string]string{"Retry-After": "1"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ProblemContentType, resp.Headers["Content-Type"])
+	assert.Equal(t, "1", resp.Headers["Retry-After"])
+
+	SetProblemRequest(&resp, events.APIGatewayProxyRequest{
+		Path:           "/products/100",
+		RequestContext: events.APIGatewayProxyRequestContext{RequestID: "req-1"},
+	})
+
+	problem := new(Problem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), problem))
+	assert.Equal(t, &Problem{
+		Type:      ProblemTypeDefault,
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "no entries found with id: 100",
+		Instance:  "/products/100",
+		RequestId: "req-1",
+	}, problem)
+}
+
+func Test_ValidationErrors(t *testing.T) {
+	type line struct {
+		Quantity int64 `json:"quantity" validate:"min=1"`
+	}
+	type body struct {
+		Name  string `json:"name" validate:"nonzero"`
+		Lines []line `json:"lines" validate:"min=1"`
+	}
+
+	err := validator.WithPrintJSON(true).Validate(&body{Lines: []line{{Quantity: 0}}})
+	assert.Error(t, err)
+
+	assert.Equal(t, []FieldError{
+		{Field: "lines[0].quantity", Rule: "min", Message: "less than min"},
+		{Field: "name", Rule: "nonzero", Message: "zero value"},
+	}, ValidationErrors(err))
+
+	resp, err := SendErr(&APIResponse{
+		StatusCode: http.StatusBadRequest,
+		Data:       "error body validation",
+		Errors:     ValidationErrors(err),
+	})
+	assert.NoError(t, err)
+
+	problem := new(Problem)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), problem))
+	assert.Equal(t, ProblemTypeValidation, problem.Type)
+	assert.Len(t, problem.Errors, 2)
+}
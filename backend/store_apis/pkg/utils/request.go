@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"mime"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const MergePatchContentType = "application/merge-patch+json"
+
+// Header returns the value of the named request header. API Gateway passes header names as the client
+// sent them, so they are matched case-insensitively
+func Header(request events.APIGatewayProxyRequest, name string) string {
+	if v, ok := request.Headers[name]; ok {
+		return v
+	}
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// MediaType returns the media type of the request body, without parameters such as the charset
+func MediaType(request events.APIGatewayProxyRequest) string {
+	mediaType, _, err := mime.ParseMediaType(Header(request, "Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// AnonymousActor is the actor of requests that carry no identity
+const AnonymousActor = "anonymous"
+
+// RequestInfo tells who sent a request, for the records kept of the changes it makes
+type RequestInfo struct {
+	Actor     string
+	RequestId string
+}
+
+type requestInfoKey struct{}
+
+// NewRequestInfo takes the actor from the authorizer of the API, the claims of a JWT or Cognito authorizer
+// or the principal of a Lambda authorizer, falling back to the IAM identity of the caller
+func NewRequestInfo(request events.APIGatewayProxyRequest) RequestInfo {
+	info := RequestInfo{
+		Actor:     AnonymousActor,
+		RequestId: request.RequestContext.RequestID,
+	}
+
+	authorizer := request.RequestContext.Authorizer
+	claims, _ := authorizer["claims"].(map[string]interface{})
+	for _, actor := range []interface{}{claims["sub"], authorizer["principalId"], request.RequestContext.Identity.UserArn} {
+		if s, ok := actor.(string); ok && len(s) > 0 {
+			info.Actor = s
+			break
+		}
+	}
+	return info
+}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the RequestInfo stored in ctx, if any. Work not started by a request, such as
+// scheduled jobs, has none
+func RequestInfoFrom(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Header(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		Headers: map[string]string{
+			"content-type": "application/merge-patch+json; charset=utf-8",
+			"If-Match":     `"3"`,
+		},
+	}
+
+	assert.Equal(t, "application/merge-patch+json; charset=utf-8", Header(request, "Content-Type"))
+	assert.Equal(t, `"3"`, Header(request, "if-match"))
+	assert.Empty(t, Header(request, "If-None-Match"))
+
+	assert.Equal(t, MergePatchContentType, MediaType(request))
+	assert.Empty(t, MediaType(events.APIGatewayProxyRequest{}))
+}
+
+func Test_NewRequestInfo(t *testing.T) {
+	subtests := []struct {
+		name     string
+		context  events.APIGatewayProxyRequestContext
+		expected string
+	}{
+		{
+			name: "jwt_claims",
+			context: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}},
+				Identity:   events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:user/admin"},
+			},
+			expected: "user-1",
+		},
+		{
+			name: "lambda_authorizer",
+			context: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{"principalId": "user-2"},
+			},
+			expected: "user-2",
+		},
+		{
+			name: "iam",
+			context: events.APIGatewayProxyRequestContext{
+				Identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:user/admin"},
+			},
+			expected: "arn:aws:iam::123456789012:user/admin",
+		},
+		{
+			name:     "anonymous",
+			expected: AnonymousActor,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			st.context.RequestID = "request-1"
+			info := NewRequestInfo(events.APIGatewayProxyRequest{RequestContext: st.context})
+			assert.Equal(t, st.expected, info.Actor)
+			assert.Equal(t, "request-1", info.RequestId)
+
+			stored, ok := RequestInfoFrom(WithRequestInfo(context.TODO(), info))
+			assert.True(t, ok)
+			assert.Equal(t, info, stored)
+		})
+	}
+}
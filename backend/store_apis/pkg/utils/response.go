@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog/log"
+)
+
+// JSONResponse is an APIResponse whose body is marshalled from a typed value instead of a string
+type JSONResponse[T any] struct {
+	StatusCode int
+	Body       T
+	LogMessage string
+	Headers    map[string]string
+}
+
+// SendJSON marshals the body, answering with a 500 problem if it cannot
+func SendJSON[T any](jR *JSONResponse[T]) (events.APIGatewayProxyResponse, error) {
+	out, err := json.Marshal(jR.Body)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling response body: %v", err.Error())
+		return SendErr(&APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	return SendOK(&APIResponse{
+		StatusCode: jR.StatusCode,
+		Data:       string(out),
+		LogMessage: jR.LogMessage,
+		Headers:    jR.Headers,
+	})
+}
+
+// CacheValidators describe the version of a resource, sent along with it so that clients and CDNs can
+// revalidate their copy with a conditional GET
+type CacheValidators struct {
+	ETag         string    // strong entity tag, derived from the body when empty
+	LastModified time.Time // optional, sent with second precision
+	CacheControl string    // optional, e.g. `public, max-age=60`
+}
+
+// SendConditional answers a GET with the body and its validators, or with 304 Not Modified and no body
+// when the copy of the client is still current, see NotModified
+func SendConditional[T any](request events.APIGatewayProxyRequest, jR *JSONResponse[T], v CacheValidators) (events.APIGatewayProxyResponse, error) {
+	out, err := json.Marshal(jR.Body)
+	if err != nil {
+		msj := fmt.Sprintf("error marshalling response body: %v", err.Error())
+		return SendErr(&APIResponse{
+			StatusCode: http.StatusInternalServerError,
+			Data:       msj,
+			LogMessage: msj,
+		})
+	}
+
+	etag := v.ETag
+	if len(etag) == 0 {
+		sum := sha256.Sum256(out)
+		etag = ETag(base64.RawURLEncoding.EncodeToString(sum[:16]))
+	}
+
+	headers := map[string]string{"ETag": etag}
+	for k, h := range jR.Headers {
+		headers[k] = h
+	}
+	if !v.LastModified.IsZero() {
+		headers["Last-Modified"] = v.LastModified.UTC().Format(http.TimeFormat)
+	}
+	if len(v.CacheControl) > 0 {
+		headers["Cache-Control"] = v.CacheControl
+	}
+
+	if NotModified(request, etag, v.LastModified) {
+		log.Info().Msgf("%s, not modified", jR.LogMessage)
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotModified,
+			Headers:    headers,
+		}, nil
+	}
+
+	return SendOK(&APIResponse{
+		StatusCode: jR.StatusCode,
+		Data:       string(out),
+		LogMessage: jR.LogMessage,
+		Headers:    headers,
+	})
+}
+
+// NotModified tells whether the copy the client holds of a resource is current, as RFC 7232 evaluates
+// a GET: If-None-Match is compared with etag, and only when absent is If-Modified-Since compared with
+// lastModified
+func NotModified(request events.APIGatewayProxyRequest, etag string, lastModified time.Time) bool {
+	if header := Header(request, "If-None-Match"); len(header) > 0 {
+		for _, tag := range ParseETags(header) {
+			if tag == "*" || WeakMatch(tag, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	header := Header(request, "If-Modified-Since")
+	if len(header) == 0 || lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// SendCreated answers 201 with the created resource and its Location
+func SendCreated[T any](location string, body T, logMessage string) (events.APIGatewayProxyResponse, error) {
+	return SendJSON(&JSONResponse[T]{
+		StatusCode: http.StatusCreated,
+		Body:       body,
+		LogMessage: logMessage,
+		Headers:    map[string]string{"Location": location},
+	})
+}
+
+// SendNoContent answers 204 with an empty body
+func SendNoContent(logMessage string) (events.APIGatewayProxyResponse, error) {
+	log.Info().Msg(logMessage)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNoContent,
+		Headers:    map[string]string{},
+	}, nil
+}
+
+// Location builds the path of resourcePath, e.g. `/orders/123`, as seen by the client of request. Whatever
+// prefix API Gateway kept in front of the matched route, such as the stage name, is kept on the location
+func Location(request events.APIGatewayProxyRequest, resourcePath string) string {
+	routeSegments := len(strings.Split(strings.Trim(request.Resource, "/"), "/"))
+	pathSegments := strings.Split(strings.Trim(request.Path, "/"), "/")
+
+	prefix := ""
+	if n := len(pathSegments) - routeSegments; n > 0 {
+		prefix = "/" + strings.Join(pathSegments[:n], "/")
+	}
+	return prefix + resourcePath
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Location(t *testing.T) {
+	subtests := []struct {
+		name     string
+		resource string
+		path     string
+		expected string
+	}{
+		{
+			name:     "default_stage",
+			resource: "/products",
+			path:     "/products",
+			expected: "/orders/123",
+		},
+		{
+			name:     "named_stage",
+			resource: "/baskets/{id}/checkout",
+			path:     "/dev/baskets/b1/checkout",
+			expected: "/dev/orders/123",
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{Resource: st.resource, Path: st.path}
+			assert.Equal(t, st.expected, Location(request, "/orders/123"))
+		})
+	}
+}
+
+func Test_SendConditional(t *testing.T) {
+	modified := time.Date(2023, 7, 1, 10, 30, 15, 500, time.UTC)
+
+	subtests := []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{
+			name:     "unconditional",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "etag_match",
+			headers:  map[string]string{"If-None-Match": `"1", "3"`},
+			expected: http.StatusNotModified,
+		},
+		{
+			name:     "weak_etag_match",
+			headers:  map[string]string{"if-none-match": `W/"3"`},
+			expected: http.StatusNotModified,
+		},
+		{
+			name:     "any_etag",
+			headers:  map[string]string{"If-None-Match": "*"},
+			expected: http.StatusNotModified,
+		},
+		{
+			name:     "etag_mismatch",
+			headers:  map[string]string{"If-None-Match": `"2"`},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "not_modified_since",
+			headers:  map[string]string{"If-Modified-Since": "Sat, 01 Jul 2023 10:30:15 GMT"},
+			expected: http.StatusNotModified,
+		},
+		{
+			name:     "modified_since",
+			headers:  map[string]string{"If-Modified-Since": "Sat, 01 Jul 2023 10:30:14 GMT"},
+			expected: http.StatusOK,
+		},
+		{
+			name: "etag_takes_precedence",
+			headers: map[string]string{
+				"If-None-Match":     `"2"`,
+				"If-Modified-Since": "Sat, 01 Jul 2023 10:30:15 GMT",
+			},
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			resp, err := SendConditional(events.APIGatewayProxyRequest{Headers: st.headers}, &JSONResponse[map[string]string]{
+				StatusCode: http.StatusOK,
+				Body:       map[string]string{"id": "100"},
+			}, CacheValidators{
+				ETag:         ETag("3"),
+				LastModified: modified,
+				CacheControl: "public, max-age=60",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, st.expected, resp.StatusCode)
+
+			assert.Equal(t, `"3"`, resp.Headers["ETag"])
+			assert.Equal(t, "Sat, 01 Jul 2023 10:30:15 GMT", resp.Headers["Last-Modified"])
+			assert.Equal(t, "public, max-age=60", resp.Headers["Cache-Control"])
+
+			if st.expected == http.StatusNotModified {
+				assert.Empty(t, resp.Body)
+			} else {
+				assert.JSONEq(t, `{"id": "100"}`, resp.Body)
+			}
+		})
+	}
+}
+
+func Test_SendConditional_DerivedETag(t *testing.T) {
+	jR := &JSONResponse[[]string]{StatusCode: http.StatusOK, Body: []string{"100", "200"}}
+
+	resp, err := SendConditional(events.APIGatewayProxyRequest{}, jR, CacheValidators{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, resp.Headers, "Last-Modified")
+
+	etag := resp.Headers["ETag"]
+	assert.NotEmpty(t, etag)
+
+	request := events.APIGatewayProxyRequest{Headers: map[string]string{"If-None-Match": etag}}
+	resp, err = SendConditional(request, jR, CacheValidators{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	jR.Body = append(jR.Body, "300")
+	resp, err = SendConditional(request, jR, CacheValidators{})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Headers["ETag"])
+}
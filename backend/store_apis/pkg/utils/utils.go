@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"encoding/json"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/rs/zerolog/log"
 )
@@ -9,6 +11,8 @@ type APIResponse struct {
 	StatusCode int
 	Data       string
 	LogMessage string
+	Headers    map[string]string
+	Errors     []FieldError // per field validation errors, for error responses only
 }
 
 func Send(statusCode int, data string) (events.APIGatewayProxyResponse, error) {
@@ -23,10 +27,31 @@ func Send(statusCode int, data string) (events.APIGatewayProxyResponse, error) {
 
 func SendOK(aR *APIResponse) (events.APIGatewayProxyResponse, error) {
 	log.Info().Msg(aR.LogMessage)
-	return Send(aR.StatusCode, aR.Data)
+	return send(aR)
 }
 
+// SendErr sends Data as the detail of a problem details document, see Problem
 func SendErr(aR *APIResponse) (events.APIGatewayProxyResponse, error) {
 	log.Error().Msg(aR.LogMessage)
-	return Send(aR.StatusCode, aR.Data)
+
+	out, err := json.Marshal(newProblem(aR))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	resp, err := send(&APIResponse{
+		StatusCode: aR.StatusCode,
+		Data:       string(out),
+		Headers:    aR.Headers,
+	})
+	resp.Headers["Content-Type"] = ProblemContentType
+	return resp, err
+}
+
+func send(aR *APIResponse) (events.APIGatewayProxyResponse, error) {
+	resp, err := Send(aR.StatusCode, aR.Data)
+	for k, v := range aR.Headers {
+		resp.Headers[k] = v
+	}
+	return resp, err
 }